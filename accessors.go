@@ -0,0 +1,96 @@
+package jsonx
+
+import "math"
+
+// AsString returns v as a string if it is one.
+func AsString(v interface{}) (string, bool) {
+	s, ok := v.(string)
+	return s, ok
+}
+
+// AsBool returns v as a bool if it is one.
+func AsBool(v interface{}) (bool, bool) {
+	b, ok := v.(bool)
+	return b, ok
+}
+
+// AsMap returns v as an object if it is one. For an *OrderedMap it returns the underlying map, see
+// OrderedMap.Map for the restrictions.
+func AsMap(v interface{}) (map[string]interface{}, bool) {
+	return objectMap(v)
+}
+
+// AsSlice returns v as an array if it is one.
+func AsSlice(v interface{}) ([]interface{}, bool) {
+	a, ok := v.([]interface{})
+	return a, ok
+}
+
+// AsInt64 converts any of the numeric types produced by Decode to int64. It fails if the value
+// is not a number, is not integral or is out of range.
+func AsInt64(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		if uint64(v) > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// AsFloat converts any of the numeric types produced by Decode to float64. Integers that
+// exceed 2^53 in magnitude may lose precision.
+func AsFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,96 @@
+package jsonx
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestAsInt64(t *testing.T) {
+	for i, tt := range []struct {
+		in       interface{}
+		expected int64
+		ok       bool
+	}{
+		{in: 5.0, expected: 5, ok: true},
+		{in: -5.0, expected: -5, ok: true},
+		{in: 5.5},
+		{in: 1e19},
+		{in: math.Inf(1)},
+		{in: math.NaN()},
+		{in: int(-7), expected: -7, ok: true},
+		{in: int8(-128), expected: -128, ok: true},
+		{in: int16(300), expected: 300, ok: true},
+		{in: int32(-70000), expected: -70000, ok: true},
+		{in: int64(math.MaxInt64), expected: math.MaxInt64, ok: true},
+		{in: uint(10), expected: 10, ok: true},
+		{in: uint8(255), expected: 255, ok: true},
+		{in: uint16(65535), expected: 65535, ok: true},
+		{in: uint32(math.MaxUint32), expected: math.MaxUint32, ok: true},
+		{in: uint64(math.MaxInt64), expected: math.MaxInt64, ok: true},
+		{in: uint64(math.MaxUint64)},
+		{in: "5"},
+		{in: nil},
+	} {
+		v, ok := AsInt64(tt.in)
+		if v != tt.expected || ok != tt.ok {
+			t.Errorf("#%d: %v, %v, want %v, %v", i, v, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestAsFloat(t *testing.T) {
+	for i, tt := range []struct {
+		in       interface{}
+		expected float64
+		ok       bool
+	}{
+		{in: 5.5, expected: 5.5, ok: true},
+		{in: int(-7), expected: -7, ok: true},
+		{in: int8(-128), expected: -128, ok: true},
+		{in: uint32(7), expected: 7, ok: true},
+		{in: uint64(1 << 60), expected: 1 << 60, ok: true},
+		{in: true},
+		{in: "5"},
+	} {
+		v, ok := AsFloat(tt.in)
+		if v != tt.expected || ok != tt.ok {
+			t.Errorf("#%d: %v, %v, want %v, %v", i, v, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestAsOthers(t *testing.T) {
+	v, err := Decode([]byte(`{s: "str", b: true, m: {}, a: [1], n: 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := AsMap(v)
+	if !ok {
+		t.Fatal("AsMap failed")
+	}
+	if s, ok := AsString(m["s"]); !ok || s != "str" {
+		t.Fatalf("AsString: %v, %v", s, ok)
+	}
+	if b, ok := AsBool(m["b"]); !ok || !b {
+		t.Fatalf("AsBool: %v, %v", b, ok)
+	}
+	if m1, ok := AsMap(m["m"]); !ok || len(m1) != 0 {
+		t.Fatalf("AsMap: %v, %v", m1, ok)
+	}
+	if a, ok := AsSlice(m["a"]); !ok || !reflect.DeepEqual(a, []interface{}{1.0}) {
+		t.Fatalf("AsSlice: %v, %v", a, ok)
+	}
+	if _, ok := AsString(m["n"]); ok {
+		t.Fatal("AsString succeeded for a number")
+	}
+	if _, ok := AsBool(m["s"]); ok {
+		t.Fatal("AsBool succeeded for a string")
+	}
+	if _, ok := AsMap(m["a"]); ok {
+		t.Fatal("AsMap succeeded for an array")
+	}
+	if _, ok := AsSlice(m["m"]); ok {
+		t.Fatal("AsSlice succeeded for an object")
+	}
+}
@@ -0,0 +1,123 @@
+package jsonx
+
+import (
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// AppendEncode appends the encoding of v to dst and returns the extended slice. The result is the same
+// as that of MarshalAppend, but the common values (nil, bool, float64, int, strings that do not need
+// escaping, arrays and objects) are appended directly rather than through an Encoder, which makes it
+// faster for small values. Other values are encoded by an Encoder appending to the same slice.
+func AppendEncode(dst []byte, v interface{}) ([]byte, error) {
+	var a appender
+	b, err := a.appendValue(dst, v)
+	if err != nil {
+		return dst, err
+	}
+	return b, nil
+}
+
+// appender implements AppendEncode, the Encoder for the values without a fast path is created on first use
+type appender struct {
+	w appendWriter
+	e *Encoder
+}
+
+func (a *appender) encoder(dst []byte) *Encoder {
+	if a.e == nil {
+		a.e = &Encoder{w: &a.w}
+	}
+	a.w.buf = dst
+	return a.e
+}
+
+func (a *appender) appendValue(dst []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(dst, "null"...), nil
+	case bool:
+		if v {
+			return append(dst, "true"...), nil
+		}
+		return append(dst, "false"...), nil
+	case float64:
+		return strconv.AppendFloat(dst, v, 'g', -1, 64), nil
+	case int:
+		dst = append(dst, "int("...)
+		dst = strconv.AppendInt(dst, int64(v), 10)
+		return append(dst, ')'), nil
+	case string:
+		if isPlainString(v) {
+			return appendQuoted(dst, v), nil
+		}
+	case []interface{}:
+		return a.appendArray(dst, v)
+	case map[string]interface{}:
+		return a.appendMap(dst, v)
+	}
+	err := a.encoder(dst).encodeValue(v)
+	return a.w.buf, err
+}
+
+func (a *appender) appendArray(dst []byte, arr []interface{}) ([]byte, error) {
+	dst = append(dst, '[')
+	for i, v := range arr {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		var err error
+		if dst, err = a.appendValue(dst, v); err != nil {
+			return dst, err
+		}
+	}
+	return append(dst, ']'), nil
+}
+
+func (a *appender) appendMap(dst []byte, m map[string]interface{}) ([]byte, error) {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	dst = append(dst, '{')
+	for i, key := range keys {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		if isAtomKey(key) {
+			dst = append(dst, key...)
+		} else if isPlainString(key) {
+			dst = appendQuoted(dst, key)
+		} else {
+			e := a.encoder(dst)
+			if err := e.encodeKey(key); err != nil {
+				return a.w.buf, err
+			}
+			dst = a.w.buf
+		}
+		dst = append(dst, ':')
+		var err error
+		if dst, err = a.appendValue(dst, m[key]); err != nil {
+			return dst, err
+		}
+	}
+	return append(dst, '}'), nil
+}
+
+// isPlainString returns true if the string can be written between quotes as is
+func isPlainString(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' || c == '"' || c == '\\' || c >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func appendQuoted(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	dst = append(dst, s...)
+	return append(dst, '"')
+}
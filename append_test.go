@@ -0,0 +1,54 @@
+package jsonx
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAppendEncode(t *testing.T) {
+	for i, v := range []interface{}{
+		testMap,
+		nil,
+		true,
+		-1.5e-7,
+		42,
+		"plain",
+		"needs \"escaping\"\n",
+		"non-ascii ü",
+		[]interface{}{},
+		map[string]interface{}{},
+		map[string]interface{}{"a b": 1.0, "ü": "x", "": nil, "k\n": false, "ok": []interface{}{int8(1), net.IPv4(1, 2, 3, 4)}},
+		[]interface{}{[]interface{}{map[string]interface{}{"t": time.Unix(0, 0).UTC()}}, []byte{1, 2}},
+	} {
+		expected, err := Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := AppendEncode([]byte("prefix:"), v)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if s := string(b); s != "prefix:"+string(expected) {
+			t.Errorf("#%d: %s, expected prefix:%s", i, s, expected)
+		}
+	}
+
+	dst := []byte("prefix:")
+	b, err := AppendEncode(dst, map[string]interface{}{"a": struct{}{}})
+	if err == nil || string(b) != "prefix:" {
+		t.Fatalf("Unexpected result: %q, %v", b, err)
+	}
+}
+
+func BenchmarkAppendEncode(b *testing.B) {
+	b.ReportAllocs()
+	var buf []byte
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = AppendEncode(buf[:0], testMap); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
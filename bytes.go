@@ -2,6 +2,7 @@ package jsonx
 
 import (
 	"strconv"
+	"strings"
 	"unicode"
 	"unicode/utf16"
 	"unicode/utf8"
@@ -24,7 +25,9 @@ func quoteChar(c byte) string {
 	return "'" + s[1:len(s)-1] + "'"
 }
 
-func unquoteBytes(s, b []byte) (t []byte, ok bool) {
+// unquoteBytes unescapes the content of a string literal using b as the buffer if it is large enough.
+// Invalid UTF-8 and unpaired surrogate escapes are replaced with U+FFFD or removed if drop is true.
+func unquoteBytes(s, b []byte, drop bool) (t []byte, ok bool) {
 	if len(s) == 0 {
 		return t, true
 	}
@@ -113,6 +116,9 @@ func unquoteBytes(s, b []byte) (t []byte, ok bool) {
 						break
 					}
 					// Invalid surrogate; fall back to replacement rune.
+					if drop {
+						break
+					}
 					rr = unicode.ReplacementChar
 				}
 				w += utf8.EncodeRune(b[w:], rr)
@@ -132,12 +138,180 @@ func unquoteBytes(s, b []byte) (t []byte, ok bool) {
 		default:
 			rr, size := utf8.DecodeRune(s[r:])
 			r += size
+			if rr == utf8.RuneError && size == 1 && drop {
+				break
+			}
 			w += utf8.EncodeRune(b[w:], rr)
 		}
 	}
 	return b[0:w], true
 }
 
+// unquotedLen returns the length of the content of a string literal after unescaping it with unquoteBytes
+// and whether it needs unescaping at all (i.e. contains escapes or invalid UTF-8). n is -1 if s is invalid.
+func unquotedLen(s []byte, drop bool) (n int, escaped bool) {
+	for r := 0; r < len(s); {
+		c := s[r]
+		if c >= ' ' && c < utf8.RuneSelf && c != '\\' && c != '"' {
+			n++
+			r++
+			continue
+		}
+		switch {
+		case c == '\\':
+			escaped = true
+			if r+1 >= len(s) {
+				return -1, true
+			}
+			switch s[r+1] {
+			case '"', '\\', '/', '\'', 'b', 'f', 'n', 'r', 't':
+				n++
+				r += 2
+			case 'u':
+				rr := getu4(s[r:])
+				if rr < 0 {
+					return -1, true
+				}
+				r += 6
+				if utf16.IsSurrogate(rr) {
+					if dec := utf16.DecodeRune(rr, getu4(s[r:])); dec != unicode.ReplacementChar {
+						n += utf8.RuneLen(dec)
+						r += 6
+						break
+					}
+					if !drop {
+						n += utf8.RuneLen(unicode.ReplacementChar)
+					}
+					break
+				}
+				n += utf8.RuneLen(rr)
+			default:
+				return -1, true
+			}
+		case c == '"', c < ' ':
+			return -1, true
+		default:
+			rr, size := utf8.DecodeRune(s[r:])
+			r += size
+			if rr == utf8.RuneError && size == 1 {
+				escaped = true
+				if !drop {
+					n += utf8.RuneLen(rr)
+				}
+				break
+			}
+			n += size
+		}
+	}
+	return n, escaped
+}
+
+// unquoteString unescapes the content of a string literal the same way as unquoteBytes. n is the length of
+// the result as returned by unquotedLen, which must have accepted s, so the string is allocated once with
+// the exact size.
+func unquoteString(s []byte, n int, drop bool) string {
+	var b strings.Builder
+	b.Grow(n)
+	for r := 0; r < len(s); {
+		// the characters that do not need unescaping are copied at once
+		start := r
+		for r < len(s) {
+			c := s[r]
+			if c == '\\' {
+				break
+			}
+			if c < utf8.RuneSelf {
+				r++
+				continue
+			}
+			rr, size := utf8.DecodeRune(s[r:])
+			if rr == utf8.RuneError && size == 1 {
+				break
+			}
+			r += size
+		}
+		b.Write(s[start:r])
+		if r == len(s) {
+			break
+		}
+		if s[r] != '\\' {
+			// invalid UTF-8
+			if !drop {
+				b.WriteRune(utf8.RuneError)
+			}
+			r++
+			continue
+		}
+		switch c := s[r+1]; c {
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'u':
+			rr := getu4(s[r:])
+			r += 6
+			if utf16.IsSurrogate(rr) {
+				if dec := utf16.DecodeRune(rr, getu4(s[r:])); dec != unicode.ReplacementChar {
+					b.WriteRune(dec)
+					r += 6
+					continue
+				}
+				if drop {
+					continue
+				}
+				rr = unicode.ReplacementChar
+			}
+			b.WriteRune(rr)
+			continue
+		default:
+			// '"', '\\', '/' or '\''
+			b.WriteByte(c)
+		}
+		r += 2
+	}
+	return b.String()
+}
+
+// invalidUTF8 returns the index of the first invalid UTF-8 sequence in s or -1 if there is none. If escapes
+// is true, s is the content of a string literal and \u escapes of unpaired surrogates are also reported.
+func invalidUTF8(s []byte, escapes bool) int {
+	for r := 0; r < len(s); {
+		c := s[r]
+		if c == '\\' && escapes {
+			if r+1 < len(s) && s[r+1] == 'u' {
+				rr := getu4(s[r:])
+				if utf16.IsSurrogate(rr) {
+					if utf16.DecodeRune(rr, getu4(s[r+6:])) == unicode.ReplacementChar {
+						return r
+					}
+					r += 12
+					continue
+				}
+				r += 6
+				continue
+			}
+			r += 2
+			continue
+		}
+		if c < utf8.RuneSelf {
+			r++
+			continue
+		}
+		rr, size := utf8.DecodeRune(s[r:])
+		if rr == utf8.RuneError && size == 1 {
+			return r
+		}
+		r += size
+	}
+	return -1
+}
+
 // getu4 decodes \uXXXX from the beginning of s, returning the hex value,
 // or it returns -1.
 func getu4(s []byte) rune {
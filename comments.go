@@ -0,0 +1,153 @@
+package jsonx
+
+import (
+	"strconv"
+	"strings"
+)
+
+// DecodeWithComments is the same as Decode but it allows comments and returns them keyed by the RFC 6901
+// JSON Pointer of the value they are attached to. The AllowComments setting for subsequent calls is not
+// changed. Each comment is split into lines without the comment delimiters and surrounding whitespace,
+// empty lines are dropped.
+//
+// A comment that follows a value on the same line (after the comma, if there is one) is a trailing
+// comment of that value. Any other comment is a leading comment of the next value, for object members
+// this includes comments before the key. Comments before the closing bracket of an array or an object
+// that are not trailing comments of the last element are attached to the array or the object, comments
+// after the top-level value to the top-level value (""). Leading comments come before trailing ones.
+// Comments inside typed atoms and between concatenated strings are dropped.
+func (d *Decoder) DecodeWithComments() (interface{}, map[string][]string, error) {
+	comments := d.comments
+	d.comments = true
+	defer func() { d.comments = comments }()
+	// the leading comments are walked again from the start
+	start := d.pos
+	if _, err := d.begin(); err != nil {
+		return nil, nil, err
+	}
+	val, err := d.any()
+	if err != nil {
+		return nil, nil, err
+	}
+	// the value is known to be valid at this point, so the second pass does not need to check the syntax
+	end := d.pos
+	w := commentWalker{d: d, comments: make(map[string][]string)}
+	d.pos = start
+	if err = w.value(""); err != nil {
+		return nil, nil, err
+	}
+	w.space()
+	w.attach("")
+	d.pos = end
+	if err = d.extraData(); err != nil {
+		return val, w.comments, err
+	}
+	return val, w.comments, nil
+}
+
+type commentWalker struct {
+	d        *Decoder
+	comments map[string][]string
+	pending  []string // leading comments of the next value
+	last     string   // pointer of the last value
+	lastOpen bool     // still on the line where the last value ended
+}
+
+// space skips spaces and collects comments, returning the next byte
+func (w *commentWalker) space() byte {
+	d := w.d
+	for d.pos < d.end {
+		switch c := d.data[d.pos]; c {
+		case '\n':
+			w.lastOpen = false
+			fallthrough
+		case ' ', '\t', '\r':
+			d.pos++
+		case '/':
+			start := d.pos
+			if !d.skipComment() {
+				return c
+			}
+			lines := commentLines(string(d.data[start:d.pos]))
+			if w.lastOpen {
+				w.comments[w.last] = append(w.comments[w.last], lines...)
+			} else {
+				w.pending = append(w.pending, lines...)
+			}
+		default:
+			return c
+		}
+	}
+	return 0
+}
+
+// attach attaches the pending comments to the value
+func (w *commentWalker) attach(pointer string) {
+	if len(w.pending) > 0 {
+		w.comments[pointer] = append(w.comments[pointer], w.pending...)
+		w.pending = nil
+	}
+}
+
+func (w *commentWalker) value(pointer string) error {
+	d := w.d
+	c := w.space()
+	w.lastOpen = false
+	w.attach(pointer)
+	switch c {
+	case '[':
+		d.pos++
+		for i := 0; w.space() != ']'; i++ {
+			if err := w.value(pointer + "/" + strconv.Itoa(i)); err != nil {
+				return err
+			}
+			if w.space() == ',' {
+				d.pos++
+			}
+		}
+		w.attach(pointer)
+		d.pos++
+	case '{':
+		d.pos++
+		for w.space() != '}' {
+			w.lastOpen = false
+			key, err := d.objectKey()
+			if err != nil {
+				return err
+			}
+			// the colon
+			w.space()
+			d.pos++
+			if err = w.value(pointer + "/" + escapePointerToken(key)); err != nil {
+				return err
+			}
+			if w.space() == ',' {
+				d.pos++
+			}
+		}
+		w.attach(pointer)
+		d.pos++
+	default:
+		if err := d.skipValue(); err != nil {
+			return err
+		}
+	}
+	w.last, w.lastOpen = pointer, true
+	return nil
+}
+
+// commentLines returns the text of the comment split into non-empty lines
+func commentLines(comment string) []string {
+	if strings.HasPrefix(comment, "//") {
+		comment = comment[2:]
+	} else {
+		comment = strings.TrimSuffix(comment[2:], "*/")
+	}
+	var lines []string
+	for _, line := range strings.Split(comment, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
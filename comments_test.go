@@ -0,0 +1,66 @@
+package jsonx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeWithComments(t *testing.T) {
+	const src = `// the config
+{
+	// listen address
+	addr: ipport("0.0.0.0:80"), // public
+	/* limits */ limits: {
+		conns: 100, // per client
+		/*
+		 * in seconds
+		 */
+		timeout: 30,
+		// not used yet
+	},
+	names: [
+		"a", // first
+		// second
+		"b"
+	],
+	key /* odd */: 1
+} // end
+// really
+`
+	d := NewDecoder([]byte(src))
+	v, comments, err := d.DecodeWithComments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := v.(map[string]interface{}); !ok || len(m) != 4 {
+		t.Fatalf("Unexpected value: %v", v)
+	}
+	expected := map[string][]string{
+		"":                {"the config", "end", "really"},
+		"/addr":           {"listen address", "public"},
+		"/limits":         {"limits", "not used yet"},
+		"/limits/conns":   {"per client"},
+		"/limits/timeout": {"* in seconds"},
+		"/names/0":        {"first"},
+		"/names/1":        {"second"},
+		"/key":            {"odd"},
+	}
+	if !reflect.DeepEqual(comments, expected) {
+		t.Fatalf("Unexpected comments: %#v", comments)
+	}
+
+	d = NewDecoder([]byte(`[1, /* x */ 2`))
+	if _, comments, err = d.DecodeWithComments(); err == nil || comments != nil {
+		t.Fatalf("Expected error, got %v", comments)
+	}
+
+	// comments are only allowed for the call itself
+	d = NewDecoder([]byte("1 // one\n 2 // two"))
+	d.AllowTrailingData()
+	if _, comments, err = d.DecodeWithComments(); err != nil || !reflect.DeepEqual(comments, map[string][]string{"": {"one"}}) {
+		t.Fatalf("Unexpected comments: %v, %v", comments, err)
+	}
+	if v, err := d.Decode(); err == nil {
+		t.Fatalf("Expected error, got %v", v)
+	}
+}
@@ -0,0 +1,85 @@
+package jsonx
+
+import "encoding/json"
+
+// Compact copies all strings, including object keys, contained in the decoded value v so that
+// they no longer reference the data shared by a Decoder in AllocString mode. This allows the
+// garbage collector to free the data when only a part of the decoded value is retained, at the cost
+// of allocating the strings again. Maps and slices are updated in place, the resulting value is returned.
+// Equivalent of CompactLarger(v, 0).
+func Compact(v interface{}) interface{} {
+	return CompactLarger(v, 0)
+}
+
+// CompactLarger is the same as Compact but it only copies the strings (and object keys) that are at least
+// minLen bytes long, the shorter ones keep referencing the data. This avoids allocating many small strings
+// again when it is enough to release the large ones, e.g. when the retained part of a large document is
+// parsed from a separate buffer. Note that the data cannot be freed as long as any of the strings that
+// reference it is retained.
+func CompactLarger(v interface{}, minLen int) interface{} {
+	switch v1 := v.(type) {
+	case string:
+		if len(v1) >= minLen {
+			return copyString(v1)
+		}
+	case json.Number:
+		if len(v1) >= minLen {
+			return json.Number(copyString(string(v1)))
+		}
+	case RawNumber:
+		if len(v1) >= minLen {
+			return RawNumber(copyString(string(v1)))
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v1))
+		for key := range v1 {
+			keys = append(keys, key)
+		}
+		for _, key := range keys {
+			val := CompactLarger(v1[key], minLen)
+			if len(key) < minLen {
+				v1[key] = val
+				continue
+			}
+			// deleting the key first makes the map use the new key string
+			delete(v1, key)
+			v1[copyString(key)] = val
+		}
+	case *OrderedMap:
+		if v1 != nil {
+			v1.compact(minLen)
+		}
+	case []interface{}:
+		for i, item := range v1 {
+			v1[i] = CompactLarger(item, minLen)
+		}
+	}
+	return v
+}
+
+// compact implements CompactLarger for OrderedMap, copied keys replace the original ones in the key
+// order and in the comments too
+func (m *OrderedMap) compact(minLen int) {
+	for i, key := range m.keys {
+		val := CompactLarger(m.values[key], minLen)
+		if len(key) < minLen {
+			m.values[key] = val
+			continue
+		}
+		newKey := copyString(key)
+		m.keys[i] = newKey
+		delete(m.values, key)
+		m.values[newKey] = val
+		if comment, exists := m.comments[key]; exists {
+			delete(m.comments, key)
+			m.comments[newKey] = comment
+		}
+	}
+}
+
+func copyString(s string) string {
+	if len(s) == 0 {
+		return ""
+	}
+	return string([]byte(s))
+}
@@ -0,0 +1,89 @@
+package jsonx
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCompact(t *testing.T) {
+	d := NewDecoder([]byte(`{a: "x", b: ["y", {c: "z"}]}`))
+	d.AllocString()
+	v, err := d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"a": "x",
+		"b": []interface{}{"y", map[string]interface{}{"c": "z"}},
+	}
+	if v := Compact(v); !reflect.DeepEqual(v, expected) {
+		t.Fatalf("Unexpected value: %v", v)
+	}
+}
+
+func TestCompactLarger(t *testing.T) {
+	long := strings.Repeat("x", 16)
+	var v interface{} = []interface{}{"a", "bc", []interface{}{"def"}}
+	if n := testing.AllocsPerRun(10, func() { CompactLarger(v, len(long)) }); n != 0 {
+		t.Fatalf("Short strings copied: %v allocations", n)
+	}
+	if n := testing.AllocsPerRun(10, func() { CompactLarger(v, 0) }); n == 0 {
+		t.Fatal("No strings copied")
+	}
+
+	m := map[string]interface{}{"a": long, long: []interface{}{"b", long}}
+	expected := map[string]interface{}{"a": long, long: []interface{}{"b", long}}
+	if res := CompactLarger(m, len(long)); !reflect.DeepEqual(res, expected) {
+		t.Fatalf("Unexpected value: %v", res)
+	}
+}
+
+func decodeSmallField(size int, compact bool) (string, error) {
+	data := []byte(`{"small": "value", "large": "` + strings.Repeat("#", size) + `"}`)
+	d := NewDecoder(data)
+	d.AllocString()
+	m, err := d.DecodeObject()
+	if err != nil {
+		return "", err
+	}
+	if compact {
+		Compact(m)
+	}
+	return m["small"].(string), nil
+}
+
+func heapAlloc() uint64 {
+	var ms runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	return ms.HeapAlloc
+}
+
+func TestCompactReleasesData(t *testing.T) {
+	const size = 32 << 20
+	before := heapAlloc()
+
+	small, err := decodeSmallField(size, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after := heapAlloc(); after < before+size/2 {
+		t.Fatalf("Expected the data to be retained without Compact (%d -> %d)", before, after)
+	}
+	runtime.KeepAlive(small)
+	small = ""
+
+	before = heapAlloc()
+	small, err = decodeSmallField(size, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after := heapAlloc(); after > before+size/2 {
+		t.Fatalf("Expected the data to be released after Compact (%d -> %d)", before, after)
+	}
+	if small != "value" {
+		t.Fatalf("Unexpected value: %s", small)
+	}
+}
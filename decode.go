@@ -1,12 +1,28 @@
 package jsonx
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
 	"net"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 	"unicode"
+	"unicode/utf8"
 	"encoding/base64"
+	"encoding/hex"
+)
+
+var (
+	// emptyArray is returned for empty arrays. It has zero capacity so appending to it always
+	// allocates a new backing array which makes it safe to share.
+	emptyArray = make([]interface{}, 0)
+	// emptyArrayValue is emptyArray converted to interface{} once to avoid an allocation per array.
+	emptyArrayValue interface{} = emptyArray
 )
 
 // Decoder is the object that holds the state of the decoding
@@ -16,8 +32,57 @@ type Decoder struct {
 	data      []byte
 	sdata     string
 	usestring bool
+	usenumber bool
+	rawnumber bool
+	epochUnit EpochUnit
+	numconv   func(raw []byte) (interface{}, error)
+	ipv4Map   bool
+	foldNames bool
+	keys      map[string]string
+	comments  bool
+	rawstr    bool
+	concat    bool
+	badUTF8   InvalidUTF8Policy
+	extkeys   bool
+	strict    bool
+	iterative bool
+	trailing  bool
+	leadPlus  bool
+	ordered   bool
+	boolAlias bool
+	foldKwds  bool
+	maxDepth  int
+	maxStrLen int
+	maxKeys   int
+	depth     int
+	open      bool // an unterminated block comment was skipped, see skipComment
+	r         io.Reader
+	maxInput  int64
+	readErr   error
 }
 
+// InvalidUTF8Policy defines how the Decoder handles invalid UTF-8 in strings, see Decoder.SetInvalidUTF8Policy.
+type InvalidUTF8Policy int
+
+const (
+	ReplaceInvalidUTF8 InvalidUTF8Policy = iota // replace with U+FFFD (the default)
+	DropInvalidUTF8                             // remove the invalid bytes
+	RejectInvalidUTF8                           // return an InvalidUTF8Error, same as StrictUTF8
+)
+
+// EpochUnit is the unit of Unix timestamps in datetime values, see Decoder.SetEpochUnit.
+type EpochUnit int
+
+const (
+	Seconds EpochUnit = iota
+	Millis
+	Micros
+	Nanos
+)
+
+// maxInternedKeys limits the number of distinct keys remembered by InternKeys
+const maxInternedKeys = 4096
+
 // NewDecoder creates new Decoder from the JSON-encoded data
 func NewDecoder(data []byte) *Decoder {
 	return &Decoder{
@@ -26,6 +91,48 @@ func NewDecoder(data []byte) *Decoder {
 	}
 }
 
+// NewReaderDecoder creates new Decoder that reads the JSONX-encoded data from r.
+// The data is read in full and buffered on the first call to any of the decoding methods (reading stops at EOF),
+// so the methods work exactly as with NewDecoder. Use SetMaxInputSize to limit the amount of data read.
+// If AllocString is used the string version of the data is allocated after it has been read.
+func NewReaderDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		r: r,
+	}
+}
+
+// SetMaxInputSize limits the amount of data read by a Decoder created with NewReaderDecoder.
+// If the input is larger, decoding fails with ErrInputTooLarge. Zero (the default) means no limit.
+func (d *Decoder) SetMaxInputSize(n int64) {
+	d.maxInput = n
+}
+
+// load reads the data if the Decoder was created with NewReaderDecoder
+func (d *Decoder) load() error {
+	if d.r == nil {
+		return d.readErr
+	}
+	r := d.r
+	d.r = nil
+	if d.maxInput > 0 {
+		r = io.LimitReader(r, d.maxInput+1)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err == nil && d.maxInput > 0 && int64(len(data)) > d.maxInput {
+		err = ErrInputTooLarge
+	}
+	if err != nil {
+		d.readErr = err
+		return err
+	}
+	d.data = data
+	d.end = len(data)
+	if d.usestring {
+		d.sdata = string(data)
+	}
+	return nil
+}
+
 // AllocString pre-allocates a string version of the data before starting
 // to decode the data.
 // It is used to make the decode operation faster(see below) by doing one
@@ -62,11 +169,255 @@ func NewDecoder(data []byte) *Decoder {
 // 	// inspect memory stats again; MemStats.Alloc ~= 1M
 // 	// it means that the chunk that was located in the "baz" value is not freed
 //
+// If only a small part of the result is retained use Compact to copy the strings out of
+// the shared data, so that it can be freed.
 func (d *Decoder) AllocString() {
 	d.sdata = string(d.data)
 	d.usestring = true
 }
 
+// UseNumber makes the Decoder return numbers as json.Number rather than float64, preserving
+// the precision of large integers and decimals. Typed integers (e.g. int64(...)) are not affected.
+func (d *Decoder) UseNumber() {
+	d.usenumber = true
+}
+
+// PreserveIPv4Mapped makes the Decoder distinguish between IPv4 addresses and IPv4-mapped IPv6
+// addresses: ip("a.b.c.d") is decoded as a 4-byte net.IP and ip("::ffff:a.b.c.d") as a 16-byte one.
+// By default both are decoded as 16-byte values. The same applies to the addresses in ipport values.
+func (d *Decoder) PreserveIPv4Mapped() {
+	d.ipv4Map = true
+}
+
+// RawNumbers makes the Decoder return numbers as RawNumber holding the literal exactly as it appears
+// in the input. It takes precedence over UseNumber.
+func (d *Decoder) RawNumbers() {
+	d.rawnumber = true
+}
+
+// SetEpochUnit sets the unit of Unix timestamps given as unquoted integers in datetime values, e.g.
+// datetime(1700000000). The default is Seconds. Quoted values are always parsed as RFC3339.
+func (d *Decoder) SetEpochUnit(unit EpochUnit) {
+	d.epochUnit = unit
+}
+
+// SetNumberConverter sets a function that converts numbers instead of parsing them as float64, e.g. to
+// a decimal type. It receives the literal including the sign, the slice must not be retained. The
+// converter takes precedence over RawNumbers and UseNumber. Typed integers (e.g. int64(...)) are not affected.
+func (d *Decoder) SetNumberConverter(conv func(raw []byte) (interface{}, error)) {
+	d.numconv = conv
+}
+
+// InternKeys makes the Decoder use a single string instance for all identical object keys rather
+// than allocating a new string for every occurrence. This reduces the memory retained by
+// the decoded values when the same keys are repeated many times (e.g. in an array of objects).
+// Up to 4096 distinct keys are interned, the remaining keys are allocated as usual.
+//
+// Decoding an array of 1000 objects with 5 keys each (BenchmarkDecodeNoInternKeys and
+// BenchmarkDecodeInternKeys):
+//
+//	without InternKeys - 13012 allocations, 451 KB allocated
+//	with InternKeys    -  8019 allocations, 420 KB allocated
+func (d *Decoder) InternKeys() {
+	d.keys = make(map[string]string)
+}
+
+// AllowComments makes the Decoder accept JavaScript-style comments (// line and /* block */)
+// wherever whitespace is allowed. An unterminated block comment results in ErrUnexpectedEOF.
+func (d *Decoder) AllowComments() {
+	d.comments = true
+}
+
+// AllowRawStrings makes the Decoder accept raw multiline strings enclosed in triple quotes ("""...""").
+// The content of a raw string is taken verbatim up to the first closing """, escapes are not processed,
+// therefore it cannot contain """ or end with '"'.
+func (d *Decoder) AllowRawStrings() {
+	d.rawstr = true
+}
+
+// AllowStringConcat makes the Decoder concatenate adjacent string literals separated by whitespace,
+// i.e. "foo" "bar" is decoded as "foobar". This only applies to values, not to object keys.
+func (d *Decoder) AllowStringConcat() {
+	d.concat = true
+}
+
+// AllowExtendedKeys widens the grammar of unquoted object keys: rather than identifiers they can be
+// any sequence of letters, digits, '_', '-' and '.', e.g. 2fa, x-api-key or a.b.c. A key that looks
+// like a number (e.g. 123) is still a string key. See also Encoder.ExtendedKeys.
+func (d *Decoder) AllowExtendedKeys() {
+	d.extkeys = true
+}
+
+// StrictUTF8 makes the Decoder reject strings that contain invalid UTF-8 or unpaired UTF-16 surrogate
+// escapes (e.g. "\ud800") with an InvalidUTF8Error. By default they are replaced with U+FFFD.
+func (d *Decoder) StrictUTF8() {
+	d.badUTF8 = RejectInvalidUTF8
+}
+
+// SetInvalidUTF8Policy sets how invalid UTF-8 and unpaired UTF-16 surrogate escapes in strings are
+// handled. A string containing either is always copied while unescaping, so DropInvalidUTF8 does not add
+// to the cost except for raw strings (see AllowRawStrings), which then need to be copied as well.
+func (d *Decoder) SetInvalidUTF8Policy(policy InvalidUTF8Policy) {
+	d.badUTF8 = policy
+}
+
+// Strict makes the Decoder only accept standard JSON as defined by RFC 8259: object keys must be
+// quoted strings, trailing commas and typed atoms (e.g. int(5)) are not allowed. Numbers with leading
+// zeros (e.g. 012 or -00) are rejected with an error pointing at the digit following the zero, 0, 0.5 and
+// 0e1 are valid.
+func (d *Decoder) Strict() {
+	d.strict = true
+}
+
+// AllowLeadingPlus makes the Decoder accept numbers with a leading '+' (e.g. +5 or +1.2e3). The sign
+// is not included in the value returned by RawNumbers, UseNumber or the number converter.
+func (d *Decoder) AllowLeadingPlus() {
+	d.leadPlus = true
+}
+
+// AllowBoolAliases makes the Decoder accept yes and on as true, no and off as false.
+func (d *Decoder) AllowBoolAliases() {
+	d.boolAlias = true
+}
+
+// CaseInsensitiveKeywords makes the Decoder match true, false and null (and the aliases, see
+// AllowBoolAliases) regardless of case, e.g. True or NULL. Typed atoms such as int(...) remain
+// case-sensitive.
+func (d *Decoder) CaseInsensitiveKeywords() {
+	d.foldKwds = true
+}
+
+// AllowTrailingData makes Decode and its variants ignore any data following the top-level value rather
+// than returning ExtraDataError. The position is left right after the value, so the rest of the data
+// is available via Buffered.
+func (d *Decoder) AllowTrailingData() {
+	d.trailing = true
+}
+
+// SetMaxDepth limits the nesting depth of arrays and objects. Exceeding the limit results in an error
+// matching ErrMaxDepth. Zero (the default) means no limit.
+func (d *Decoder) SetMaxDepth(n int) {
+	d.maxDepth = n
+}
+
+// SetMaxStringLen limits the length of string literals, measured in bytes before unescaping. Exceeding
+// the limit results in an error matching ErrStringTooLong. Concatenated literals (see AllowStringConcat)
+// count together. Zero (the default) means no limit.
+func (d *Decoder) SetMaxStringLen(n int) {
+	d.maxStrLen = n
+}
+
+// SetMaxObjectKeys limits the number of distinct keys in each object. Exceeding the limit results in
+// an error matching ErrTooManyKeys. Zero (the default) means no limit.
+func (d *Decoder) SetMaxObjectKeys(n int) {
+	d.maxKeys = n
+}
+
+// Buffered returns the remaining data starting at the current position. After a Decode that returned
+// an ExtraDataError it contains the extra data.
+func (d *Decoder) Buffered() []byte {
+	d.load()
+	return d.data[d.pos:d.end]
+}
+
+// Offset returns the current position in the data.
+func (d *Decoder) Offset() int {
+	return d.pos
+}
+
+// PeekType returns the type of the next value without consuming it. Only the beginning of the value is
+// examined, so the value may still turn out to be malformed when it is decoded.
+func (d *Decoder) PeekType() (ValueType, error) {
+	pos := d.pos
+	defer func() { d.pos = pos }()
+
+	c, err := d.begin()
+	if err != nil {
+		return Unknown, err
+	}
+	switch c {
+	case '{':
+		return Object, nil
+	case '[':
+		return Array, nil
+	case '"':
+		return String, nil
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return Number, nil
+	case '+':
+		if d.leadPlus {
+			return Number, nil
+		}
+		return Unknown, d.error(c, "looking for beginning of value")
+	default:
+		start, err := d.scanAtom()
+		if err != nil {
+			return Unknown, err
+		}
+		atom := string(d.data[start:d.pos])
+		switch v, ok := d.keyword(atom); {
+		case !ok:
+			if d.strict || !isTypedAtom(d.data[start:d.pos]) || d.skipSpaces() != '(' {
+				d.pos = start
+				return Unknown, d.error(c, "looking for beginning of value")
+			}
+			return typedAtomType(atom), nil
+		case v == nil:
+			return Null, nil
+		default:
+			return Bool, nil
+		}
+	}
+}
+
+// keyword returns the value of the keyword atom (true, false, null and the aliases, see AllowBoolAliases),
+// ok is false if atom is not a keyword.
+func (d *Decoder) keyword(atom string) (v interface{}, ok bool) {
+	if d.foldKwds && len(atom) <= len("false") {
+		atom = strings.ToLower(atom)
+	}
+	switch atom {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	case "null":
+		return nil, true
+	}
+	if d.boolAlias {
+		switch atom {
+		case "yes", "on":
+			return true, true
+		case "no", "off":
+			return false, true
+		}
+	}
+	return nil, false
+}
+
+// typedAtomType returns the type of the values of the typed atom
+func typedAtomType(name string) ValueType {
+	switch name {
+	case "datetime":
+		return DateTime
+	case "duration":
+		return Duration
+	case "ip":
+		return IP
+	case "ipport":
+		return IPPort
+	case "cidr":
+		return CIDR
+	case "regexp":
+		return Regexp
+	case "bytes", "hex":
+		return Bytes
+	case "uint", "uint8", "uint16", "uint32", "uint64":
+		return Uint
+	}
+	return Int
+}
+
 // Decode parses the JSONX-encoded data and returns an interface value.
 // The interface value could be one of these:
 //
@@ -76,55 +427,314 @@ func (d *Decoder) AllocString() {
 //  net.IP for IP addresses (ip("1.2.3.4") or ip("fd00::1"))
 //  net.TCPAddr for ip/port pairs (ipport("1.2.3.4:5678") or ipport("[fd00::1]:5678")
 //  time.Time for timestamps (datetime("2006-01-02T15:04:05Z07:00"))
-//  []byte for base64-encoded bytes (bytes("YWJjZA=="))
+//  []byte for base64 or hex-encoded bytes (bytes("YWJjZA==") or hex("61626364"))
+//  *regexp.Regexp for regular expressions (regexp("^[a-z]+$"))
 //	[]interface{}, for arrays
 //	map[string]interface{}, for objects
 //	nil for null
 //
 // If any extra non-space characters found after decoding the top level value, the decoded value and the error
-// are returned allowing to implement non-greedy decoding.
+// are returned allowing to implement non-greedy decoding, unless AllowTrailingData is set.
 func (d *Decoder) Decode() (interface{}, error) {
-	d.skipSpaces()
+	if _, err := d.begin(); err != nil {
+		return nil, err
+	}
 	val, err := d.any()
 	if err != nil {
 		return nil, err
 	}
-	if d.skipSpaces(); d.pos < d.end {
-		return val, &ExtraDataError{d.pos}
+	if err = d.extraData(); err != nil {
+		return val, err
 	}
 	return val, nil
 }
 
 // DecodeObject is the same as Decode but it returns map[string]interface{}.
 func (d *Decoder) DecodeObject() (map[string]interface{}, error) {
-	if c := d.skipSpaces(); c != '{' {
+	if c, err := d.begin(); err != nil {
+		return nil, err
+	} else if c != '{' {
 		return nil, d.error(c, "looking for beginning of object")
 	}
 	val, err := d.object()
 	if err != nil {
 		return nil, err
 	}
-	if d.skipSpaces(); d.pos < d.end {
-		return val, &ExtraDataError{d.pos}
+	if err = d.extraData(); err != nil {
+		return val, err
 	}
 	return val, nil
 }
 
+// DecodeInto is the same as DecodeObject but it stores the keys in m rather than in a new map, which
+// allows reusing the same map for multiple objects. If merge is false m is cleared first, otherwise
+// the decoded keys are added to the existing ones, replacing the values of the same keys. Nested
+// objects and arrays are always newly allocated. The object key limit (see SetMaxObjectKeys) applies
+// to the resulting map.
+func (d *Decoder) DecodeInto(m map[string]interface{}, merge bool) error {
+	if m == nil {
+		return errors.New("nil map passed to DecodeInto")
+	}
+	if c, err := d.begin(); err != nil {
+		return err
+	} else if c != '{' {
+		return d.error(c, "looking for beginning of object")
+	}
+	if !merge {
+		for k := range m {
+			delete(m, k)
+		}
+	}
+	if err := d.objectInto(m); err != nil {
+		return err
+	}
+	return d.extraData()
+}
+
 // DecodeArray is the same as Decode but it returns []interface{}.
 func (d *Decoder) DecodeArray() ([]interface{}, error) {
-	if c := d.skipSpaces(); c != '[' {
+	if c, err := d.begin(); err != nil {
+		return nil, err
+	} else if c != '[' {
 		return nil, d.error(c, "looking for beginning of array")
 	}
 	val, err := d.array()
 	if err != nil {
 		return nil, err
 	}
-	if d.skipSpaces(); d.pos < d.end {
-		return val, &ExtraDataError{d.pos}
+	if err = d.extraData(); err != nil {
+		return val, err
 	}
 	return val, nil
 }
 
+// begin loads the data and skips the spaces (and comments, if allowed) before the top-level value.
+// It returns ErrEmptyInput if there is nothing else.
+func (d *Decoder) begin() (byte, error) {
+	if err := d.load(); err != nil {
+		return 0, err
+	}
+	c := d.skipSpaces()
+	if d.pos >= d.end {
+		return 0, d.eof(ErrEmptyInput)
+	}
+	return c, nil
+}
+
+// eof returns the error for reaching the end of the data where it is allowed, which is ErrUnexpectedEOF
+// if the data ends inside a comment
+func (d *Decoder) eof(err error) error {
+	if d.open {
+		return ErrUnexpectedEOF
+	}
+	return err
+}
+
+// DecodeBytesTo decodes the next value, which must be bytes(...), and writes the decoded bytes to w
+// as they are decoded rather than allocating a slice for them. It returns the number of bytes written.
+func (d *Decoder) DecodeBytesTo(w io.Writer) (int64, error) {
+	c, err := d.begin()
+	if err != nil {
+		return 0, err
+	}
+	pos := d.pos
+	if start, err := d.scanAtom(); d.strict || err != nil || string(d.data[start:d.pos]) != "bytes" {
+		d.pos = pos
+		return 0, d.error(c, "looking for bytes")
+	}
+	start, end, quoted, unquote, err := d.scanBracketExpr()
+	if err != nil {
+		return 0, err
+	}
+	src := d.data[start:end]
+	if quoted && unquote {
+		// base64 does not need escapes, so this is rare
+		str, err := d.argString(start, end, quoted, unquote)
+		if err != nil {
+			return 0, err
+		}
+		src = []byte(str)
+	}
+	n, err := io.Copy(w, base64.NewDecoder(base64.StdEncoding, bytes.NewReader(src)))
+	if err != nil {
+		return n, err
+	}
+	return n, d.extraData()
+}
+
+// EachArrayElement decodes a top-level array one element at a time calling fn for each element, so that
+// the elements do not have to be retained. Decoding stops at the first error, which is either a syntax
+// error or the error returned by fn. The elements decoded before a syntax error are passed to fn.
+func (d *Decoder) EachArrayElement(fn func(v interface{}) error) error {
+	if c, err := d.begin(); err != nil {
+		return err
+	} else if c != '[' {
+		return d.error(c, "looking for beginning of array")
+	}
+	if err := d.enter(); err != nil {
+		return err
+	}
+	// the '[' token already scanned
+	d.pos++
+	defer func() { d.depth-- }()
+
+	for first := true; ; first = false {
+		if c := d.skipSpaces(); c == ']' {
+			if d.strict && !first {
+				return d.error(c, "looking for beginning of value")
+			}
+			d.pos++
+			break
+		}
+		v, err := d.any()
+		if err != nil {
+			return err
+		}
+		if err = fn(v); err != nil {
+			return err
+		}
+
+		// next token must be ',' or ']'
+		if c := d.skipSpaces(); c == ',' {
+			d.pos++
+		} else if c == ']' {
+			d.pos++
+			break
+		} else {
+			return d.error(c, "after array element")
+		}
+	}
+	return d.extraData()
+}
+
+// errArrayLimit stops EachArrayElement in DecodeArrayLimit
+var errArrayLimit = errors.New("array limit reached")
+
+// DecodeArrayLimit decodes at most n elements of a top-level array. If the array has more than n
+// elements, the position is left at the ',' following the n-th one, so the rest of the array and anything
+// following it is available via Buffered. If the array has n elements or fewer, all of them are returned
+// and the array is consumed like Decode does, including the check for extra data. If n <= 0 there is no
+// limit.
+func (d *Decoder) DecodeArrayLimit(n int) ([]interface{}, error) {
+	a := make([]interface{}, 0)
+	err := d.EachArrayElement(func(v interface{}) error {
+		if a = append(a, v); len(a) == n {
+			return errArrayLimit
+		}
+		return nil
+	})
+	if err == errArrayLimit {
+		// the n-th element may be the last one, possibly followed by a trailing comma
+		c := d.skipSpaces()
+		pos := d.pos
+		if c == ',' && !d.strict {
+			d.pos++
+			c = d.skipSpaces()
+		}
+		if c != ']' {
+			d.pos = pos
+			return a, nil
+		}
+		d.pos++
+		err = d.extraData()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// DecodeFloatArray decodes a top-level array of numbers into []float64 without boxing the elements, which
+// saves an allocation per element compared to DecodeArray. An element that is not a number (including the
+// typed atoms, e.g. int(5)) results in a SyntaxError that includes its index. The number converter,
+// UseNumber and RawNumbers do not apply.
+func (d *Decoder) DecodeFloatArray() ([]float64, error) {
+	if c, err := d.begin(); err != nil {
+		return nil, err
+	} else if c != '[' {
+		return nil, d.error(c, "looking for beginning of array")
+	}
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	// the '[' token already scanned
+	d.pos++
+	defer func() { d.depth-- }()
+
+	a := make([]float64, 0)
+	for {
+		c := d.skipSpaces()
+		if c == ']' {
+			if d.strict && len(a) != 0 {
+				return nil, d.error(c, "looking for beginning of value")
+			}
+			d.pos++
+			break
+		}
+		f, err := d.float(len(a))
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, f)
+
+		// next token must be ',' or ']'
+		if c = d.skipSpaces(); c == ',' {
+			d.pos++
+		} else if c == ']' {
+			d.pos++
+			break
+		} else {
+			return nil, d.error(c, "after array element")
+		}
+	}
+	return a, d.extraData()
+}
+
+// float decodes the i-th element of the array in DecodeFloatArray
+func (d *Decoder) float(i int) (float64, error) {
+	if d.pos >= d.end {
+		return 0, ErrUnexpectedEOF
+	}
+	neg := false
+	switch c := d.data[d.pos]; {
+	case c == '+' && d.leadPlus:
+		if err := d.skipPlus(); err != nil {
+			return 0, err
+		}
+	case c == '-':
+		d.pos++
+		if d.pos >= d.end {
+			return 0, ErrUnexpectedEOF
+		}
+		if c = d.data[d.pos]; c < '0' || c > '9' {
+			return 0, d.error(c, "in negative numeric literal")
+		}
+		neg = true
+	case c < '0' || c > '9':
+		return 0, d.error(c, "looking for number in array element "+strconv.Itoa(i))
+	}
+	f, err := d.number()
+	if neg {
+		f = -f
+	}
+	return f, err
+}
+
+func (d *Decoder) extraDataError() error {
+	return &ExtraDataError{Offset: d.pos, Tail: d.data[d.pos:d.end]}
+}
+
+// extraData returns ExtraDataError if there is non-space data after the top-level value and it is not allowed
+func (d *Decoder) extraData() error {
+	if d.trailing {
+		return nil
+	}
+	if d.skipSpaces(); d.pos < d.end {
+		return d.extraDataError()
+	}
+	return d.eof(nil)
+}
+
 // any used to decode any valid JSONX value, and returns an
 // interface{} that holds the actual data
 func (d *Decoder) any() (interface{}, error) {
@@ -132,12 +742,29 @@ func (d *Decoder) any() (interface{}, error) {
 		return nil, d.error(0, "looking for beginning of value")
 	}
 
+	if d.data[d.pos] == '+' && d.leadPlus {
+		if err := d.skipPlus(); err != nil {
+			return nil, err
+		}
+		if d.numconv != nil || d.usenumber || d.rawnumber {
+			return d.numberLiteral(d.pos)
+		}
+		return d.number()
+	}
+
 	switch c := d.data[d.pos]; c {
 	case '"':
+		if d.concat {
+			return d.concatString()
+		}
 		return d.string()
 	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		if d.numconv != nil || d.usenumber || d.rawnumber {
+			return d.numberLiteral(d.pos)
+		}
 		return d.number()
 	case '-':
+		start := d.pos
 		d.pos++
 		if d.pos >= d.end {
 			return nil, ErrUnexpectedEOF
@@ -145,37 +772,55 @@ func (d *Decoder) any() (interface{}, error) {
 		if c = d.data[d.pos]; c < '0' && c > '9' {
 			return nil, d.error(c, "in negative numeric literal")
 		}
+		if d.numconv != nil || d.usenumber || d.rawnumber {
+			return d.numberLiteral(start)
+		}
 		n, err := d.number()
 		if err != nil {
 			return nil, err
 		}
 		return -n, nil
 	case '[':
-		return d.array()
+		a, err := d.array()
+		if len(a) == 0 && err == nil {
+			return emptyArrayValue, nil
+		}
+		return a, err
 	case '{':
+		if d.ordered {
+			return d.orderedObject()
+		}
 		return d.object()
 	default:
 		atom, err := d.atom()
 		if err != nil {
 			return nil, err
 		}
+		if v, ok := d.keyword(atom); ok {
+			return v, nil
+		}
+		if d.strict {
+			return nil, d.error(c, "looking for beginning of value")
+		}
 		switch atom {
-		case "true":
-			return true, nil
-		case "false":
-			return false, nil
-		case "null":
-			return nil, nil
 		case "int":
 			return d.int()
 		case "datetime":
 			return d.datetime()
+		case "duration":
+			return d.duration()
 		case "ip":
 			return d.ip()
 		case "ipport":
 			return d.ipport()
+		case "cidr":
+			return d.cidr()
+		case "regexp":
+			return d.regexp()
 		case "bytes":
 			return d.bytes()
+		case "hex":
+			return d.hex()
 		case "int8":
 			return d.int8()
 		case "int16":
@@ -200,20 +845,76 @@ func (d *Decoder) any() (interface{}, error) {
 }
 
 func (d *Decoder) datetime() (time.Time, error) {
-	str, err := d.bracketExpr()
+	start, end, quoted, unquote, err := d.scanBracketExpr()
 	if err != nil {
 		return time.Time{}, err
 	}
+	str, err := d.argString(start, end, quoted, unquote)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !quoted && isInteger(str) {
+		return d.epochTime(str)
+	}
 	return time.Parse(time.RFC3339, str)
 }
 
+// epochTime converts the Unix timestamp in the configured unit to time.Time (in UTC)
+func (d *Decoder) epochTime(str string) (time.Time, error) {
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return time.Time{}, d.intError("datetime", str, err)
+	}
+	return d.unixTime(n), nil
+}
+
+// unixTime converts the Unix timestamp in the configured unit to time.Time (in UTC)
+func (d *Decoder) unixTime(n int64) time.Time {
+	var perSecond int64
+	switch d.epochUnit {
+	case Millis:
+		perSecond = 1e3
+	case Micros:
+		perSecond = 1e6
+	case Nanos:
+		perSecond = 1e9
+	default:
+		perSecond = 1
+	}
+	return time.Unix(n/perSecond, n%perSecond*(1e9/perSecond)).UTC()
+}
+
+// isInteger returns true if s is an optionally negative sequence of decimal digits
+func isInteger(s string) bool {
+	if len(s) > 0 && s[0] == '-' {
+		s = s[1:]
+	}
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Decoder) duration() (time.Duration, error) {
+	str, err := d.bracketExpr()
+	if err != nil {
+		return 0, err
+	}
+	return time.ParseDuration(str)
+}
+
 func (d *Decoder) ip() (net.IP, error) {
 	str, err := d.bracketExpr()
 	if err != nil {
 		return nil, err
 	}
 
-	ip := net.ParseIP(str)
+	ip := d.parseIP(str)
 	if ip == nil {
 		return nil, d.error(' ', "invalid ip")
 	}
@@ -222,44 +923,50 @@ func (d *Decoder) ip() (net.IP, error) {
 }
 
 func (d *Decoder) ipport() (net.TCPAddr, error) {
-	str, err := d.bracketExpr()
+	str, start, err := d.bracketArg()
 	if err != nil {
 		return net.TCPAddr{}, err
 	}
+	// errAt returns an error pointing at str[i]. If the argument is a string literal containing escapes
+	// the position is approximate.
+	errAt := func(msg string, i int) error {
+		return &SyntaxError{msg, start + i + 1}
+	}
 
 	if len(str) > 0 {
 		var ipstr, portstr string
-		var pos int
+		var pos, ippos int
 		if str[0] == '[' { // [ipv6]:port
+			ippos = 1
 			pos = strings.IndexByte(str[1:], ']')
 			if pos == -1 {
-				return net.TCPAddr{}, &SyntaxError{"invalid ipv6, missing ]", d.pos + 1}
+				return net.TCPAddr{}, errAt("invalid ipv6, missing ]", len(str))
 			}
 			pos++
 			ipstr = str[1:pos]
 			pos++
 			if pos >= len(str) || str[pos] != ':' {
-				return net.TCPAddr{}, &SyntaxError{"missing : after ipv6", d.pos + 1}
+				return net.TCPAddr{}, errAt("missing : after ipv6", pos)
 			}
 		} else { // ipv4:port
 			pos = strings.IndexByte(str, ':')
 			if pos == -1 {
-				return net.TCPAddr{}, &SyntaxError{"missing : after ipv4", d.pos + 1}
+				return net.TCPAddr{}, errAt("missing : after ipv4", len(str))
 			}
 			ipstr = str[:pos]
 		}
 		pos++
 		if pos >= len(str) {
-			return net.TCPAddr{}, &SyntaxError{"missing port after :", d.pos + 1}
+			return net.TCPAddr{}, errAt("missing port after :", pos)
 		}
 		portstr = str[pos:]
-		ip := net.ParseIP(ipstr)
+		ip := d.parseIP(ipstr)
 		if ip == nil {
-			return net.TCPAddr{}, &SyntaxError{"malformed IP: " + ipstr, d.pos + 1}
+			return net.TCPAddr{}, errAt("malformed IP: "+ipstr, ippos)
 		}
 		port, err := strconv.Atoi(portstr)
 		if err != nil {
-			return net.TCPAddr{}, &SyntaxError{"malformed port: " + portstr, d.pos + 1}
+			return net.TCPAddr{}, errAt("malformed port: "+portstr, pos)
 		}
 		return net.TCPAddr{IP: ip, Port: port}, nil
 	}
@@ -267,6 +974,85 @@ func (d *Decoder) ipport() (net.TCPAddr, error) {
 	return net.TCPAddr{}, d.error(' ', "invalid ipport")
 }
 
+func (d *Decoder) cidr() (*net.IPNet, error) {
+	str, err := d.bracketExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	if slash := strings.IndexByte(str, '/'); slash != -1 {
+		str = normalizeIPv4(str[:slash]) + str[slash:]
+	}
+	_, ipnet, err := net.ParseCIDR(str)
+	if err != nil {
+		return nil, d.error(' ', "invalid cidr")
+	}
+
+	return ipnet, nil
+}
+
+func (d *Decoder) regexp() (*regexp.Regexp, error) {
+	str, start, err := d.bracketArg()
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile(str)
+	if err != nil {
+		return nil, &SyntaxError{"invalid regexp: " + err.Error(), start + 1}
+	}
+
+	return re, nil
+}
+
+// parseIP parses the textual representation of an IP address, see PreserveIPv4Mapped. Zero-padded IPv4
+// octets are accepted, see normalizeIPv4.
+func (d *Decoder) parseIP(s string) net.IP {
+	ip := net.ParseIP(normalizeIPv4(s))
+	if ip != nil && d.ipv4Map && strings.IndexByte(s, ':') == -1 {
+		ip = ip.To4()
+	}
+	return ip
+}
+
+// normalizeIPv4 strips the leading zeros from the octets of a dotted IPv4 address, e.g. 192.168.100.001
+// becomes 192.168.100.1. The octets are always decimal (010 is 10, not 8) and may have up to 3 digits.
+// net.ParseIP rejects such addresses since Go 1.17, this keeps them working regardless of the Go version.
+// Any other string is returned unchanged.
+func normalizeIPv4(s string) string {
+	var buf [len("255.255.255.255")]byte
+	b := buf[:0]
+	padded := false
+	rest := s
+	for octet := 0; octet < 4; octet++ {
+		if octet > 0 {
+			if len(rest) == 0 || rest[0] != '.' {
+				return s
+			}
+			rest = rest[1:]
+			b = append(b, '.')
+		}
+		n := 0
+		for n < len(rest) && n < 4 && rest[n] >= '0' && rest[n] <= '9' {
+			n++
+		}
+		if n == 0 || n > 3 {
+			return s
+		}
+		digits := rest[:n]
+		for len(digits) > 1 && digits[0] == '0' {
+			digits = digits[1:]
+			padded = true
+		}
+		b = append(b, digits...)
+		rest = rest[n:]
+	}
+	if len(rest) != 0 || !padded {
+		return s
+	}
+	return string(b)
+}
+
 func (d *Decoder) bytes() ([]byte, error) {
 	str, err := d.bracketExpr()
 	if err != nil {
@@ -275,6 +1061,26 @@ func (d *Decoder) bytes() ([]byte, error) {
 	return base64.StdEncoding.DecodeString(str)
 }
 
+func (d *Decoder) hex() ([]byte, error) {
+	str, start, err := d.bracketArg()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(str); i++ {
+		if !isHexDigit(str[i]) {
+			return nil, &SyntaxError{"invalid character " + quoteChar(str[i]) + " in hex bytes", start + i + 1}
+		}
+	}
+	if len(str)%2 != 0 {
+		return nil, &SyntaxError{"odd length hex bytes", start + len(str)}
+	}
+	return hex.DecodeString(str)
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
 func (d *Decoder) uint() (uint, error) {
 	intStr, err := d.bracketExpr()
 	if err != nil {
@@ -283,7 +1089,7 @@ func (d *Decoder) uint() (uint, error) {
 
 	n, err := strconv.ParseUint(intStr, 10, 64)
 	if err != nil {
-		return 0, &SyntaxError{err.Error(), d.pos}
+		return 0, d.intError("uint", intStr, err)
 	}
 
 	return uint(n), nil
@@ -297,7 +1103,7 @@ func (d *Decoder) uint8() (uint8, error) {
 
 	n, err := strconv.ParseUint(intStr, 10, 8)
 	if err != nil {
-		return 0, &SyntaxError{err.Error(), d.pos}
+		return 0, d.intError("uint8", intStr, err)
 	}
 
 	return uint8(n), nil
@@ -311,7 +1117,7 @@ func (d *Decoder) uint16() (uint16, error) {
 
 	n, err := strconv.ParseUint(intStr, 10, 16)
 	if err != nil {
-		return 0, &SyntaxError{err.Error(), d.pos}
+		return 0, d.intError("uint16", intStr, err)
 	}
 
 	return uint16(n), nil
@@ -325,7 +1131,7 @@ func (d *Decoder) uint32() (uint32, error) {
 
 	n, err := strconv.ParseUint(intStr, 10, 32)
 	if err != nil {
-		return 0, &SyntaxError{err.Error(), d.pos}
+		return 0, d.intError("uint32", intStr, err)
 	}
 
 	return uint32(n), nil
@@ -339,7 +1145,7 @@ func (d *Decoder) uint64() (uint64, error) {
 
 	n, err := strconv.ParseUint(intStr, 10, 64)
 	if err != nil {
-		return 0, &SyntaxError{err.Error(), d.pos}
+		return 0, d.intError("uint64", intStr, err)
 	}
 
 	return n, nil
@@ -353,7 +1159,7 @@ func (d *Decoder) int() (int, error) {
 
 	num, err := strconv.Atoi(intStr)
 	if err != nil {
-		return 0, &SyntaxError{err.Error(), d.pos}
+		return 0, d.intError("int", intStr, err)
 	}
 
 	return num, nil
@@ -367,7 +1173,7 @@ func (d *Decoder) int8() (int8, error) {
 
 	n, err := strconv.ParseInt(intStr, 10, 8)
 	if err != nil {
-		return 0, &SyntaxError{err.Error(), d.pos}
+		return 0, d.intError("int8", intStr, err)
 	}
 
 	return int8(n), nil
@@ -381,7 +1187,7 @@ func (d *Decoder) int16() (int16, error) {
 
 	n, err := strconv.ParseInt(intStr, 10, 16)
 	if err != nil {
-		return 0, &SyntaxError{err.Error(), d.pos}
+		return 0, d.intError("int16", intStr, err)
 	}
 
 	return int16(n), nil
@@ -395,7 +1201,7 @@ func (d *Decoder) int32() (int32, error) {
 
 	n, err := strconv.ParseInt(intStr, 10, 32)
 	if err != nil {
-		return 0, &SyntaxError{err.Error(), d.pos}
+		return 0, d.intError("int32", intStr, err)
 	}
 
 	return int32(n), nil
@@ -409,24 +1215,157 @@ func (d *Decoder) int64() (int64, error) {
 
 	n, err := strconv.ParseInt(intStr, 10, 64)
 	if err != nil {
-		return 0, &SyntaxError{err.Error(), d.pos}
+		return 0, d.intError("int64", intStr, err)
 	}
 
 	return n, nil
 }
 
+// intError converts an error returned by strconv when parsing an integer atom
+func (d *Decoder) intError(typ, value string, err error) error {
+	if isNonFinite(value) {
+		return &SyntaxError{"invalid " + typ + " value " + value + ": integers cannot be NaN or Infinity", d.pos}
+	}
+	if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+		return &IntRangeError{Type: typ, Value: value, Offset: d.pos}
+	}
+	return &SyntaxError{err.Error(), d.pos}
+}
+
+// isNonFinite returns true if s is one of the textual forms of NaN or infinity accepted by strconv.ParseFloat,
+// e.g. Infinity, -Inf or NaN
+func isNonFinite(s string) bool {
+	if len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+	return strings.EqualFold(s, "infinity") || strings.EqualFold(s, "inf") || strings.EqualFold(s, "nan")
+}
+
 func (d *Decoder) objectKey() (string, error) {
 	if d.pos >= d.end {
 		return "", ErrUnexpectedEOF
 	}
+	if d.strict && d.data[d.pos] != '"' {
+		return "", d.error(d.data[d.pos], "looking for beginning of object key string")
+	}
+	if d.keys != nil {
+		return d.internedKey()
+	}
 	if c := d.data[d.pos]; c == '"' {
 		return d.string()
 	} else {
-		return d.atom()
+		return d.keyAtom()
 	}
 }
 
+func (d *Decoder) internedKey() (string, error) {
+	var start, end int
+	if d.data[d.pos] == '"' {
+		var (
+			unquote bool
+			err     error
+		)
+		if start, end, unquote, err = d.scanString(); err != nil {
+			return "", err
+		}
+		if unquote {
+			s, err := d.stringValue(start, end, true)
+			if err != nil {
+				return "", err
+			}
+			if key, exists := d.keys[s]; exists {
+				return key, nil
+			}
+			if len(d.keys) < maxInternedKeys {
+				d.keys[s] = s
+			}
+			return s, nil
+		}
+	} else {
+		var err error
+		if start, err = d.scanKeyAtom(); err != nil {
+			return "", err
+		}
+		end = d.pos
+	}
+
+	// the conversion in the map index expression does not allocate
+	if key, exists := d.keys[string(d.data[start:end])]; exists {
+		return key, nil
+	}
+	var key string
+	if d.usestring {
+		key = d.sdata[start:end]
+	} else {
+		key = string(d.data[start:end])
+	}
+	if len(d.keys) < maxInternedKeys {
+		d.keys[key] = key
+	}
+	return key, nil
+}
+
 func (d *Decoder) atom() (string, error) {
+	start, err := d.scanAtom()
+	if err != nil {
+		return "", err
+	}
+	if d.usestring {
+		return d.sdata[start:d.pos], nil
+	}
+
+	return string(d.data[start:d.pos]), nil
+}
+
+// keyAtom reads an unquoted object key
+func (d *Decoder) keyAtom() (string, error) {
+	start, err := d.scanKeyAtom()
+	if err != nil {
+		return "", err
+	}
+	if d.usestring {
+		return d.sdata[start:d.pos], nil
+	}
+
+	return string(d.data[start:d.pos]), nil
+}
+
+// scanKeyAtom advances past the unquoted object key at the current position and returns its start
+func (d *Decoder) scanKeyAtom() (start int, err error) {
+	start = d.pos
+	if !d.extkeys {
+		if c := d.data[d.pos]; c >= '0' && c <= '9' || c == '-' || c == '+' {
+			return 0, d.error(c, "looking for object key (numeric keys must be quoted)")
+		}
+		if start, err = d.scanAtom(); err != nil {
+			return 0, err
+		}
+	} else {
+		for d.pos < d.end && isExtendedKeyChar(d.data[d.pos]) {
+			d.pos++
+		}
+		if d.pos == start {
+			var c byte
+			if d.pos < d.end {
+				c = d.data[d.pos]
+			}
+			return 0, d.error(c, "looking for atom")
+		}
+	}
+	end := d.pos
+	if d.skipSpaces() == '(' {
+		return 0, &SyntaxError{"invalid object key " + string(d.data[start:end]) + "(...): keys must be strings or identifiers", start + 1}
+	}
+	d.pos = end
+	return start, nil
+}
+
+func isExtendedKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.'
+}
+
+// scanAtom advances past the identifier at the current position and returns its start
+func (d *Decoder) scanAtom() (int, error) {
 	var c byte
 	start := d.pos
 	if d.pos < d.end {
@@ -439,97 +1378,217 @@ func (d *Decoder) atom() (string, error) {
 					break
 				}
 			}
-			if d.usestring {
-				return d.sdata[start:d.pos], nil
-			}
-
-			return string(d.data[start:d.pos]), nil
+			return start, nil
 		}
 	}
 
-	return "", d.error(c, "looking for atom")
+	return 0, d.error(c, "looking for atom")
 }
 
 func (d *Decoder) bracketExpr() (string, error) {
+	str, _, err := d.bracketArg()
+	return str, err
+}
+
+// bracketArg is the same as bracketExpr but it also returns the position of the argument in the data
+func (d *Decoder) bracketArg() (string, int, error) {
+	start, end, quoted, unquote, err := d.scanBracketExpr()
+	if err != nil {
+		return "", 0, err
+	}
+	str, err := d.argString(start, end, quoted, unquote)
+	return str, start, err
+}
+
+// argString returns the value of the typed atom argument located at data[start:end]
+func (d *Decoder) argString(start, end int, quoted, unquote bool) (string, error) {
+	if quoted {
+		return d.stringValue(start, end, unquote)
+	}
+	if d.usestring {
+		return d.sdata[start:end], nil
+	}
+	return string(d.data[start:end]), nil
+}
+
+// scanBracketExpr advances past the parenthesised argument of a typed atom. It returns the boundaries
+// of the argument (the content of the string literal if the argument is quoted), whether it is quoted and
+// whether it needs unquoting.
+func (d *Decoder) scanBracketExpr() (start, end int, quoted, unquote bool, err error) {
 	if c := d.skipSpaces(); c != '(' {
-		return "", d.error(c, "looking for (")
+		return 0, 0, false, false, d.error(c, "looking for (")
 	}
 
 	d.pos++
 	c := d.skipSpaces()
-	start := d.pos
+	start = d.pos
 	if c == '"' {
-		s, err := d.string()
+		start, end, unquote, err = d.scanString()
 		if err != nil {
-			return "", err
+			return 0, 0, false, false, err
 		}
 		if c := d.skipSpaces(); c != ')' {
-			return "", d.error(c, "looking for )")
+			return 0, 0, false, false, d.error(c, "looking for )")
 		}
 		d.pos++
-		return s, nil
-	} else {
-		for d.pos < d.end {
-			if d.data[d.pos] == ')' {
-				var ret string
-				if d.usestring {
-					ret = d.sdata[start:d.pos]
-				} else {
-					ret = string(d.data[start:d.pos])
-				}
-				d.pos++
-				return ret, nil
-			}
-			d.pos++
+		return start, end, true, unquote, nil
+	}
+	if end, err = d.scanRawArg(); err != nil {
+		return 0, 0, false, false, err
+	}
+	d.pos++
+	return start, end, false, false, nil
+}
+
+func (d *Decoder) stringTooLong(start int) error {
+	return &SyntaxError{ErrStringTooLong.msg, start}
+}
+
+// scanRawString advances past the raw string ("""...""") at the current position
+func (d *Decoder) scanRawString() (start, end int, unquote bool, err error) {
+	d.pos += 3
+	start = d.pos
+	for ; d.pos+2 < d.end; d.pos++ {
+		if d.data[d.pos] == '"' && d.data[d.pos+1] == '"' && d.data[d.pos+2] == '"' {
+			end = d.pos
+			d.pos += 3
+			return start, end, false, nil
+		}
+		if d.maxStrLen > 0 && d.pos-start >= d.maxStrLen {
+			return 0, 0, false, d.stringTooLong(start)
 		}
 	}
+	d.pos = d.end
+	return 0, 0, false, ErrUnexpectedEOF
+}
 
-	return "", d.error(' ', "looking for )")
+// scanRawArg advances to the ')' that terminates an unquoted typed atom argument and returns its position
+func (d *Decoder) scanRawArg() (int, error) {
+	for d.pos < d.end {
+		if d.data[d.pos] == ')' {
+			return d.pos, nil
+		}
+		d.pos++
+	}
+
+	return 0, d.error(' ', "looking for )")
 }
 
 // string called by `any` or `object`(for map keys) after reading `"`
 func (d *Decoder) string() (string, error) {
-	d.pos++
+	start, end, unquote, err := d.scanString()
+	if err != nil {
+		return "", err
+	}
+	return d.stringValue(start, end, unquote)
+}
 
+// concatString reads a string literal followed by any number of whitespace-separated string literals
+// and returns their concatenation. The length limit applies to the total length of the literals.
+func (d *Decoder) concatString() (string, error) {
 	var (
-		unquote bool
-		start   = d.pos
+		pieces []string
+		n      int
 	)
+	for {
+		start, end, unquote, err := d.scanString()
+		if err != nil {
+			return "", err
+		}
+		if n += end - start; d.maxStrLen > 0 && n > d.maxStrLen {
+			return "", d.stringTooLong(start)
+		}
+		s, err := d.stringValue(start, end, unquote)
+		if err != nil {
+			return "", err
+		}
+		pieces = append(pieces, s)
+
+		pos := d.pos
+		if d.skipSpaces() != '"' {
+			d.pos = pos
+			break
+		}
+	}
+	if len(pieces) == 1 {
+		return pieces[0], nil
+	}
+	return strings.Join(pieces, ""), nil
+}
+
+// stringValue returns the string for the content of a string literal located at data[start:end]
+func (d *Decoder) stringValue(start, end int, unquote bool) (string, error) {
+	if d.badUTF8 == RejectInvalidUTF8 && (unquote || d.rawstr) {
+		if i := invalidUTF8(d.data[start:end], unquote); i != -1 {
+			return "", &InvalidUTF8Error{start + i}
+		}
+	}
+	if unquote {
+		// stack-allocated array for allocation-free unescaping of small strings
+		// if a string longer than this needs to be escaped, it will result in a
+		// heap allocation; idea comes from github.com/burger/jsonparser
+		var stackbuf [64]byte
+		if end-start > len(stackbuf) {
+			return d.longStringValue(start, end)
+		}
+		data, ok := unquoteBytes(d.data[start:end], stackbuf[:], d.badUTF8 == DropInvalidUTF8)
+		if !ok {
+			return "", ErrStringEscape
+		}
+		return string(data), nil
+	}
+	if d.badUTF8 == DropInvalidUTF8 && d.rawstr && !utf8.Valid(d.data[start:end]) {
+		return strings.ToValidUTF8(string(d.data[start:end]), ""), nil
+	}
+	if d.usestring {
+		return d.sdata[start:end], nil
+	}
+	return string(d.data[start:end]), nil
+}
+
+// longStringValue is stringValue for literals that need unquoting and do not fit into the stack buffer.
+// The unescaped content is written directly into the resulting string, which is allocated with the exact size.
+func (d *Decoder) longStringValue(start, end int) (string, error) {
+	s := d.data[start:end]
+	drop := d.badUTF8 == DropInvalidUTF8
+	n, escaped := unquotedLen(s, drop)
+	if n < 0 {
+		return "", ErrStringEscape
+	}
+	if !escaped {
+		return string(s), nil
+	}
+	return unquoteString(s, n, drop), nil
+}
+
+// scanString advances past the string literal at the current position. It returns the boundaries
+// of the literal's content and whether it needs unquoting (i.e. contains escapes or non-ASCII characters).
+func (d *Decoder) scanString() (start, end int, unquote bool, err error) {
+	if d.rawstr && d.pos+2 < d.end && d.data[d.pos+1] == '"' && d.data[d.pos+2] == '"' {
+		return d.scanRawString()
+	}
+	d.pos++
+	start = d.pos
 
 scan:
 	for {
 		if d.pos >= d.end {
-			return "", ErrUnexpectedEOF
+			return 0, 0, false, ErrUnexpectedEOF
 		}
 
 		c := d.data[d.pos]
+		if c != '"' && d.maxStrLen > 0 && d.pos-start >= d.maxStrLen {
+			return 0, 0, false, d.stringTooLong(start)
+		}
 		switch {
 		case c == '"':
-			var s string
-			if unquote {
-				// stack-allocated array for allocation-free unescaping of small strings
-				// if a string longer than this needs to be escaped, it will result in a
-				// heap allocation; idea comes from github.com/burger/jsonparser
-				var stackbuf [64]byte
-				data, ok := unquoteBytes(d.data[start:d.pos], stackbuf[:])
-				if !ok {
-					return "", ErrStringEscape
-				}
-				s = string(data)
-			} else {
-				if d.usestring {
-					s = d.sdata[start:d.pos]
-				} else {
-
-					s = string(d.data[start:d.pos])
-				}
-			}
+			end = d.pos
 			d.pos++
-			return s, nil
+			return start, end, unquote, nil
 		case c == '\\':
 			d.pos++
 			if d.pos >= d.end {
-				return "", ErrUnexpectedEOF
+				return 0, 0, false, ErrUnexpectedEOF
 			}
 			unquote = true
 			switch c := d.data[d.pos]; c {
@@ -538,10 +1597,10 @@ scan:
 			case 'b', 'f', 'n', 'r', 't', '\\', '/', '"':
 				d.pos++
 			default:
-				return "", d.error(c, "in string escape code")
+				return 0, 0, false, d.error(c, "in string escape code")
 			}
 		case c < 0x20:
-			return "", d.error(c, "in string literal")
+			return 0, 0, false, d.error(c, "in string literal")
 		default:
 			d.pos++
 			if c > unicode.MaxASCII {
@@ -559,9 +1618,9 @@ escape_u:
 				d.pos++
 				continue
 			}
-			return "", d.error(c, "in \\u hexadecimal character escape")
+			return 0, 0, false, d.error(c, "in \\u hexadecimal character escape")
 		}
-		return "", ErrInvalidHexEscape
+		return 0, 0, false, ErrInvalidHexEscape
 	}
 	goto scan
 }
@@ -569,20 +1628,26 @@ escape_u:
 // number called by `any` after reading number between 0 to 9
 func (d *Decoder) number() (float64, error) {
 	var (
-		n       float64
-		isFloat bool
-		c       = d.data[d.pos]
-		start   = d.pos
+		n          float64
+		parseFloat bool
+		c          = d.data[d.pos]
+		start      = d.pos
 	)
 
 	// digits first
 	switch {
 	case c == '0':
-		c = d.next()
+		// a digit after the leading zero begins the next token, i.e. 012 is 0 followed by 12 which makes
+		// the input invalid anyway, but strict mode rejects it right here
+		if c = d.next(); d.strict && '0' <= c && c <= '9' {
+			return 0, d.error(c, "after leading zero in numeric literal")
+		}
 	case '1' <= c && c <= '9':
 		for ; c >= '0' && c <= '9'; c = d.next() {
 			n = 10*n + float64(c-'0')
 		}
+		// beyond 15 digits the result may be inexact or overflow, which strconv.ParseFloat handles
+		parseFloat = d.pos-start > 15
 	}
 
 	// . followed by 1 or more digits
@@ -591,7 +1656,7 @@ func (d *Decoder) number() (float64, error) {
 		if d.pos >= d.end {
 			return 0, ErrUnexpectedEOF
 		}
-		isFloat = true
+		parseFloat = true
 		if c = d.data[d.pos]; c < '0' && c > '9' {
 			return 0, d.error(c, "after decimal point in numeric literal")
 		}
@@ -603,7 +1668,7 @@ func (d *Decoder) number() (float64, error) {
 	// e or E followed by an optional - or + and
 	// 1 or more digits.
 	if c == 'e' || c == 'E' {
-		isFloat = true
+		parseFloat = true
 		if c = d.next(); c == '+' || c == '-' {
 			if c = d.next(); c < '0' || c > '9' {
 				return 0, d.error(c, "in exponent of numeric literal")
@@ -614,7 +1679,7 @@ func (d *Decoder) number() (float64, error) {
 		}
 	}
 
-	if isFloat {
+	if parseFloat {
 		var (
 			err error
 			sn  string
@@ -631,8 +1696,49 @@ func (d *Decoder) number() (float64, error) {
 	return n, nil
 }
 
+// skipPlus advances past the leading '+' of a number
+func (d *Decoder) skipPlus() error {
+	d.pos++
+	if d.pos >= d.end {
+		return ErrUnexpectedEOF
+	}
+	if c := d.data[d.pos]; c < '0' || c > '9' {
+		return d.error(c, "in numeric literal")
+	}
+	return nil
+}
+
+// numberLiteral scans the numeric literal that begins at start and returns it converted by the number
+// converter or as RawNumber or json.Number
+func (d *Decoder) numberLiteral(start int) (interface{}, error) {
+	if _, err := d.number(); err != nil {
+		return nil, err
+	}
+	if d.numconv != nil {
+		return d.numconv(d.data[start:d.pos])
+	}
+	var s string
+	if d.usestring {
+		s = d.sdata[start:d.pos]
+	} else {
+		s = string(d.data[start:d.pos])
+	}
+	if d.rawnumber {
+		return RawNumber(s), nil
+	}
+	return json.Number(s), nil
+}
+
 // array accept valid JSON array value
 func (d *Decoder) array() ([]interface{}, error) {
+	if d.iterative {
+		v, err := d.nested(nil)
+		a, _ := v.([]interface{})
+		return a, err
+	}
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
 	// the '[' token already scanned
 	d.pos++
 
@@ -640,11 +1746,15 @@ func (d *Decoder) array() ([]interface{}, error) {
 		c     byte
 		v     interface{}
 		err   error
-		array = make([]interface{}, 0)
+		array []interface{}
 	)
 
 scan:
 	if c = d.skipSpaces(); c == ']' {
+		if d.strict && array != nil {
+			err = d.error(c, "looking for beginning of value")
+			goto out
+		}
 		d.pos++
 		goto out
 	}
@@ -665,11 +1775,38 @@ scan:
 	}
 
 out:
+	d.depth--
+	if array == nil {
+		array = emptyArray
+	}
 	return array, err
 }
 
 // object accept valid JSON array value
+//
+// Unlike arrays, empty objects cannot share a value: a map is mutated in place and assigning to a nil
+// map panics, so every object, including {}, gets its own map. make without a size hint only allocates
+// the map header, the storage for the entries is allocated on the first insert.
 func (d *Decoder) object() (map[string]interface{}, error) {
+	obj := make(map[string]interface{})
+	return obj, d.objectInto(obj)
+}
+
+// objectInto reads the object's keys and values into obj
+func (d *Decoder) objectInto(obj map[string]interface{}) error {
+	return d.objectKeys(obj, nil)
+}
+
+// objectKeys is the same as objectInto but if keys is not nil it also appends the new keys to it in order.
+// It must not be called with keys in the iterative mode.
+func (d *Decoder) objectKeys(obj map[string]interface{}, keys *[]string) error {
+	if d.iterative {
+		_, err := d.nested(obj)
+		return err
+	}
+	if err := d.enter(); err != nil {
+		return err
+	}
 	// the '{' token already scanned
 	d.pos++
 
@@ -678,19 +1815,30 @@ func (d *Decoder) object() (map[string]interface{}, error) {
 		k   string
 		v   interface{}
 		err error
-		obj = make(map[string]interface{})
+		n   int
 	)
 
 	for {
 		if c = d.skipSpaces(); c == '}' {
+			if d.strict && n != 0 {
+				err = d.error(c, "looking for beginning of object key string")
+				break
+			}
 			d.pos++
-			return obj, nil
+			break
 		}
 
 		// read key
+		keyPos := d.pos
 		if k, err = d.objectKey(); err != nil {
 			break
 		}
+		if d.maxKeys > 0 && len(obj) >= d.maxKeys {
+			if _, exists := obj[k]; !exists {
+				err = &SyntaxError{ErrTooManyKeys.msg, keyPos + 1}
+				break
+			}
+		}
 
 		// read colon before value
 		c = d.skipSpaces()
@@ -706,7 +1854,13 @@ func (d *Decoder) object() (map[string]interface{}, error) {
 			break
 		}
 
+		if keys != nil {
+			if _, exists := obj[k]; !exists {
+				*keys = append(*keys, k)
+			}
+		}
 		obj[k] = v
+		n++
 
 		// next token must be ',' or '}'
 		if c = d.skipSpaces(); c == '}' {
@@ -720,7 +1874,17 @@ func (d *Decoder) object() (map[string]interface{}, error) {
 		}
 	}
 
-	return obj, err
+	d.depth--
+	return err
+}
+
+// enter is called at the beginning of an array or an object to enforce the maximum depth
+func (d *Decoder) enter() error {
+	if d.maxDepth > 0 && d.depth >= d.maxDepth {
+		return &SyntaxError{ErrMaxDepth.msg, d.pos + 1}
+	}
+	d.depth++
+	return nil
 }
 
 // next return the next byte in the input
@@ -744,11 +1908,49 @@ loop:
 	case ' ', '\t', '\n', '\r':
 		d.pos++
 		goto loop
+	case '/':
+		if d.comments && d.skipComment() {
+			goto loop
+		}
+		return c
 	default:
 		return c
 	}
 }
 
+// skipComment advances past the comment at the current position and returns true, or returns false
+// if there is no comment. An unterminated block comment extends to the end of the data and sets open,
+// the end of the data is then unexpected (see eof).
+func (d *Decoder) skipComment() bool {
+	if d.pos+1 >= d.end {
+		return false
+	}
+	switch d.data[d.pos+1] {
+	case '/':
+		d.pos += 2
+		for d.pos < d.end && d.data[d.pos] != '\n' {
+			d.pos++
+		}
+	case '*':
+		d.pos += 2
+		for {
+			if d.pos+1 >= d.end {
+				d.pos = d.end
+				d.open = true
+				break
+			}
+			if d.data[d.pos] == '*' && d.data[d.pos+1] == '/' {
+				d.pos += 2
+				break
+			}
+			d.pos++
+		}
+	default:
+		return false
+	}
+	return true
+}
+
 /*
 for ;d.pos < d.end; d.pos++ {
 		switch c := d.data[d.pos]; c {
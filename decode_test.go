@@ -1,13 +1,18 @@
 package jsonx
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
 	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -83,7 +88,7 @@ var decodeTests = []decodeTest{
 	{in: `[,]`, err: &SyntaxError{"invalid character ',' looking for atom", 2}},
 
 	// int range error
-	{in: `int8(-500)`, err: &SyntaxError{"strconv.ParseInt: parsing \"-500\": value out of range", 10}},
+	{in: `int8(-500)`, err: &IntRangeError{"int8", "-500", 10}},
 
 	// raw values with whitespace
 	{in: "\n true ", expected: true},
@@ -108,13 +113,13 @@ var decodeTests = []decodeTest{
 
 	// raw value errors
 	{in: "\x01 42", err: &SyntaxError{"invalid character '\\x01' looking for atom", 1}},
-	{in: " 42 \x01", expected: 42.0, err: &ExtraDataError{4}},
+	{in: " 42 \x01", expected: 42.0, err: &ExtraDataError{4, []byte("\x01")}},
 	{in: "\x01 true", err: &SyntaxError{"invalid character '\\x01' looking for atom", 1}},
-	{in: " false \x01", expected: false, err: &ExtraDataError{7}},
+	{in: " false \x01", expected: false, err: &ExtraDataError{7, []byte("\x01")}},
 	{in: "\x01 1.2", err: &SyntaxError{"invalid character '\\x01' looking for atom", 1}},
-	{in: " 3.4 \x01", expected: 3.4, err: &ExtraDataError{5}},
+	{in: " 3.4 \x01", expected: 3.4, err: &ExtraDataError{5, []byte("\x01")}},
 	{in: "\x01 \"string\"", err: &SyntaxError{"invalid character '\\x01' looking for atom", 1}},
-	{in: " \"string\" \x01", expected: "string", err: &ExtraDataError{10}},
+	{in: " \"string\" \x01", expected: "string", err: &ExtraDataError{10, []byte("\x01")}},
 
 	// array tests
 	{in: `[1, 2, 3]`, expected: []interface{}{1.0, 2.0, 3.0}},
@@ -236,6 +241,80 @@ var allValueIndent = []byte(`{
 	}
 }`)
 
+func TestErrorsIs(t *testing.T) {
+	for i, tt := range []struct {
+		in       string
+		sentinel error
+	}{
+		{in: `[1,`, sentinel: ErrUnexpectedEOF},
+		{in: `{a: "b`, sentinel: ErrUnexpectedEOF},
+		{in: `"\u0`, sentinel: ErrInvalidHexEscape},
+		{in: `"\u000z"`, sentinel: ErrStringEscape},
+	} {
+		_, err := Decode([]byte(tt.in))
+		if !errors.Is(err, tt.sentinel) {
+			t.Errorf("#%d: %v is not %v", i, err, tt.sentinel)
+		}
+	}
+
+	if err := (&SyntaxError{ErrUnexpectedEOF.msg, 10}); !errors.Is(err, ErrUnexpectedEOF) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatal("positioned EOF error does not match")
+	}
+	if errors.Is(ErrStringEscape, io.ErrUnexpectedEOF) || errors.Is(ErrStringEscape, ErrUnexpectedEOF) {
+		t.Fatal("ErrStringEscape unexpectedly matches EOF")
+	}
+	if errors.Is(&SyntaxError{"invalid character 'x' looking for atom", 1}, &SyntaxError{"invalid character 'x' looking for atom", 2}) {
+		t.Fatal("errors with different offsets match")
+	}
+}
+
+func TestIntRangeError(t *testing.T) {
+	for i, tt := range []struct {
+		in, typ, value string
+		offset         int
+	}{
+		{in: `int8(128)`, typ: "int8", value: "128", offset: 9},
+		{in: `int16(-32769)`, typ: "int16", value: "-32769", offset: 13},
+		{in: `[int32(2147483648)]`, typ: "int32", value: "2147483648", offset: 18},
+		{in: `{a: uint8(256)}`, typ: "uint8", value: "256", offset: 14},
+		{in: `uint32("4294967296")`, typ: "uint32", value: "4294967296", offset: 20},
+		{in: `uint64(18446744073709551616)`, typ: "uint64", value: "18446744073709551616", offset: 28},
+		{in: `int(9223372036854775808)`, typ: "int", value: "9223372036854775808", offset: 24},
+	} {
+		_, err := Decode([]byte(tt.in))
+		var rangeErr *IntRangeError
+		if !errors.As(err, &rangeErr) {
+			t.Errorf("#%d: unexpected error %v (%T)", i, err, err)
+			continue
+		}
+		if expected := (IntRangeError{tt.typ, tt.value, tt.offset}); *rangeErr != expected {
+			t.Errorf("#%d: unexpected error %#v", i, rangeErr)
+		}
+		if !errors.Is(err, strconv.ErrRange) {
+			t.Errorf("#%d: expected error to be strconv.ErrRange", i)
+		}
+	}
+}
+
+func TestIntNonFinite(t *testing.T) {
+	for i, tt := range []struct {
+		in  string
+		err error
+	}{
+		{in: `int(Infinity)`, err: &SyntaxError{"invalid int value Infinity: integers cannot be NaN or Infinity", 13}},
+		{in: `int8(-Infinity)`, err: &SyntaxError{"invalid int8 value -Infinity: integers cannot be NaN or Infinity", 15}},
+		{in: `int64("NaN")`, err: &SyntaxError{"invalid int64 value NaN: integers cannot be NaN or Infinity", 12}},
+		{in: `[uint32(+inf)]`, err: &SyntaxError{"invalid uint32 value +inf: integers cannot be NaN or Infinity", 13}},
+		{in: `{a: uint64(nan)}`, err: &SyntaxError{"invalid uint64 value nan: integers cannot be NaN or Infinity", 15}},
+		{in: `[Infinity]`, err: &SyntaxError{"invalid character 'I' looking for beginning of value", 10}},
+	} {
+		_, err := Decode([]byte(tt.in))
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("#%d: error %v, expected %v", i, err, tt.err)
+		}
+	}
+}
+
 func TestWithStdDecoder(t *testing.T) {
 	expected := make(map[string]interface{})
 	if err := json.Unmarshal(allValueIndent, &expected); err != nil {
@@ -262,7 +341,7 @@ func TestDecodeArray(t *testing.T) {
 		{in: `   ["a"]`, expected: []interface{}{"a"}},
 		{in: `   [     "a"]`, expected: []interface{}{"a"}},
 		{in: `   ["a"      ]`, expected: []interface{}{"a"}},
-		{in: `["a"      ]1`, expected: []interface{}{"a"}, err: &ExtraDataError{11}},
+		{in: `["a"      ]1`, expected: []interface{}{"a"}, err: &ExtraDataError{11, []byte("1")}},
 	} {
 		out, err := DecodeArray([]byte(tt.in))
 		if !reflect.DeepEqual(err, tt.err) {
@@ -285,7 +364,7 @@ func TestDecodeObject(t *testing.T) {
 		{in: `{"a":"1"}   `, expected: map[string]interface{}{"a": "1"}},
 		{in: `{   "a":"1"}`, expected: map[string]interface{}{"a": "1"}},
 		{in: `{"a"   :1  }`, expected: map[string]interface{}{"a": float64(1)}},
-		{in: `{"a":1}   1`, expected: map[string]interface{}{"a": float64(1)}, err: &ExtraDataError{10}},
+		{in: `{"a":1}   1`, expected: map[string]interface{}{"a": float64(1)}, err: &ExtraDataError{10, []byte("1")}},
 	} {
 		out, err := DecodeObject([]byte(tt.in))
 		if !reflect.DeepEqual(err, tt.err) {
@@ -318,6 +397,41 @@ func TestType(t *testing.T) {
 	}
 }
 
+func TestTypeExtended(t *testing.T) {
+	for i, tt := range []struct {
+		in  string
+		typ ValueType
+	}{
+		{in: `datetime("2017-12-25T15:00:00Z")`, typ: DateTime},
+		{in: `duration("1h")`, typ: Duration},
+		{in: `ip("10.0.0.1")`, typ: IP},
+		{in: `ipport("10.0.0.1:80")`, typ: IPPort},
+		{in: `bytes("AQI=")`, typ: Bytes},
+		{in: `int(1)`, typ: Int},
+		{in: `int8(1)`, typ: Int},
+		{in: `int16(1)`, typ: Int},
+		{in: `int32(1)`, typ: Int},
+		{in: `int64(1)`, typ: Int},
+		{in: `uint(1)`, typ: Uint},
+		{in: `uint8(1)`, typ: Uint},
+		{in: `uint16(1)`, typ: Uint},
+		{in: `uint32(1)`, typ: Uint},
+		{in: `uint64(1)`, typ: Uint},
+		{in: `cidr("10.0.0.0/8")`, typ: CIDR},
+	} {
+		v, err := Decode([]byte(tt.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ := Type(v); typ != tt.typ {
+			t.Errorf("#%d: Type(%s) = %q; want %q", i, tt.in, typ, tt.typ)
+		}
+	}
+	if typ := Type(struct{}{}); typ != Unknown {
+		t.Errorf("Type(struct{}{}) = %q", typ)
+	}
+}
+
 func TestFuzzCover(t *testing.T) {
 	d, err := os.Open("testdata/fuzz/corpus")
 	if err != nil {
@@ -346,8 +460,16 @@ func TestFuzzCover(t *testing.T) {
 
 			f.Close()
 			decoded, err := Decode(data)
-			if err == nil {
-				Marshal(decoded)
+			if err != nil {
+				continue
+			}
+			out, err := RoundTrip(data)
+			if err != nil {
+				t.Errorf("%s: %v", file.Name(), err)
+				continue
+			}
+			if v, err := Decode(out); err != nil || !Equal(v, decoded) {
+				t.Errorf("%s: round trip mismatch: %s (%v)", file.Name(), out, err)
 			}
 		}
 	}
@@ -361,6 +483,9 @@ func TestNonGreedy(t *testing.T) {
 		if string(tail) != "blah" {
 			t.Fatalf("Unexpected tail: '%s'", tail)
 		}
+		if !bytes.Equal(err1.Tail, tail) {
+			t.Fatalf("Unexpected Tail: '%s'", err1.Tail)
+		}
 		expected := map[string]interface{}{
 			"test": 1.0,
 		}
@@ -373,6 +498,120 @@ func TestNonGreedy(t *testing.T) {
 
 }
 
+func TestAllowTrailingData(t *testing.T) {
+	for i, tt := range []struct {
+		in       string
+		expected interface{}
+		tail     string
+	}{
+		{in: `{test: 1}  blah`, expected: map[string]interface{}{"test": 1.0}, tail: "  blah"},
+		{in: `[1, 2]text`, expected: []interface{}{1.0, 2.0}, tail: "text"},
+		{in: `"str" }`, expected: "str", tail: " }"},
+		{in: ` 42 `, expected: 42.0, tail: " "},
+		{in: `true`, expected: true, tail: ""},
+	} {
+		d := NewDecoder([]byte(tt.in))
+		d.AllowTrailingData()
+		v, err := d.Decode()
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tt.expected) {
+			t.Errorf("#%d: %#v, expected %#v", i, v, tt.expected)
+		}
+		if b := d.Buffered(); string(b) != tt.tail {
+			t.Errorf("#%d: unexpected tail: '%s'", i, b)
+		}
+	}
+
+	d := NewDecoder([]byte(`{a: 1} {b: 2}`))
+	d.AllowTrailingData()
+	m := make(map[string]interface{})
+	if err := d.DecodeInto(m, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DecodeInto(m, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 2 {
+		t.Fatalf("Unexpected value: %v", m)
+	}
+
+	d = NewDecoder([]byte(`[1, 2 blah`))
+	d.AllowTrailingData()
+	if _, err := d.Decode(); err == nil {
+		t.Fatal("Expected error for malformed value")
+	}
+}
+
+func TestBuffered(t *testing.T) {
+	d := NewDecoder([]byte(`{test: 1}  blah`))
+	if b := d.Buffered(); string(b) != `{test: 1}  blah` {
+		t.Fatalf("Unexpected buffered data before decoding: '%s'", b)
+	}
+	_, err := d.Decode()
+	if _, ok := err.(*ExtraDataError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if b := d.Buffered(); string(b) != "blah" {
+		t.Fatalf("Unexpected buffered data: '%s'", b)
+	}
+	if offset := d.Offset(); offset != 11 {
+		t.Fatalf("Unexpected offset: %d", offset)
+	}
+
+	d = NewDecoder([]byte(`[1] `))
+	if _, err = d.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if b := d.Buffered(); len(b) != 0 {
+		t.Fatalf("Unexpected buffered data: '%s'", b)
+	}
+}
+
+func TestDecodeFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	objPath := filepath.Join(dir, "obj.jsonx")
+	if err := ioutil.WriteFile(objPath, []byte(`{a: int(1), b: [true]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	arrPath := filepath.Join(dir, "arr.jsonx")
+	if err := ioutil.WriteFile(arrPath, []byte(`["x", null]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{"a": 1, "b": []interface{}{true}}
+	if v, err := DecodeFile(objPath); err != nil || !reflect.DeepEqual(v, expected) {
+		t.Fatalf("DecodeFile: %v, %v", v, err)
+	}
+	if v, err := DecodeFileObject(objPath); err != nil || !reflect.DeepEqual(v, expected) {
+		t.Fatalf("DecodeFileObject: %v, %v", v, err)
+	}
+	if v, err := DecodeFileArray(arrPath); err != nil || !reflect.DeepEqual(v, []interface{}{"x", nil}) {
+		t.Fatalf("DecodeFileArray: %v, %v", v, err)
+	}
+
+	if _, err := DecodeFileArray(objPath); err == nil {
+		t.Fatal("DecodeFileArray accepted an object")
+	} else if _, ok := err.(*SyntaxError); !ok {
+		t.Fatalf("Unexpected error type: %T", err)
+	}
+
+	_, err = DecodeFile(filepath.Join(dir, "missing.jsonx"))
+	if !os.IsNotExist(err) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := err.(*os.PathError); !ok {
+		t.Fatalf("Unexpected error type: %T", err)
+	}
+}
+
 func BenchmarkDecode(b *testing.B) {
 	data := []byte(`{k1: 1e-3, k2: int(64), k3: int64(444444444444442), k4: datetime("2017-01-01T12:00:00Z"),
 	k5: ip("192.168.100.19"), k6: ip("fd00::abc:1"), k7: ipport("192.168.100.001:65555"),
@@ -381,3 +620,1158 @@ func BenchmarkDecode(b *testing.B) {
 		Decode(data)
 	}
 }
+
+func TestDecodeEmptyContainers(t *testing.T) {
+	v, err := Decode([]byte(`{a: [], b: [], c: {}, d: {}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := v.(map[string]interface{})
+
+	a := m["a"].([]interface{})
+	a = append(a, 1.0)
+	m["a"] = a
+	if b := m["b"].([]interface{}); len(b) != 0 {
+		t.Fatalf("Appending to one empty array affected another one: %v", b)
+	}
+
+	m["c"].(map[string]interface{})["x"] = true
+	if d := m["d"].(map[string]interface{}); len(d) != 0 {
+		t.Fatalf("Modifying one empty object affected another one: %v", d)
+	}
+
+	expected := map[string]interface{}{
+		"a": []interface{}{1.0},
+		"b": []interface{}{},
+		"c": map[string]interface{}{"x": true},
+		"d": map[string]interface{}{},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("Unexpected value: %v", m)
+	}
+}
+
+func BenchmarkDecodeEmptyContainers(b *testing.B) {
+	data := []byte("[" + strings.Repeat(`[], {}, {a: [], b: [[]], c: {}}, `, 1000) + "]")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Decode(data)
+	}
+}
+
+func TestInternKeys(t *testing.T) {
+	d := NewDecoder([]byte(`[{key: 1, "key2": 2}, {"key": 3, key2: 4}]`))
+	d.InternKeys()
+	v, err := d.DecodeArray()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{
+		map[string]interface{}{"key": 1.0, "key2": 2.0},
+		map[string]interface{}{"key": 3.0, "key2": 4.0},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("Unexpected value: %v", v)
+	}
+}
+
+func internKeysPayload() []byte {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i := 0; i < 1000; i++ {
+		b.WriteString(`{"id": 1, "name": "test", "enabled": true, "timestamp": 1.5, "tags": null},`)
+	}
+	b.WriteByte(']')
+	return []byte(b.String())
+}
+
+func BenchmarkDecodeNoInternKeys(b *testing.B) {
+	data := internKeysPayload()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		NewDecoder(data).Decode()
+	}
+}
+
+func BenchmarkDecodeInternKeys(b *testing.B) {
+	data := internKeysPayload()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		d := NewDecoder(data)
+		d.InternKeys()
+		d.Decode()
+	}
+}
+
+func TestRawStrings(t *testing.T) {
+	const sql = "SELECT \"name\", 'x'\nFROM \"users\"\n  WHERE a = \"\\n\" LIMIT 1"
+	d := NewDecoder([]byte("{query: \"\"\"" + sql + "\"\"\", empty: \"\"\"\"\"\", normal: \"a\\tb\", \"\"\"key\"\"\": \"\"\"\"quoted\"\"\"}"))
+	d.AllowRawStrings()
+	v, err := d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"query":  sql,
+		"empty":  "",
+		"normal": "a\tb",
+		"key":    "\"quoted",
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("Unexpected value: %#v", v)
+	}
+
+	d = NewDecoder([]byte(`"""unterminated""`))
+	d.AllowRawStrings()
+	if _, err := d.Decode(); err != ErrUnexpectedEOF {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	d = NewDecoder([]byte(`"""a"""`))
+	if _, err := d.Decode(); err == nil {
+		t.Fatal("Expected error when raw strings are not enabled")
+	}
+
+	d = NewDecoder([]byte(`["""a"b""", 1]`))
+	d.AllowRawStrings()
+	if err := d.Skip(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStringConcat(t *testing.T) {
+	for i, tt := range []struct {
+		in       string
+		expected interface{}
+	}{
+		{in: `"foo" "bar"`, expected: "foobar"},
+		{in: "\"foo\"\n  \"bar\"\t\"\\u0062az\"", expected: "foobarbaz"},
+		{in: `["a" "b", "c"]`, expected: []interface{}{"ab", "c"}},
+		{in: `{"a" : "x"  "y", b: "z"}`, expected: map[string]interface{}{"a": "xy", "b": "z"}},
+	} {
+		d := NewDecoder([]byte(tt.in))
+		d.AllowStringConcat()
+		v, err := d.Decode()
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tt.expected) {
+			t.Errorf("#%d: %#v, want %#v", i, v, tt.expected)
+		}
+		d = NewDecoder([]byte(tt.in))
+		d.AllowStringConcat()
+		if err := d.Skip(); err != nil || d.Offset() != len(tt.in) {
+			t.Errorf("#%d: skip: %v, offset %d", i, err, d.Offset())
+		}
+	}
+
+	// keys are not concatenated
+	d := NewDecoder([]byte(`{"a" "b": 1}`))
+	d.AllowStringConcat()
+	if _, err := d.Decode(); err == nil {
+		t.Error("Expected error for concatenated key")
+	}
+
+	// disabled by default
+	if _, err := Decode([]byte(`"foo" "bar"`)); err == nil {
+		t.Error("Expected error when concatenation is not enabled")
+	}
+}
+
+func TestMaxStringLen(t *testing.T) {
+	for i, tt := range []struct {
+		in  string
+		err error
+	}{
+		{in: `"abcd"`},
+		{in: `"abcde"`, err: &SyntaxError{ErrStringTooLong.msg, 1}},
+		{in: `"ab\n"`},
+		{in: `"ab\tc"`, err: &SyntaxError{ErrStringTooLong.msg, 1}},
+		{in: `["abc", {"abcd": "abcdefgh"}]`, err: &SyntaxError{ErrStringTooLong.msg, 18}},
+		{in: `{"abcde": 1}`, err: &SyntaxError{ErrStringTooLong.msg, 2}},
+		{in: `"abcdefgh`, err: &SyntaxError{ErrStringTooLong.msg, 1}},
+	} {
+		d := NewDecoder([]byte(tt.in))
+		d.SetMaxStringLen(4)
+		_, err := d.Decode()
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("#%d: %v, want %v", i, err, tt.err)
+		}
+		if tt.err != nil && !errors.Is(err, ErrStringTooLong) {
+			t.Errorf("#%d: %v does not match ErrStringTooLong", i, err)
+		}
+	}
+
+	// concatenated strings are limited by the total length of the literals
+	for i, tt := range []struct {
+		in  string
+		err error
+	}{
+		{in: `"ab" "cd"`},
+		{in: `"ab" "c\n"`, err: &SyntaxError{ErrStringTooLong.msg, 6}},
+		{in: `"ab" "c" "d" "e"`, err: &SyntaxError{ErrStringTooLong.msg, 14}},
+	} {
+		d := NewDecoder([]byte(tt.in))
+		d.AllowStringConcat()
+		d.SetMaxStringLen(4)
+		_, err := d.Decode()
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("concat #%d: %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+func TestMaxObjectKeys(t *testing.T) {
+	for i, tt := range []struct {
+		in  string
+		err error
+	}{
+		{in: `{a: 1, b: 2, c: 3}`},
+		{in: `{a: 1, b: 2, c: 3, d: 4}`, err: &SyntaxError{ErrTooManyKeys.msg, 20}},
+		{in: `{a: 1, b: 2, c: 3, a: 4}`},
+		{in: `[{a: 1, b: 2, c: 3}, {a: 1, b: 2, c: 3}]`},
+		{in: `{a: {a: 1, b: 2, c: 3}, b: 2, c: {x: 1, y: 2, z: 3, w: 4}}`, err: &SyntaxError{ErrTooManyKeys.msg, 53}},
+	} {
+		d := NewDecoder([]byte(tt.in))
+		d.SetMaxObjectKeys(3)
+		_, err := d.Decode()
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("#%d: %v, want %v", i, err, tt.err)
+		}
+		if tt.err != nil && !errors.Is(err, ErrTooManyKeys) {
+			t.Errorf("#%d: %v does not match ErrTooManyKeys", i, err)
+		}
+	}
+}
+
+func TestUseNumber(t *testing.T) {
+	d := NewDecoder([]byte(`{a: 12345678901234567890, b: -0.1000, c: 1e3, d: int(5), e: [0, -7]}`))
+	d.UseNumber()
+	v, err := d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"a": json.Number("12345678901234567890"),
+		"b": json.Number("-0.1000"),
+		"c": json.Number("1e3"),
+		"d": 5,
+		"e": []interface{}{json.Number("0"), json.Number("-7")},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("Unexpected value: %#v", v)
+	}
+	if typ := Type(expected["a"]); typ != Number {
+		t.Fatalf("Unexpected type: %v", typ)
+	}
+}
+
+func TestExtendedKeys(t *testing.T) {
+	const src = `{2fa: true, x-api-key: "k", a.b.c: 1, 123: "n", _x: null}`
+	expected := map[string]interface{}{
+		"2fa":       true,
+		"x-api-key": "k",
+		"a.b.c":     1.0,
+		"123":       "n",
+		"_x":        nil,
+	}
+	for _, intern := range []bool{false, true} {
+		d := NewDecoder([]byte(src))
+		d.AllowExtendedKeys()
+		if intern {
+			d.InternKeys()
+		}
+		v, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(v, expected) {
+			t.Fatalf("Unexpected value: %#v", v)
+		}
+	}
+
+	d := NewDecoder([]byte(src))
+	d.AllowExtendedKeys()
+	if err := d.Skip(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Decode([]byte(`{2fa: true}`)); err == nil {
+		t.Fatal("Expected error when extended keys are not enabled")
+	}
+	d = NewDecoder([]byte(`{x-api key: 1}`))
+	d.AllowExtendedKeys()
+	if _, err := d.Decode(); err == nil {
+		t.Fatal("Expected error for key with a space")
+	}
+}
+
+func TestDecodeInto(t *testing.T) {
+	m := map[string]interface{}{"old": true}
+	if err := NewDecoder([]byte(`{a: 1, b: {c: [2]}}`)).DecodeInto(m, false); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"a": 1.0, "b": map[string]interface{}{"c": []interface{}{2.0}}}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("Unexpected value after replace: %#v", m)
+	}
+	nested := m["b"].(map[string]interface{})
+
+	if err := NewDecoder([]byte(`{b: {d: 3}, e: null}`)).DecodeInto(m, true); err != nil {
+		t.Fatal(err)
+	}
+	expected = map[string]interface{}{"a": 1.0, "b": map[string]interface{}{"d": 3.0}, "e": nil}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("Unexpected value after merge: %#v", m)
+	}
+	if _, exists := nested["d"]; exists {
+		t.Fatal("Nested map was reused")
+	}
+
+	if err := NewDecoder([]byte(`{z: "x"}`)).DecodeInto(m, false); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, map[string]interface{}{"z": "x"}) {
+		t.Fatalf("Unexpected value after second replace: %#v", m)
+	}
+
+	if err := NewDecoder([]byte(`[1]`)).DecodeInto(m, true); err == nil {
+		t.Fatal("Expected error for array")
+	}
+	if err := NewDecoder([]byte(`{a: 1}`)).DecodeInto(nil, true); err == nil {
+		t.Fatal("Expected error for nil map")
+	}
+	d := NewDecoder([]byte(`{a: 1, b: 2,}`))
+	d.Strict()
+	if err := d.DecodeInto(m, true); err == nil {
+		t.Fatal("Expected error for trailing comma in strict mode")
+	}
+}
+
+func TestIPPortErrorOffsets(t *testing.T) {
+	for i, tt := range []struct {
+		in  string
+		err error
+	}{
+		{in: `ipport("[fd00::1")`, err: &SyntaxError{"invalid ipv6, missing ]", 17}},
+		{in: `ipport("[fd00::1]80")`, err: &SyntaxError{"missing : after ipv6", 18}},
+		{in: `ipport("10.0.0.1")`, err: &SyntaxError{"missing : after ipv4", 17}},
+		{in: `ipport("10.0.0.1:")`, err: &SyntaxError{"missing port after :", 18}},
+		{in: `ipport("10.0.0.1:8x")`, err: &SyntaxError{"malformed port: 8x", 18}},
+		{in: `ipport("[fd00::1]:8x")`, err: &SyntaxError{"malformed port: 8x", 19}},
+		{in: `ipport("[fd00::g]:80")`, err: &SyntaxError{"malformed IP: fd00::g", 10}},
+		{in: `[1, ipport(10.0.0.1:8x)]`, err: &SyntaxError{"malformed port: 8x", 21}},
+	} {
+		_, err := Decode([]byte(tt.in))
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("#%d: %#v, want %#v", i, err, tt.err)
+		}
+	}
+}
+
+func TestDatetimeEpoch(t *testing.T) {
+	expected := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	for i, tt := range []struct {
+		in   string
+		unit EpochUnit
+		t    time.Time
+	}{
+		{in: `datetime(1700000000)`, unit: Seconds, t: expected},
+		{in: `datetime(1700000000123)`, unit: Millis, t: expected.Add(123 * time.Millisecond)},
+		{in: `datetime(1700000000123456)`, unit: Micros, t: expected.Add(123456 * time.Microsecond)},
+		{in: `datetime(1700000000123456789)`, unit: Nanos, t: expected.Add(123456789)},
+		{in: `datetime(-1500)`, unit: Millis, t: time.Date(1969, 12, 31, 23, 59, 58, 500000000, time.UTC)},
+		{in: `datetime("2023-11-14T22:13:20Z")`, unit: Millis, t: expected},
+		{in: `datetime(2023-11-14T22:13:20Z)`, unit: Seconds, t: expected},
+	} {
+		d := NewDecoder([]byte(tt.in))
+		d.SetEpochUnit(tt.unit)
+		v, err := d.Decode()
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if tm := v.(time.Time); !tm.Equal(tt.t) || tm.Location() != time.UTC {
+			t.Errorf("#%d: %v, want %v", i, tm, tt.t)
+		}
+	}
+
+	if _, err := Decode([]byte(`datetime("1700000000")`)); err == nil {
+		t.Error("Expected error for quoted epoch")
+	}
+	if _, err := Decode([]byte(`datetime(99999999999999999999)`)); !errors.Is(err, strconv.ErrRange) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestStrictUTF8(t *testing.T) {
+	for i, tt := range []struct {
+		in       string
+		expected string
+		offset   int
+	}{
+		{in: "\"ok é\"", expected: "ok é", offset: -1},
+		{in: "\"ab\x80cd\"", expected: "ab�cd", offset: 3},
+		{in: "\"\xc3\"", expected: "�", offset: 1},
+		{in: `"a\ud800b"`, expected: "a�b", offset: 2},
+		{in: `"\udc00"`, expected: "�", offset: 1},
+		{in: `"𝄞"`, expected: "\U0001D11E", offset: -1},
+		{in: `{"k\ud800": 1}`, expected: "", offset: 3},
+	} {
+		v, err := Decode([]byte(tt.in))
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+		} else if s, ok := v.(string); ok && s != tt.expected {
+			t.Errorf("#%d: %q, want %q", i, s, tt.expected)
+		}
+
+		d := NewDecoder([]byte(tt.in))
+		d.StrictUTF8()
+		v, err = d.Decode()
+		if tt.offset == -1 {
+			if err != nil || v != tt.expected {
+				t.Errorf("#%d: strict: %q, %v", i, v, err)
+			}
+			continue
+		}
+		if e, ok := err.(*InvalidUTF8Error); !ok || e.Offset != tt.offset {
+			t.Errorf("#%d: strict: %#v, want offset %d", i, err, tt.offset)
+		}
+	}
+}
+
+func TestInvalidUTF8Policy(t *testing.T) {
+	const in = "{\"k\xff\": [\"ab\x80cd\", \"\\ud800x\\u00e9\", \"\xc3\", \"\"\"raw\xfe\"\"\"]}"
+	for i, tt := range []struct {
+		policy   InvalidUTF8Policy
+		expected interface{}
+		offset   int
+	}{
+		{policy: ReplaceInvalidUTF8, expected: map[string]interface{}{"k\ufffd": []interface{}{"ab\ufffdcd", "\ufffdxé", "\ufffd", "raw\xfe"}}},
+		{policy: DropInvalidUTF8, expected: map[string]interface{}{"k": []interface{}{"abcd", "xé", "", "raw"}}},
+		{policy: RejectInvalidUTF8, offset: 3},
+	} {
+		d := NewDecoder([]byte(in))
+		d.AllowRawStrings()
+		d.SetInvalidUTF8Policy(tt.policy)
+		v, err := d.Decode()
+		if tt.expected == nil {
+			if e, ok := err.(*InvalidUTF8Error); !ok || e.Offset != tt.offset {
+				t.Errorf("#%d: %#v, want offset %d", i, err, tt.offset)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tt.expected) {
+			t.Errorf("#%d: %q, want %q", i, v, tt.expected)
+		}
+	}
+}
+
+func TestCIDR(t *testing.T) {
+	for i, tt := range []struct {
+		in, expected string
+		ipnet        *net.IPNet
+	}{
+		{
+			in:       `cidr("10.0.0.0/8")`,
+			expected: `cidr("10.0.0.0/8")`,
+			ipnet:    &net.IPNet{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)},
+		},
+		{
+			in:       `cidr("192.168.1.77/24")`,
+			expected: `cidr("192.168.1.0/24")`,
+			ipnet:    &net.IPNet{IP: net.IP{192, 168, 1, 0}, Mask: net.CIDRMask(24, 32)},
+		},
+		{
+			in:       `cidr("2001:DB8::/32")`,
+			expected: `cidr("2001:db8::/32")`,
+			ipnet:    &net.IPNet{IP: net.ParseIP("2001:db8::"), Mask: net.CIDRMask(32, 128)},
+		},
+	} {
+		v, err := Decode([]byte(tt.in))
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tt.ipnet) {
+			t.Errorf("#%d: %#v, want %#v", i, v, tt.ipnet)
+		}
+		b, err := Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := string(b); s != tt.expected {
+			t.Errorf("#%d: %s, want %s", i, s, tt.expected)
+		}
+	}
+
+	for _, in := range []string{`cidr("10.0.0.0")`, `cidr("10.0.0.0/33")`, `cidr("x/8")`} {
+		if _, err := Decode([]byte(in)); err == nil {
+			t.Errorf("Expected error for %s", in)
+		}
+	}
+	// a nil *net.IPNet is written as null, in JSON compatibility mode too
+	for _, compat := range []bool{false, true} {
+		var buf bytes.Buffer
+		e := NewEncoder(&buf)
+		e.CompatJSON(compat)
+		if err := e.Encode(map[string]interface{}{"n": (*net.IPNet)(nil)}); err != nil {
+			t.Fatal(err)
+		}
+		if v, err := DecodeObject(buf.Bytes()); err != nil || v["n"] != nil {
+			t.Errorf("compat %v: %s: %v, %v", compat, buf.String(), v, err)
+		}
+	}
+}
+
+func TestEachArrayElement(t *testing.T) {
+	var elements []interface{}
+	d := NewDecoder([]byte(` [1, "two", {three: 3}, [4],] `))
+	err := d.EachArrayElement(func(v interface{}) error {
+		elements = append(elements, v)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{1.0, "two", map[string]interface{}{"three": 3.0}, []interface{}{4.0}}
+	if !reflect.DeepEqual(elements, expected) {
+		t.Fatalf("Unexpected elements: %#v", elements)
+	}
+
+	elements = nil
+	d = NewDecoder([]byte(`[1, 2, }, 4]`))
+	err = d.EachArrayElement(func(v interface{}) error {
+		elements = append(elements, v)
+		return nil
+	})
+	if serr, ok := err.(*SyntaxError); !ok || serr.Offset != 8 {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(elements) != 2 {
+		t.Fatalf("Unexpected elements: %v", elements)
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	d = NewDecoder([]byte(`[1, 2, 3]`))
+	err = d.EachArrayElement(func(v interface{}) error {
+		if n++; n == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 2 {
+		t.Fatalf("Unexpected result: %v, %d", err, n)
+	}
+
+	d = NewDecoder([]byte(`{a: 1}`))
+	if err = d.EachArrayElement(func(interface{}) error { return nil }); err == nil {
+		t.Fatal("Expected error for non-array")
+	}
+}
+
+func TestEachArrayElementMemory(t *testing.T) {
+	const (
+		count   = 2000
+		strSize = 1000
+	)
+	src := "[" + strings.Repeat(`{s: "`+strings.Repeat("x", strSize)+`"},`, count) + "]"
+	d := NewDecoder([]byte(src))
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	base, peak := stats.HeapAlloc, stats.HeapAlloc
+	n := 0
+	err := d.EachArrayElement(func(v interface{}) error {
+		if n++; n%500 == 0 {
+			runtime.GC()
+			runtime.ReadMemStats(&stats)
+			if stats.HeapAlloc > peak {
+				peak = stats.HeapAlloc
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != count {
+		t.Fatalf("Unexpected count: %d", n)
+	}
+	// retaining the elements would take more than count*strSize bytes
+	if growth := int64(peak) - int64(base); growth > count*strSize/4 {
+		t.Fatalf("Heap grew by %d bytes", growth)
+	}
+}
+
+func TestAllowLeadingPlus(t *testing.T) {
+	for i, tt := range []struct {
+		in       string
+		expected interface{}
+		err      string
+	}{
+		{in: `+5`, expected: 5.0},
+		{in: `+1.2e3`, expected: 1200.0},
+		{in: `[+0.5, -1, +2]`, expected: []interface{}{0.5, -1.0, 2.0}},
+		{in: `{a: +7}`, expected: map[string]interface{}{"a": 7.0}},
+		{in: `+`, err: "unexpected end of JSON input"},
+		{in: `[+]`, err: "invalid character ']' in numeric literal"},
+		{in: `+-1`, err: "invalid character '-' in numeric literal"},
+		{in: `++1`, err: "invalid character '+' in numeric literal"},
+	} {
+		d := NewDecoder([]byte(tt.in))
+		d.AllowLeadingPlus()
+		v, err := d.Decode()
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("#%d: unexpected error %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tt.expected) {
+			t.Errorf("#%d: %#v, expected %#v", i, v, tt.expected)
+		}
+		d = NewDecoder([]byte(tt.in))
+		d.AllowLeadingPlus()
+		if err = d.Skip(); err != nil || d.Offset() != len(tt.in) {
+			t.Errorf("#%d: skip: %v", i, err)
+		}
+	}
+
+	d := NewDecoder([]byte(`+12.50`))
+	d.AllowLeadingPlus()
+	d.RawNumbers()
+	if v, err := d.Decode(); err != nil || v != RawNumber("12.50") {
+		t.Fatalf("Unexpected result: %#v, %v", v, err)
+	}
+
+	// off by default
+	if _, err := Decode([]byte(`+5`)); err == nil {
+		t.Fatal("Expected error")
+	}
+}
+
+func TestDecodeBytesTo(t *testing.T) {
+	blob := make([]byte, 1<<20+5)
+	for i := range blob {
+		blob[i] = byte(i * 7 % 251)
+	}
+	src, err := Marshal(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	n, err := NewDecoder(src).DecodeBytesTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(blob)) || !bytes.Equal(buf.Bytes(), blob) {
+		t.Fatalf("Unexpected result: %d bytes", n)
+	}
+
+	for i, tt := range []struct {
+		in       string
+		expected string
+		err      string
+	}{
+		{in: ` bytes( "YWJjZA==" ) `, expected: "abcd"},
+		{in: `bytes(YWJjZA==)`, expected: "abcd"},
+		{in: `bytes("")`, expected: ""},
+		{in: `"YWJjZA=="`, err: `invalid character '"' looking for bytes`},
+		{in: `int(5)`, err: `invalid character 'i' looking for bytes`},
+		{in: `bytes("YW*jZA==")`, err: "illegal base64 data at input byte 2"},
+		{in: `bytes("YWJjZA==") x`, expected: "abcd", err: "Extra data after top-level value"},
+	} {
+		buf.Reset()
+		_, err := NewDecoder([]byte(tt.in)).DecodeBytesTo(&buf)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("#%d: unexpected error %v", i, err)
+			}
+		} else if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if buf.String() != tt.expected {
+			t.Errorf("#%d: %q, expected %q", i, buf.String(), tt.expected)
+		}
+	}
+}
+
+func TestPeekType(t *testing.T) {
+	for i, tt := range []struct {
+		in       string
+		expected ValueType
+		err      bool
+	}{
+		{in: ` {a: 1}`, expected: Object},
+		{in: `[1]`, expected: Array},
+		{in: `"s"`, expected: String},
+		{in: `-1.5`, expected: Number},
+		{in: `42`, expected: Number},
+		{in: `true`, expected: Bool},
+		{in: `false`, expected: Bool},
+		{in: `null`, expected: Null},
+		{in: `int(5)`, expected: Int},
+		{in: `int64 ("5")`, expected: Int},
+		{in: `uint16(5)`, expected: Uint},
+		{in: `datetime("2006-01-02T15:04:05Z")`, expected: DateTime},
+		{in: `duration("1s")`, expected: Duration},
+		{in: `ip("1.2.3.4")`, expected: IP},
+		{in: `ipport("1.2.3.4:80")`, expected: IPPort},
+		{in: `cidr("10.0.0.0/8")`, expected: CIDR},
+		{in: `regexp("a+")`, expected: Regexp},
+		{in: `bytes("YQ==")`, expected: Bytes},
+		{in: `nope`, err: true},
+		{in: `int 5`, err: true},
+		{in: `+1`, err: true},
+		{in: ``, err: true},
+	} {
+		d := NewDecoder([]byte(tt.in))
+		typ, err := d.PeekType()
+		if tt.err {
+			if err == nil {
+				t.Errorf("#%d: expected error, got %v", i, typ)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if typ != tt.expected {
+			t.Errorf("#%d: %v, expected %v", i, typ, tt.expected)
+		}
+		if d.Offset() != 0 {
+			t.Errorf("#%d: offset %d", i, d.Offset())
+		}
+		v, err := d.Decode()
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if Type(v) != typ {
+			t.Errorf("#%d: decoded %v, peeked %v", i, Type(v), typ)
+		}
+	}
+
+	d := NewDecoder([]byte(`int(1)`))
+	d.Strict()
+	if _, err := d.PeekType(); err == nil {
+		t.Fatal("Expected error in strict mode")
+	}
+}
+
+func TestInvalidObjectKeys(t *testing.T) {
+	for i, tt := range []struct {
+		in  string
+		err error
+	}{
+		{in: `{int(5): 1}`, err: &SyntaxError{"invalid object key int(...): keys must be strings or identifiers", 2}},
+		{in: `{a: 1, ip ("1.2.3.4"): 1}`, err: &SyntaxError{"invalid object key ip(...): keys must be strings or identifiers", 8}},
+		{in: `{123: 1}`, err: &SyntaxError{"invalid character '1' looking for object key (numeric keys must be quoted)", 2}},
+		{in: `{-1: 1}`, err: &SyntaxError{"invalid character '-' looking for object key (numeric keys must be quoted)", 2}},
+	} {
+		if _, err := Decode([]byte(tt.in)); !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("#%d: %v, want %v", i, err, tt.err)
+		}
+		if err := NewDecoder([]byte(tt.in)).Skip(); !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("#%d: skip: %v, want %v", i, err, tt.err)
+		}
+	}
+
+	// quoted keys are fine
+	v, err := Decode([]byte(`{"int(5)": 1, "123": 2, int : 3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, map[string]interface{}{"int(5)": 1.0, "123": 2.0, "int": 3.0}) {
+		t.Fatalf("Unexpected value: %#v", v)
+	}
+}
+
+func TestZeroPaddedIPv4(t *testing.T) {
+	for i, tt := range []struct {
+		in       string
+		expected interface{}
+		err      bool
+	}{
+		{in: `ip("192.168.100.001")`, expected: net.IPv4(192, 168, 100, 1)},
+		{in: `ip("010.000.00.0")`, expected: net.IPv4(10, 0, 0, 0)},
+		{in: `ip("192.168.100.1")`, expected: net.IPv4(192, 168, 100, 1)},
+		{in: `ipport("001.002.003.004:80")`, expected: net.TCPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 80}},
+		{in: `cidr("010.000.0.0/8")`, expected: &net.IPNet{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)}},
+		{in: `ip("0001.2.3.4")`, err: true},
+		{in: `ip("1.2.3.0256")`, err: true},
+		{in: `ip("1.2.3.256")`, err: true},
+		{in: `ip("01.2.3")`, err: true},
+		{in: `ip("::ffff:01.2.3.4")`, err: true},
+	} {
+		v, err := Decode([]byte(tt.in))
+		if tt.err {
+			if err == nil {
+				t.Errorf("#%d: expected error, got %v", i, v)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tt.expected) {
+			t.Errorf("#%d: %#v, expected %#v", i, v, tt.expected)
+		}
+	}
+
+	d := NewDecoder([]byte(`ip("192.168.000.010")`))
+	d.PreserveIPv4Mapped()
+	v, err := d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, net.IP{192, 168, 0, 10}) {
+		t.Fatalf("Unexpected value: %#v", v)
+	}
+}
+
+func TestAllowBoolAliases(t *testing.T) {
+	for i, tt := range []struct {
+		in       string
+		expected interface{}
+	}{
+		{in: `yes`, expected: true},
+		{in: `on`, expected: true},
+		{in: `no`, expected: false},
+		{in: `off`, expected: false},
+		{in: `[yes, no, true, null]`, expected: []interface{}{true, false, true, nil}},
+		{in: `{enabled: on, debug: off}`, expected: map[string]interface{}{"enabled": true, "debug": false}},
+	} {
+		v, err := NewDecoderWithOptions([]byte(tt.in), WithBoolAliases()).Decode()
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tt.expected) {
+			t.Errorf("#%d: %#v, expected %#v", i, v, tt.expected)
+		}
+
+		if _, err = Decode([]byte(tt.in)); err == nil && i < 4 {
+			t.Errorf("#%d: expected error by default", i)
+		}
+	}
+
+	d := NewDecoderWithOptions([]byte(`[Yes, 1] on`), WithBoolAliases())
+	if err := d.Skip(); err == nil {
+		t.Fatal("Expected error")
+	}
+	d = NewDecoderWithOptions([]byte(`[yes, 1] off`), WithBoolAliases())
+	if err := d.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	if typ, err := d.PeekType(); err != nil || typ != Bool {
+		t.Fatalf("Unexpected type: %v, %v", typ, err)
+	}
+}
+
+func TestCaseInsensitiveKeywords(t *testing.T) {
+	for i, tt := range []struct {
+		in       string
+		expected interface{}
+		aliases  bool
+	}{
+		{in: `True`, expected: true},
+		{in: `FALSE`, expected: false},
+		{in: `Null`, expected: nil},
+		{in: `[tRuE, nULL, false]`, expected: []interface{}{true, nil, false}},
+		{in: `{a: YES, b: Off}`, expected: map[string]interface{}{"a": true, "b": false}, aliases: true},
+	} {
+		opts := []DecodeOption{WithCaseInsensitiveKeywords()}
+		if tt.aliases {
+			opts = append(opts, WithBoolAliases())
+		}
+		v, err := NewDecoderWithOptions([]byte(tt.in), opts...).Decode()
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tt.expected) {
+			t.Errorf("#%d: %#v, expected %#v", i, v, tt.expected)
+		}
+
+		if tt.aliases {
+			opts = []DecodeOption{WithBoolAliases()}
+		} else {
+			opts = nil
+		}
+		if _, err = NewDecoderWithOptions([]byte(tt.in), opts...).Decode(); err == nil {
+			t.Errorf("#%d: expected error by default", i)
+		}
+	}
+
+	for i, in := range []string{`Int(5)`, `INT8(5)`, `Datetime("2017-01-01T12:00:00Z")`, `Truth`} {
+		if _, err := NewDecoderWithOptions([]byte(in), WithCaseInsensitiveKeywords()).Decode(); err == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+}
+
+func TestDecodeArrayLimit(t *testing.T) {
+	for i, tt := range []struct {
+		in       string
+		n        int
+		expected []interface{}
+		rest     string
+	}{
+		{in: `[1, 2, 3, 4]`, n: 2, expected: []interface{}{1.0, 2.0}, rest: `, 3, 4]`},
+		{in: `[1, [2], {a: 3}, 4] x`, n: 3, expected: []interface{}{1.0, []interface{}{2.0}, map[string]interface{}{"a": 3.0}}, rest: `, 4] x`},
+		{in: `[1 , 2]`, n: 1, expected: []interface{}{1.0}, rest: `, 2]`},
+		{in: `[1, 2 ] `, n: 2, expected: []interface{}{1.0, 2.0}},
+		{in: `[1, 2, ]`, n: 2, expected: []interface{}{1.0, 2.0}},
+		{in: `[1, 2 , 3]`, n: 2, expected: []interface{}{1.0, 2.0}, rest: `, 3]`},
+		{in: `[1, 2]`, n: 10, expected: []interface{}{1.0, 2.0}},
+		{in: ` [] `, n: 1, expected: []interface{}{}},
+		{in: `[1, 2, 3]`, n: 0, expected: []interface{}{1.0, 2.0, 3.0}},
+	} {
+		d := NewDecoder([]byte(tt.in))
+		a, err := d.DecodeArrayLimit(tt.n)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(a, tt.expected) {
+			t.Errorf("#%d: %#v, expected %#v", i, a, tt.expected)
+		}
+		if rest := string(d.Buffered()); rest != tt.rest {
+			t.Errorf("#%d: rest %q, expected %q", i, rest, tt.rest)
+		}
+	}
+
+	for i, in := range []string{`{a: 1}`, `[1, }`, `[1, 2] x`, `[1, 2, 3, 4, 5] x`} {
+		if a, err := NewDecoder([]byte(in)).DecodeArrayLimit(5); err == nil {
+			t.Errorf("#%d: expected error, got %v", i, a)
+		}
+	}
+
+	d := NewDecoder([]byte(`[1, 2] x`))
+	if _, err := d.DecodeArrayLimit(2); err == nil {
+		t.Error("expected ExtraDataError for exactly n elements")
+	} else if e, ok := err.(*ExtraDataError); !ok || string(e.Tail) != "x" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func BenchmarkDecodeEscapedString(b *testing.B) {
+	data := []byte(`"` + strings.Repeat(`some text with \"quotes\", a tab\t and é 𝄞. `, 4) + `"`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Decode(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecodeLongEscapedString(t *testing.T) {
+	pad := strings.Repeat("x", 70)
+	for i, in := range []string{
+		`a\"b\\c\/d\bf\fg\nh\ri\tj`,
+		`é日𝄞`,
+		`\uD834 unpaired \uDD1E and \uD834A`,
+		"bad\xff\xfeutf8 é 𝄞",
+		`𝄞` + "\xc3",
+		`\u0000\u001f`,
+		"no escapes at all é",
+		`bad escape \x`,
+		`short \u12`,
+		"control \x01",
+	} {
+		for _, policy := range []InvalidUTF8Policy{ReplaceInvalidUTF8, DropInvalidUTF8} {
+			for _, s := range []string{pad + in, in + pad, pad + in + pad} {
+				var expected string
+				b, ok := unquoteBytes([]byte(s), nil, policy == DropInvalidUTF8)
+				if ok {
+					expected = string(b)
+				}
+				d := NewDecoder([]byte(`"` + s + `"`))
+				d.SetInvalidUTF8Policy(policy)
+				start, end, _, err := d.scanString()
+				if err != nil {
+					if ok {
+						t.Errorf("#%d (%d): scan error %v", i, policy, err)
+					}
+					continue
+				}
+				v, err := d.longStringValue(start, end)
+				if !ok {
+					if err != ErrStringEscape {
+						t.Errorf("#%d (%d): unexpected result %q, %v", i, policy, v, err)
+					}
+					continue
+				}
+				if err != nil || v != expected {
+					t.Errorf("#%d (%d): %q, %v, expected %q", i, policy, v, err, expected)
+				}
+			}
+		}
+	}
+}
+
+func TestEmptyInput(t *testing.T) {
+	for i, tt := range []struct {
+		in       string
+		comments bool
+		err      error
+	}{
+		{in: ``, err: ErrEmptyInput},
+		{in: " \t\r\n ", err: ErrEmptyInput},
+		{in: "// comment\n /* block */ ", comments: true, err: ErrEmptyInput},
+		{in: "// comment", err: &SyntaxError{"invalid character '/' looking for atom", 1}},
+		{in: " [", err: ErrUnexpectedEOF},
+	} {
+		decoder := func() *Decoder {
+			d := NewDecoder([]byte(tt.in))
+			if tt.comments {
+				d.AllowComments()
+			}
+			return d
+		}
+		if _, err := decoder().Decode(); !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("#%d: Decode: %v, want %v", i, err, tt.err)
+		}
+		if tt.err != ErrEmptyInput {
+			continue
+		}
+		if _, err := decoder().DecodeObject(); err != ErrEmptyInput {
+			t.Errorf("#%d: DecodeObject: %v", i, err)
+		}
+		if _, err := decoder().DecodeArray(); err != ErrEmptyInput {
+			t.Errorf("#%d: DecodeArray: %v", i, err)
+		}
+		if err := decoder().DecodeInto(make(map[string]interface{}), false); err != ErrEmptyInput {
+			t.Errorf("#%d: DecodeInto: %v", i, err)
+		}
+		if err := decoder().EachArrayElement(func(interface{}) error { return nil }); err != ErrEmptyInput {
+			t.Errorf("#%d: EachArrayElement: %v", i, err)
+		}
+		if _, err := decoder().DecodeArrayLimit(1); err != ErrEmptyInput {
+			t.Errorf("#%d: DecodeArrayLimit: %v", i, err)
+		}
+		if _, err := decoder().PeekType(); err != ErrEmptyInput {
+			t.Errorf("#%d: PeekType: %v", i, err)
+		}
+		if _, err := decoder().DecodeBytesTo(ioutil.Discard); err != ErrEmptyInput {
+			t.Errorf("#%d: DecodeBytesTo: %v", i, err)
+		}
+		if _, _, err := decoder().DecodeWithSpans(); err != ErrEmptyInput {
+			t.Errorf("#%d: DecodeWithSpans: %v", i, err)
+		}
+		if _, _, err := decoder().DecodeWithComments(); err != ErrEmptyInput {
+			t.Errorf("#%d: DecodeWithComments: %v", i, err)
+		}
+	}
+}
+
+func TestDecodeFloatArray(t *testing.T) {
+	for i, tt := range []struct {
+		in       string
+		expected []float64
+		err      error
+	}{
+		{in: ` [1, -2.5, 3e2, 0] `, expected: []float64{1, -2.5, 300, 0}},
+		{in: `[]`, expected: []float64{}},
+		{in: `[1, "2", 3]`, err: &SyntaxError{"invalid character '\"' looking for number in array element 1", 5}},
+		{in: `[1, 2, int(3)]`, err: &SyntaxError{"invalid character 'i' looking for number in array element 2", 8}},
+		{in: `[1, -x]`, err: &SyntaxError{"invalid character 'x' in negative numeric literal", 6}},
+		{in: `[1 2]`, err: &SyntaxError{"invalid character '2' after array element", 4}},
+		{in: `[1, 2`, err: ErrUnexpectedEOF},
+		{in: `{}`, err: &SyntaxError{"invalid character '{' looking for beginning of array", 1}},
+		{in: ` `, err: ErrEmptyInput},
+		{in: `[12345678901234567890]`, expected: []float64{12345678901234567890}},
+		{in: "[2" + strings.Repeat("0", 400) + "]", err: &SyntaxError{"strconv.ParseFloat: parsing \"2" + strings.Repeat("0", 400) + "\": value out of range", 402}},
+	} {
+		a, err := NewDecoder([]byte(tt.in)).DecodeFloatArray()
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("#%d: %v, want %v", i, err, tt.err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(a, tt.expected) {
+			t.Errorf("#%d: %v, want %v", i, a, tt.expected)
+		}
+	}
+
+	d := NewDecoder([]byte(`[+1, 2]`))
+	d.AllowLeadingPlus()
+	if a, err := d.DecodeFloatArray(); err != nil || !reflect.DeepEqual(a, []float64{1, 2}) {
+		t.Errorf("Leading plus: %v, %v", a, err)
+	}
+}
+
+func BenchmarkDecodeFloatArray(b *testing.B) {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i := 0; i < 1000; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(strconv.FormatFloat(float64(i)*1.25, 'g', -1, 64))
+	}
+	buf.WriteByte(']')
+	data := buf.Bytes()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewDecoder(data).DecodeFloatArray(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestLeadingZeros(t *testing.T) {
+	for i, tt := range []struct {
+		in        string
+		expected  interface{}
+		err       error // default mode
+		strictErr error
+	}{
+		{in: `0`, expected: 0.0},
+		{in: `-0`, expected: 0.0},
+		{in: `0.5`, expected: 0.5},
+		{in: `0e1`, expected: 0.0},
+		{in: `[0, 10]`, expected: []interface{}{0.0, 10.0}},
+		{in: `012`, expected: 0.0, err: &ExtraDataError{1, []byte("12")},
+			strictErr: &SyntaxError{"invalid character '1' after leading zero in numeric literal", 2}},
+		{in: `00`, expected: 0.0, err: &ExtraDataError{1, []byte("0")},
+			strictErr: &SyntaxError{"invalid character '0' after leading zero in numeric literal", 2}},
+		{in: `[-01]`, err: &SyntaxError{"invalid character '1' after array element", 4},
+			strictErr: &SyntaxError{"invalid character '1' after leading zero in numeric literal", 4}},
+		{in: `{"a": 00.5}`, err: &SyntaxError{"invalid character '0' after object key:value pair", 8},
+			strictErr: &SyntaxError{"invalid character '0' after leading zero in numeric literal", 8}},
+	} {
+		v, err := Decode([]byte(tt.in))
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("#%d: %v, want %v", i, err, tt.err)
+		}
+		if !reflect.DeepEqual(v, tt.expected) {
+			t.Errorf("#%d: %#v, want %#v", i, v, tt.expected)
+		}
+
+		strictErr := tt.strictErr
+		if strictErr == nil {
+			strictErr = tt.err
+		}
+		d := NewDecoder([]byte(tt.in))
+		d.Strict()
+		if _, err = d.Decode(); !reflect.DeepEqual(err, strictErr) {
+			t.Errorf("#%d: strict: %v, want %v", i, err, strictErr)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package jsonx
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ChangeKind identifies the kind of a Change.
+type ChangeKind int
+
+const (
+	Added    ChangeKind = iota + 1 // present only in the new value
+	Removed                        // present only in the old value
+	Modified                       // present in both but not equal
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	}
+	return "unknown"
+}
+
+// Change describes a single difference found by Diff. Path consists of object keys (string) and
+// array indices (int) leading to the value. Old is nil for Added and New is nil for Removed.
+type Change struct {
+	Path     []interface{}
+	Kind     ChangeKind
+	Old, New interface{}
+}
+
+// Diff returns the differences between two decoded values, in the order of traversal (object keys
+// are visited in sorted order). Objects may be map[string]interface{} or *OrderedMap, the key order
+// of the latter is not significant. Objects are compared key by key and arrays element by element, elements
+// beyond the length of the shorter array are reported as added or removed. Other values are compared
+// with Equal.
+func Diff(a, b interface{}) []Change {
+	var changes []Change
+	diff(a, b, nil, &changes)
+	return changes
+}
+
+func diff(a, b interface{}, path []interface{}, changes *[]Change) {
+	a, b = nilOrderedMap(a), nilOrderedMap(b)
+	switch a1 := a.(type) {
+	case map[string]interface{}, *OrderedMap:
+		if b1, ok := objectMap(b); ok {
+			m, _ := objectMap(a1)
+			diffMaps(m, b1, path, changes)
+			return
+		}
+	case []interface{}:
+		if b1, ok := b.([]interface{}); ok {
+			diffSlices(a1, b1, path, changes)
+			return
+		}
+	}
+	if !Equal(a, b) {
+		addChange(changes, path, Modified, a, b)
+	}
+}
+
+func diffMaps(a, b map[string]interface{}, path []interface{}, changes *[]Change) {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, exists := a[k]; !exists {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		va, inA := a[k]
+		vb, inB := b[k]
+		p := append(path, k)
+		switch {
+		case !inA:
+			addChange(changes, p, Added, nil, vb)
+		case !inB:
+			addChange(changes, p, Removed, va, nil)
+		default:
+			diff(va, vb, p, changes)
+		}
+	}
+}
+
+func diffSlices(a, b []interface{}, path []interface{}, changes *[]Change) {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		p := append(path, i)
+		switch {
+		case i >= len(a):
+			addChange(changes, p, Added, nil, b[i])
+		case i >= len(b):
+			addChange(changes, p, Removed, a[i], nil)
+		default:
+			diff(a[i], b[i], p, changes)
+		}
+	}
+}
+
+func addChange(changes *[]Change, path []interface{}, kind ChangeKind, old, new interface{}) {
+	// path is reused during the traversal
+	p := make([]interface{}, len(path))
+	copy(p, path)
+	*changes = append(*changes, Change{Path: p, Kind: kind, Old: old, New: new})
+}
+
+// Equal reports whether two decoded values are semantically equal. Objects and arrays are compared
+// recursively, time.Time, net.IP and IP/port values are compared by what they represent rather than by
+// their internal representation (IP/port values may be net.TCPAddr or net.UDPAddr, by value or by
+// pointer, since they are encoded the same way), CIDR blocks and regular expressions by their textual
+// form and numbers (float64, json.Number and RawNumber) by their value. Objects may be
+// map[string]interface{} or *OrderedMap, the key order of the latter is not significant. Integer types
+// are only equal to the same type, i.e. int(1) is not equal to 1.
+func Equal(a, b interface{}) bool {
+	a, b = nilOrderedMap(a), nilOrderedMap(b)
+	switch a1 := a.(type) {
+	case map[string]interface{}, *OrderedMap:
+		m, _ := objectMap(a1)
+		b1, ok := objectMap(b)
+		if !ok || len(m) != len(b1) {
+			return false
+		}
+		for k, va := range m {
+			vb, exists := b1[k]
+			if !exists || !Equal(va, vb) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b1, ok := b.([]interface{})
+		if !ok || len(a1) != len(b1) {
+			return false
+		}
+		for i := range a1 {
+			if !Equal(a1[i], b1[i]) {
+				return false
+			}
+		}
+		return true
+	case time.Time:
+		b1, ok := b.(time.Time)
+		return ok && a1.Equal(b1)
+	case net.IP:
+		b1, ok := b.(net.IP)
+		return ok && a1.Equal(b1)
+	case net.TCPAddr, *net.TCPAddr, net.UDPAddr, *net.UDPAddr:
+		ipA, portA, zoneA, okA := ipPort(a)
+		ipB, portB, zoneB, okB := ipPort(b)
+		return okA && okB && ipA.Equal(ipB) && portA == portB && zoneA == zoneB
+	case *net.IPNet, net.IPNet:
+		nA, okA := ipNet(a)
+		nB, okB := ipNet(b)
+		return okA && okB && nA.String() == nB.String()
+	case *regexp.Regexp:
+		b1, ok := b.(*regexp.Regexp)
+		return ok && (a1 == nil) == (b1 == nil) && (a1 == nil || a1.String() == b1.String())
+	case []byte:
+		b1, ok := b.([]byte)
+		return ok && bytes.Equal(a1, b1)
+	case float64, json.Number, RawNumber:
+		fa, okA := numberValue(a)
+		fb, okB := numberValue(b)
+		return okA && okB && fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// ipPort returns the address of an IP/port value of any of the types written as ipport(...)
+func ipPort(v interface{}) (ip net.IP, port int, zone string, ok bool) {
+	switch v := v.(type) {
+	case net.TCPAddr:
+		return v.IP, v.Port, v.Zone, true
+	case *net.TCPAddr:
+		if v != nil {
+			return v.IP, v.Port, v.Zone, true
+		}
+	case net.UDPAddr:
+		return v.IP, v.Port, v.Zone, true
+	case *net.UDPAddr:
+		if v != nil {
+			return v.IP, v.Port, v.Zone, true
+		}
+	}
+	return nil, 0, "", false
+}
+
+// ipNet returns the value of a CIDR block given by value or by pointer
+func ipNet(v interface{}) (*net.IPNet, bool) {
+	switch v := v.(type) {
+	case *net.IPNet:
+		return v, v != nil
+	case net.IPNet:
+		return &v, true
+	}
+	return nil, false
+}
+
+// numberValue returns the value of a float64, json.Number or RawNumber
+func numberValue(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := strconv.ParseFloat(string(v), 64)
+		return f, err == nil
+	case RawNumber:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
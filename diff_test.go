@@ -0,0 +1,82 @@
+package jsonx
+
+import (
+	"net"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	a, err := Decode([]byte(`{
+		name: "svc", port: 80, removed: true, same: [1, 2],
+		nested: {list: [1, {x: 1}, 3], host: ip("10.0.0.1"), ts: datetime("2017-12-25T15:00:00Z")}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Decode([]byte(`{
+		name: "svc", port: 8080, added: null, same: [1, 2],
+		nested: {list: [1, {x: 2}], host: ip("::ffff:10.0.0.1"), ts: datetime("2017-12-25T17:00:00+02:00")}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := Diff(a, b)
+	expected := []Change{
+		{Path: []interface{}{"added"}, Kind: Added, New: nil},
+		{Path: []interface{}{"nested", "list", 1, "x"}, Kind: Modified, Old: 1.0, New: 2.0},
+		{Path: []interface{}{"nested", "list", 2}, Kind: Removed, Old: 3.0},
+		{Path: []interface{}{"port"}, Kind: Modified, Old: 80.0, New: 8080.0},
+		{Path: []interface{}{"removed"}, Kind: Removed, Old: true},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("Unexpected changes: %#v", changes)
+	}
+
+	if changes := Diff(a, a); changes != nil {
+		t.Fatalf("Unexpected changes: %#v", changes)
+	}
+
+	changes = Diff(map[string]interface{}{"a": []interface{}{1.0}}, map[string]interface{}{"a": "x"})
+	expected = []Change{{Path: []interface{}{"a"}, Kind: Modified, Old: []interface{}{1.0}, New: "x"}}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("Unexpected changes: %#v", changes)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	for i, tt := range []struct {
+		a, b  interface{}
+		equal bool
+	}{
+		{a: 1.0, b: RawNumber("1.00"), equal: true},
+		{a: 1.0, b: 1, equal: false},
+		{a: int64(5), b: int64(5), equal: true},
+		{a: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), b: time.Date(2017, 1, 1, 2, 0, 0, 0, time.FixedZone("", 7200)), equal: true},
+		{a: net.IPv4(1, 2, 3, 4), b: net.IPv4(1, 2, 3, 4).To4(), equal: true},
+		{a: net.TCPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1}, b: net.TCPAddr{IP: net.IPv4(1, 2, 3, 4).To4(), Port: 2}, equal: false},
+		{a: net.TCPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1}, b: &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4).To4(), Port: 1}, equal: true},
+		{a: net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1}, b: (*net.TCPAddr)(nil), equal: false},
+		{a: mustParseCIDR("10.0.0.0/8"), b: *mustParseCIDR("10.0.0.0/8"), equal: true},
+		{a: mustParseCIDR("10.0.0.0/8"), b: mustParseCIDR("10.0.0.0/16"), equal: false},
+		{a: regexp.MustCompile("a+"), b: regexp.MustCompile("a+"), equal: true},
+		{a: regexp.MustCompile("a+"), b: regexp.MustCompile("a*"), equal: false},
+		{a: []byte{1}, b: []byte{1}, equal: true},
+		{a: map[string]interface{}{"a": nil}, b: map[string]interface{}{"b": nil}, equal: false},
+		{a: []interface{}{"a"}, b: []interface{}{"a", "b"}, equal: false},
+	} {
+		if eq := Equal(tt.a, tt.b); eq != tt.equal {
+			t.Errorf("#%d: %v, want %v", i, eq, tt.equal)
+		}
+	}
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
@@ -3,14 +3,24 @@ package jsonx
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"sort"
 	"strconv"
+	"strings"
 	"reflect"
+	"regexp"
+	"sync"
 	"time"
+	"unicode/utf16"
+	"unicode/utf8"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding"
+	"database/sql/driver"
 )
 
 const (
@@ -18,6 +28,15 @@ const (
 	MIN_SAFE_INTEGER = -(1<<53 - 1)
 )
 
+const hexDigits = "0123456789abcdef"
+
+var (
+	stringType  = reflect.TypeOf("")
+	intType     = reflect.TypeOf(0)
+	int64Type   = reflect.TypeOf(int64(0))
+	float64Type = reflect.TypeOf(0.0)
+)
+
 type writer interface {
 	io.Writer
 	io.ByteWriter
@@ -34,13 +53,90 @@ type memWriter struct {
 	bytes.Buffer
 }
 
+// bufferedWriter is used for writers that do not implement writer, w is the underlying writer
+type bufferedWriter struct {
+	*bufio.Writer
+	w io.Writer
+}
+
+// Marshaler is implemented by types that can encode themselves as JSONX. The output must be a single
+// valid JSONX value, it is written as is, except for the JSON compatible (see Encoder.CompatJSON) and the
+// canonical (see MarshalCanonical) output, for which it is decoded and encoded again.
+//
+// When encoding a value the first applicable of the following is used: Marshaler, the built-in encoding
+// of the value's type (e.g. time.Time or net.IP, also behind a pointer), encoding.TextMarshaler (written as
+// a string), encoding.BinaryMarshaler (written as bytes(...)), driver.Valuer (the returned value is
+// written, so that e.g. an invalid sql.NullString becomes null) and finally the encoding based on the
+// value's kind. In the latter case non-nil pointers are followed, i.e. the value pointed to goes through
+// the same steps, and nil ones are written as null.
+type Marshaler interface {
+	MarshalJSONX() ([]byte, error)
+}
+
 type Encoder struct {
 	w              writer
 	base64Encoder  io.WriteCloser
 	pretty         bool
 	prefix, indent string
+	unsorted       bool
+	escapeHTML     bool
+	compat         bool
+	rawStrings     bool
+	terminator     string
+	timeLayout     string
+	bytesFormat    BytesFormat
+	ipv4Mapped     bool
+	canonical      bool
+	extendedKeys   bool
+	quoteKeys      bool
+	escapeUnicode  bool
+	omitNull       bool
+	scratch        [32]byte // for formatting numbers
+	escapeSlash    bool
+	errorsAsString bool
+	unquotedInts   bool
+	bareInts       bool
+	maxWidth       int
+	resolveFuncs   bool
+	limiter        *limitWriter
+	typeEncoders   map[reflect.Type]func(e *Encoder, v interface{}) error
+
+	level    int
+	inline   bool         // writing a container on a single line, see SetMaxLineWidth
+	keyWidth int          // width of the key preceding the value being written, see fitsInline
+	hookType reflect.Type // type of the value being written by its type encoder, see SetTypeEncoder
+}
+
+// appendWriter appends to a byte slice
+type appendWriter struct {
+	buf []byte
+}
+
+func (w *appendWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+func (w *appendWriter) WriteByte(c byte) error {
+	w.buf = append(w.buf, c)
+	return nil
+}
 
-	level int
+func (w *appendWriter) WriteString(s string) (int, error) {
+	w.buf = append(w.buf, s...)
+	return len(s), nil
+}
+
+func (w *appendWriter) WriteRune(r rune) (int, error) {
+	n := len(w.buf)
+	w.buf = append(w.buf, make([]byte, utf8.UTFMax)...)
+	size := utf8.EncodeRune(w.buf[n:], r)
+	w.buf = w.buf[:n+size]
+	return size, nil
+}
+
+func (*appendWriter) Flush() error {
+	return nil
 }
 
 func (noopFlusher) Flush() error {
@@ -51,11 +147,16 @@ func (*memWriter) Flush() error {
 	return nil
 }
 
+// discard drops the output that has not been flushed yet
+func (w bufferedWriter) discard() {
+	w.Reset(w.w)
+}
+
 func newWriter(w io.Writer) writer {
 	if w1, ok := w.(writer); ok {
 		return noopFlusher{w1}
 	} else {
-		return bufio.NewWriter(w)
+		return bufferedWriter{bufio.NewWriter(w), w}
 	}
 }
 
@@ -74,6 +175,182 @@ func NewEncoderIndent(w io.Writer, prefix, indent string) *Encoder {
 	}
 }
 
+// SetIndent enables pretty-printing, each element of an array or an object begins on a new line
+// starting with prefix followed by one or more copies of indent according to the nesting depth.
+func (e *Encoder) SetIndent(prefix, indent string) {
+	e.pretty = true
+	e.prefix = prefix
+	e.indent = indent
+}
+
+// SetMaxLineWidth makes pretty-printing (see SetIndent) write an array or an object on a single line,
+// e.g. [1, 2, 3] or {a: 1, b: 2}, if the line including the prefix, the indentation and the key fits within
+// n bytes. Otherwise each element begins on a new line as usual and the same applies to nested arrays and
+// objects. Zero (the default) means every non-empty element begins on a new line.
+func (e *Encoder) SetMaxLineWidth(n int) {
+	e.maxWidth = n
+}
+
+// OmitIntegerTypeTags controls whether the integer types (int, int8, uint16 etc.) are written as plain
+// numbers, e.g. 5 instead of int8(5), provided the value can be represented exactly as a JavaScript number
+// (see MAX_SAFE_INTEGER). Other values are written as usual (see QuoteLargeIntegers). This is lossy: plain
+// numbers are decoded as float64, so the type is not preserved. It is disabled by default.
+func (e *Encoder) OmitIntegerTypeTags(omit bool) {
+	e.bareInts = omit
+}
+
+// SetTypeEncoder makes the Encoder call fn to encode the values of type t, taking precedence over any other
+// encoding of the type including Marshaler. fn should write exactly one value using EncodeValue, typically
+// a value of a different type, e.g. a string. Values of type t written by fn are encoded as if there was no
+// type encoder for t. A nil fn removes the encoder for t.
+func (e *Encoder) SetTypeEncoder(t reflect.Type, fn func(e *Encoder, v interface{}) error) {
+	if fn == nil {
+		delete(e.typeEncoders, t)
+		return
+	}
+	if e.typeEncoders == nil {
+		e.typeEncoders = make(map[reflect.Type]func(e *Encoder, v interface{}) error)
+	}
+	e.typeEncoders[t] = fn
+}
+
+// SetMaxOutputBytes limits the output of each call to Encode (including the terminator) to n bytes. Once the
+// limit would be exceeded Encode stops and returns ErrOutputTooLarge. The output written so far is incomplete
+// and, unless the Encoder writes to an in-memory buffer (e.g. bytes.Buffer), part of it may have already been
+// flushed to the underlying writer, the rest is discarded. Zero or a negative n (the default) means no limit.
+func (e *Encoder) SetMaxOutputBytes(n int) {
+	if e.limiter != nil {
+		e.w = e.limiter.writer
+		e.limiter = nil
+	}
+	if n > 0 {
+		e.limiter = &limitWriter{writer: e.w, max: n}
+		e.w = e.limiter
+	}
+	// it may wrap the previous writer
+	e.base64Encoder = nil
+}
+
+// ResolveFuncs controls whether values of type func() interface{} and func() (interface{}, error) are called
+// and the result is encoded in their place, which allows computing values lazily. A nil function is written
+// as null. An error returned by a function stops the encoding and is returned by Encode as is, in which case
+// the output may be incomplete. The functions are called while encoding, so they must not use the Encoder
+// themselves, and may be called more than once for the same output if SetMaxLineWidth is used. A function
+// may return another function, which is resolved in turn. If disabled (the default) functions cannot be
+// encoded.
+func (e *Encoder) ResolveFuncs(resolve bool) {
+	e.resolveFuncs = resolve
+}
+
+// SortKeys controls whether object keys are written in sorted order (the default). If disabled, the keys
+// of an OrderedMap are written in its order and those of other maps in the map iteration order, which
+// is not stable. Use OrderedMap (see Decoder.PreserveKeyOrder) for a reproducible unsorted output.
+func (e *Encoder) SortKeys(sort bool) {
+	e.unsorted = !sort
+}
+
+// EscapeHTML controls whether '<', '>' and '&' are escaped in strings, so that the output is safe
+// to embed in HTML. It is disabled by default.
+func (e *Encoder) EscapeHTML(escape bool) {
+	e.escapeHTML = escape
+}
+
+// CompatJSON makes the Encoder produce standard JSON: keys are always quoted, integer types are written
+// as plain numbers and time.Time, time.Duration, net.IP, IP/port pairs, CIDR blocks, regular expressions
+// and []byte are written as strings (RFC3339, time.Duration.String, textual address or block, the pattern
+// and base64 or hex respectively).
+func (e *Encoder) CompatJSON(compat bool) {
+	e.compat = compat
+}
+
+// RawStrings controls whether strings that contain newlines or several characters requiring escaping
+// are written as raw strings ("""...""", see Decoder.AllowRawStrings). Strings that cannot be represented
+// verbatim (e.g. containing """ or control characters) are always written with escapes. It has no effect
+// in JSON compatibility mode.
+func (e *Encoder) RawStrings(raw bool) {
+	e.rawStrings = raw
+}
+
+// SetTerminator sets a string that is written after each value passed to Encode, e.g. "\n" to produce
+// newline-delimited records. It is empty by default.
+func (e *Encoder) SetTerminator(terminator string) {
+	e.terminator = terminator
+}
+
+// SetDateTimeLayout sets the layout used to format time.Time values (see time.Time.Format). The default,
+// time.RFC3339, drops sub-second precision, use time.RFC3339Nano to preserve it. Note that the Decoder
+// only accepts RFC3339 datetime values (with or without fractional seconds).
+func (e *Encoder) SetDateTimeLayout(layout string) {
+	e.timeLayout = layout
+}
+
+// BytesFormat is the encoding of []byte values, see Encoder.SetBytesFormat.
+type BytesFormat int
+
+const (
+	Base64 BytesFormat = iota // bytes("3q2+7w==")
+	Hex                       // hex("deadbeef")
+)
+
+// SetBytesFormat sets the encoding of []byte values, Base64 (the default) or Hex. In JSON compatibility mode
+// the values are written as strings in the same encoding.
+func (e *Encoder) SetBytesFormat(format BytesFormat) {
+	e.bytesFormat = format
+}
+
+// PreserveIPv4Mapped controls whether 16-byte net.IP values holding an IPv4-mapped address are written
+// in the ::ffff:a.b.c.d form rather than as plain IPv4 (the default). Note that net.IPv4 and net.ParseIP
+// return 16-byte values, use To4 to obtain the 4-byte form. See also Decoder.PreserveIPv4Mapped.
+func (e *Encoder) PreserveIPv4Mapped(preserve bool) {
+	e.ipv4Mapped = preserve
+}
+
+// ExtendedKeys controls whether object keys consisting of letters, digits, '_', '-' and '.' (e.g. 2fa or
+// x-api-key) are written unquoted. The output can only be decoded with Decoder.AllowExtendedKeys.
+// By default only identifiers are written unquoted.
+func (e *Encoder) ExtendedKeys(extended bool) {
+	e.extendedKeys = extended
+}
+
+// QuoteKeys controls whether object keys are always written as quoted strings. Unlike CompatJSON it does
+// not affect values, i.e. the typed atoms are still used.
+func (e *Encoder) QuoteKeys(quote bool) {
+	e.quoteKeys = quote
+}
+
+// EscapeUnicode controls whether all characters above U+007E are written as \uXXXX escapes (using
+// surrogate pairs for characters outside the Basic Multilingual Plane), so that the output is pure ASCII.
+// It is disabled by default.
+func (e *Encoder) EscapeUnicode(escape bool) {
+	e.escapeUnicode = escape
+}
+
+// OmitNull controls whether map entries with nil values are left out. It is disabled by default.
+func (e *Encoder) OmitNull(omit bool) {
+	e.omitNull = omit
+}
+
+// EscapeSlash controls whether '/' is written as \/ in strings, which allows embedding the output in
+// an HTML <script> element as it cannot contain "</script>". Raw strings (see RawStrings) are not used
+// for strings containing '/'. It is disabled by default.
+func (e *Encoder) EscapeSlash(escape bool) {
+	e.escapeSlash = escape
+}
+
+// EncodeErrorsAsString controls whether values implementing the error interface are written as the
+// string returned by their Error method. It only applies to values that have no other encoding (see
+// Marshaler). It is disabled by default, i.e. such values result in an error.
+func (e *Encoder) EncodeErrorsAsString(enable bool) {
+	e.errorsAsString = enable
+}
+
+// QuoteLargeIntegers controls whether int64 and uint64 values outside of the range of integers that
+// can be represented exactly as a JavaScript number (see MAX_SAFE_INTEGER) are quoted, e.g.
+// int64("9007199254740993"). It is enabled by default. The decoder accepts both forms.
+func (e *Encoder) QuoteLargeIntegers(quote bool) {
+	e.unquotedInts = !quote
+}
+
 func Marshal(v interface{}) ([]byte, error) {
 	var w memWriter
 	e := Encoder{w: &w}
@@ -84,6 +361,68 @@ func Marshal(v interface{}) ([]byte, error) {
 	return w.Bytes(), nil
 }
 
+// MarshalCanonical returns the canonical encoding of v: the output is byte-for-byte identical for
+// semantically equal values, which makes it suitable for hashing. In addition to what Marshal does
+// (sorted keys, no whitespace) the following normalizations are applied:
+//
+//	json.Number and RawNumber values are written as the equivalent float64 (e.g. 1.0, 1e0 and 1 all become 1)
+//	negative zero is written as 0
+//	time.Time values are converted to UTC and written as RFC3339, sub-second precision is dropped
+//	IP addresses are written as returned by net.IP.String, so IPv4-mapped addresses become plain IPv4
+//
+// Integer types are preserved, i.e. int(1) and 1 have different encodings.
+func MarshalCanonical(v interface{}) ([]byte, error) {
+	var w memWriter
+	e := Encoder{w: &w, canonical: true}
+	err := e.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// MarshalAppend appends the encoding of v to dst and returns the extended slice. Reusing the result
+// as dst for subsequent calls avoids allocations once it has grown large enough.
+func MarshalAppend(dst []byte, v interface{}) ([]byte, error) {
+	w := appendWriter{buf: dst}
+	e := Encoder{w: &w}
+	err := e.Encode(v)
+	if err != nil {
+		return dst, err
+	}
+	return w.buf, nil
+}
+
+// RoundTrip decodes data with the default Decoder settings and encodes the result like Marshal does, except
+// that datetime values keep their sub-second precision (see SetDateTimeLayout). Decoding the output yields a
+// value Equal to the one decoded from data. Decoding errors are returned as is, including ExtraDataError.
+func RoundTrip(data []byte) ([]byte, error) {
+	v, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	var w memWriter
+	e := Encoder{w: &w, timeLayout: time.RFC3339Nano}
+	if err = e.Encode(v); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// MarshalMap is the same as Marshal but it only accepts maps. Unlike map[string]interface{} which is
+// the type Decode returns for objects, maps of other types are encoded using reflection, which requires
+// the keys to be strings (or of a type based on string).
+func MarshalMap(m interface{}) ([]byte, error) {
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Map {
+		return nil, fmt.Errorf("MarshalMap: argument of type %T is not a map", m)
+	}
+	if k := v.Type().Key(); k.Kind() != reflect.String {
+		return nil, fmt.Errorf("MarshalMap: unsupported map key type %s", k)
+	}
+	return Marshal(m)
+}
+
 func MarshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
 	var w memWriter
 	e := Encoder{w: &w, pretty: true, prefix: prefix, indent: indent}
@@ -94,27 +433,228 @@ func MarshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
 	return w.Bytes(), nil
 }
 
+// countWriter discards the output and counts the bytes. If max is positive writing more than max bytes
+// fails with errTooLong.
+type countWriter struct {
+	n, max int
+}
+
+var errTooLong = errors.New("output too long")
+
+func (w *countWriter) add(n int) error {
+	w.n += n
+	if w.max > 0 && w.n > w.max {
+		return errTooLong
+	}
+	return nil
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	return len(p), w.add(len(p))
+}
+
+func (w *countWriter) WriteByte(byte) error {
+	return w.add(1)
+}
+
+func (w *countWriter) WriteString(s string) (int, error) {
+	return len(s), w.add(len(s))
+}
+
+func (w *countWriter) WriteRune(r rune) (int, error) {
+	size := utf8.RuneLen(r)
+	if size == -1 {
+		// written as utf8.RuneError
+		size = 3
+	}
+	return size, w.add(size)
+}
+
+func (*countWriter) Flush() error {
+	return nil
+}
+
+// limitWriter fails with ErrOutputTooLarge once more than max bytes are written, see SetMaxOutputBytes.
+// The write that exceeds the limit is discarded entirely.
+type limitWriter struct {
+	writer
+	n, max int
+}
+
+func (w *limitWriter) add(n int) error {
+	if w.n+n > w.max {
+		return ErrOutputTooLarge
+	}
+	w.n += n
+	return nil
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if err := w.add(len(p)); err != nil {
+		return 0, err
+	}
+	return w.writer.Write(p)
+}
+
+func (w *limitWriter) WriteByte(c byte) error {
+	if err := w.add(1); err != nil {
+		return err
+	}
+	return w.writer.WriteByte(c)
+}
+
+func (w *limitWriter) WriteString(s string) (int, error) {
+	if err := w.add(len(s)); err != nil {
+		return 0, err
+	}
+	return w.writer.WriteString(s)
+}
+
+func (w *limitWriter) WriteRune(r rune) (int, error) {
+	size := utf8.RuneLen(r)
+	if size == -1 {
+		// written as utf8.RuneError
+		size = 3
+	}
+	if err := w.add(size); err != nil {
+		return 0, err
+	}
+	return w.writer.WriteRune(r)
+}
+
+// EncodedLen returns the length of the encoding of v, i.e. len(Marshal(v)), without producing the output.
+func EncodedLen(v interface{}) (int, error) {
+	var e Encoder
+	return e.EncodedLen(v)
+}
+
+// EncodedLen returns the number of bytes Encode(v) would write with the current options, including
+// the indentation and the terminator, if set. Nothing is written to the underlying writer.
+func (e *Encoder) EncodedLen(v interface{}) (int, error) {
+	var w countWriter
+	c := *e
+	c.w = &w
+	c.base64Encoder = nil
+	c.limiter = nil
+	if err := c.Encode(v); err != nil {
+		return 0, err
+	}
+	return w.n, nil
+}
+
+// pooledEncoder is an Encoder together with its output buffer, kept in encoderPool between calls
+type pooledEncoder struct {
+	w memWriter
+	e Encoder
+}
+
+// maxPooledBuffer is the largest buffer capacity returned to encoderPool, so that a single large value does
+// not keep a lot of memory around
+const maxPooledBuffer = 64 << 10
+
+var encoderPool = sync.Pool{
+	New: func() interface{} {
+		return new(pooledEncoder)
+	},
+}
+
+// marshalPooled encodes v using an Encoder from encoderPool, with the state reset to the defaults except for
+// the formatting parameters.
+func marshalPooled(v interface{}, pretty bool, indent string) ([]byte, error) {
+	p := encoderPool.Get().(*pooledEncoder)
+	p.w.Reset()
+	// the base64 encoder writes to p.w, so it can be reused as well
+	p.e = Encoder{w: &p.w, base64Encoder: p.e.base64Encoder, pretty: pretty, indent: indent}
+	err := p.e.Encode(v)
+	var b []byte
+	if err == nil {
+		// the buffer goes back to the pool, so the output must be copied
+		b = append([]byte(nil), p.w.Bytes()...)
+	}
+	if p.w.Cap() <= maxPooledBuffer {
+		encoderPool.Put(p)
+	}
+	return b, err
+}
+
+// MarshalCompact returns the same encoding of v as Marshal, but reuses pooled encoders and their buffers
+// between calls, so that the only allocation for a typical value is the returned slice. It is safe for
+// concurrent use.
+func MarshalCompact(v interface{}) ([]byte, error) {
+	return marshalPooled(v, false, "")
+}
+
+// MarshalPretty is like MarshalCompact but returns the same output as MarshalIndent(v, "", "  ").
+func MarshalPretty(v interface{}) ([]byte, error) {
+	return marshalPooled(v, true, "  ")
+}
+
 func (e *Encoder) Encode(v interface{}) error {
+	if e.limiter != nil {
+		e.limiter.n = 0
+	}
 	err := e.encodeValue(v)
+	if err == nil && e.terminator != "" {
+		_, err = e.w.WriteString(e.terminator)
+	}
 	if err != nil {
+		e.discard()
 		return err
 	}
 
 	return e.w.Flush()
 }
 
+// discard drops the incomplete output of a failed Encode so that it is not written in front of the next
+// value. The base64 encoder is dropped as well as it may hold a write error.
+func (e *Encoder) discard() {
+	w := e.w
+	if e.limiter != nil {
+		w = e.limiter.writer
+	}
+	if b, ok := w.(bufferedWriter); ok {
+		b.discard()
+	}
+	e.base64Encoder = nil
+}
+
+// EncodeValue writes v like Encode does, but without the terminator and without flushing the output. It is
+// meant to be used by the functions set with SetTypeEncoder.
+func (e *Encoder) EncodeValue(v interface{}) error {
+	return e.encodeValue(v)
+}
+
 func (e *Encoder) encodeValue(v interface{}) (err error) {
+	if e.typeEncoders != nil && v != nil {
+		if t := reflect.TypeOf(v); t != e.hookType {
+			if fn := e.typeEncoders[t]; fn != nil {
+				prev := e.hookType
+				e.hookType = t
+				err = fn(e, v)
+				e.hookType = prev
+				return
+			}
+		}
+	}
 	switch v := v.(type) {
+	case Marshaler:
+		err = e.encodeMarshaler(v)
 	case string:
-		err = e.encodeString(v)
+		err = e.encodeStringValue(v)
 	case map[string]interface{}:
 		err = e.encodeMap(v)
+	case *OrderedMap:
+		err = e.encodeOrderedMap(v)
 	case []interface{}:
 		err = e.encodeArray(v)
 	case []byte:
 		err = e.encodeBytes(v)
 	case int:
 		err = e.encodeInt(v)
+	case json.Number:
+		err = e.encodeNumber(v)
+	case RawNumber:
+		err = e.encodeRawNumber(v)
 	case nil:
 		_, err = e.w.WriteString("null")
 	case bool:
@@ -125,15 +665,31 @@ func (e *Encoder) encodeValue(v interface{}) (err error) {
 		}
 	case time.Time:
 		err = e.encodeTime(v)
+	case time.Duration:
+		err = e.encodeDuration(v)
 	case net.IP:
 		err = e.encodeIP(v)
+	case *net.IPNet:
+		err = e.encodeCIDR(v)
+	case net.IPNet:
+		err = e.encodeCIDR(&v)
+	case *regexp.Regexp:
+		err = e.encodeRegexp(v)
 	case net.TCPAddr:
 		err = e.encodeIPPort(v.IP, v.Port)
 	case *net.TCPAddr:
+		if v == nil {
+			err = e.encodeNull()
+			break
+		}
 		err = e.encodeIPPort(v.IP, v.Port)
 	case net.UDPAddr:
 		err = e.encodeIPPort(v.IP, v.Port)
 	case *net.UDPAddr:
+		if v == nil {
+			err = e.encodeNull()
+			break
+		}
 		err = e.encodeIPPort(v.IP, v.Port)
 	case uint:
 		err = e.encodeUInt(v)
@@ -155,10 +711,38 @@ func (e *Encoder) encodeValue(v interface{}) (err error) {
 		err = e.encodeUInt16(v)
 	case float64:
 		err = e.encodeFloat64(v)
+	case *time.Time, *net.IP:
+		// the pointers implement the marshalers below, but the built-in encoding of the value takes precedence
+		err = e.encodePointer(reflect.ValueOf(v))
+	case encoding.TextMarshaler:
+		err = e.encodeTextMarshaler(v)
+	case encoding.BinaryMarshaler:
+		err = e.encodeBinaryMarshaler(v)
+	case driver.Valuer:
+		err = e.encodeValuer(v)
+	case func() interface{}, func() (interface{}, error):
+		err = e.encodeFunc(v)
 	default:
+		if verr, ok := v.(error); ok && e.errorsAsString {
+			if isNilPointer(v) {
+				err = e.encodeNull()
+			} else {
+				err = e.encodeStringValue(verr.Error())
+			}
+			break
+		}
 		switch v1 := reflect.ValueOf(v); v1.Kind() {
 		case reflect.Slice:
+			if v1.Type().Elem().Kind() == reflect.Uint8 {
+				// named byte slice types, e.g. type Blob []byte, are written like []byte
+				err = e.encodeBytes(v1.Bytes())
+				break
+			}
 			err = e.encodeSlice(v1)
+		case reflect.Map:
+			err = e.encodeReflectMap(v1)
+		case reflect.Ptr, reflect.Interface:
+			err = e.encodePointer(v1)
 		default:
 			err = fmt.Errorf("Unsupported value type: %T", v)
 		}
@@ -167,168 +751,374 @@ func (e *Encoder) encodeValue(v interface{}) (err error) {
 	return
 }
 
-func (e *Encoder) encodeTime(t time.Time) error {
-	_, err := fmt.Fprintf(e.w, "datetime(\"%s\")", t.Format(time.RFC3339))
-	return err
+func (e *Encoder) encodeStringValue(v string) error {
+	if e.rawStrings && !e.compat && useRawString(v, e.escapeHTML, e.escapeUnicode, e.escapeSlash) {
+		return e.encodeRawString(v)
+	}
+	return e.encodeString(v)
 }
 
-func (e *Encoder) encodeIP(ip net.IP) error {
-	_, err := fmt.Fprintf(e.w, "ip(\"%s\")", ip.String())
+func (e *Encoder) encodeNull() error {
+	_, err := e.w.WriteString("null")
 	return err
 }
 
-func (e *Encoder) encodeIPPort(ip net.IP, port int) (err error) {
-	if ip4 := ip.To4(); ip4 != nil {
-		_, err = fmt.Fprintf(e.w, "ipport(\"%s:%d\")", ip4.String(), port)
-	} else {
-		_, err = fmt.Fprintf(e.w, "ipport(\"[%s]:%d\")", ip.String(), port)
+// encodePointer writes a typed nil pointer or interface as null, otherwise the value it points to is encoded
+// as if passed directly
+func (e *Encoder) encodePointer(v reflect.Value) error {
+	if v.IsNil() {
+		return e.encodeNull()
 	}
-
-	return
+	return e.encodeValue(v.Elem().Interface())
 }
 
-func (e *Encoder) encodeFloat64(v float64) error {
-	_, err := e.w.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
-	return err
+// isNilPointer returns true if v is a typed nil pointer. The methods of such values are not called, since
+// they are usually defined on the value type and would panic.
+func isNilPointer(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
 }
 
-func (e *Encoder) encodeInt(v int) error {
-	_, err := e.w.WriteString("int(")
-	if err != nil {
-		return err
+func (e *Encoder) encodeMarshaler(m Marshaler) error {
+	if isNilPointer(m) {
+		return e.encodeNull()
 	}
-	_, err = e.w.WriteString(strconv.Itoa(v))
+	b, err := m.MarshalJSONX()
 	if err != nil {
 		return err
 	}
-	return e.w.WriteByte(')')
-}
-
-func (e *Encoder) encodeUInt(v uint) error {
-	_, err := e.w.WriteString("uint(")
-	if err != nil {
-		return err
+	d := NewDecoder(b)
+	if e.compat || e.canonical {
+		// the typed atoms and the number literals in the output have to follow the mode
+		d.RawNumbers()
+		d.PreserveKeyOrder()
+		v, err := d.Decode()
+		if err != nil {
+			return fmt.Errorf("invalid output of MarshalJSONX for type %T: %v", m, err)
+		}
+		return e.encodeValue(v)
+	}
+	if err = d.Skip(); err == nil && d.skipSpaces() != 0 {
+		err = d.extraDataError()
 	}
-	_, err = e.w.WriteString(strconv.FormatUint(uint64(v), 10))
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid output of MarshalJSONX for type %T: %v", m, err)
 	}
-	return e.w.WriteByte(')')
+	_, err = e.w.Write(b)
+	return err
 }
 
-func (e *Encoder) encodeInt8(v int8) error {
-	_, err := e.w.WriteString("int8(")
-	if err != nil {
-		return err
+func (e *Encoder) encodeTextMarshaler(m encoding.TextMarshaler) error {
+	if isNilPointer(m) {
+		return e.encodeNull()
 	}
-	_, err = e.w.WriteString(strconv.FormatInt(int64(v), 10))
+	b, err := m.MarshalText()
 	if err != nil {
 		return err
 	}
-	return e.w.WriteByte(')')
+	return e.encodeValue(string(b))
 }
 
-func (e *Encoder) encodeInt16(v int16) error {
-	_, err := e.w.WriteString("int16(")
-	if err != nil {
-		return err
+func (e *Encoder) encodeBinaryMarshaler(m encoding.BinaryMarshaler) error {
+	if isNilPointer(m) {
+		return e.encodeNull()
 	}
-	_, err = e.w.WriteString(strconv.FormatInt(int64(v), 10))
+	b, err := m.MarshalBinary()
 	if err != nil {
 		return err
 	}
-	return e.w.WriteByte(')')
+	return e.encodeBytes(b)
 }
 
-func (e *Encoder) encodeInt32(v int32) error {
-	_, err := e.w.WriteString("int32(")
-	if err != nil {
-		return err
+func (e *Encoder) encodeValuer(v driver.Valuer) error {
+	if isNilPointer(v) {
+		return e.encodeNull()
 	}
-	_, err = e.w.WriteString(strconv.FormatInt(int64(v), 10))
+	val, err := v.Value()
 	if err != nil {
 		return err
 	}
-	return e.w.WriteByte(')')
+	if _, ok := val.(driver.Valuer); ok {
+		return fmt.Errorf("Value of type %T returned another driver.Valuer", v)
+	}
+	return e.encodeValue(val)
 }
 
-func (e *Encoder) encodeInt64(v int64) error {
-	_, err := e.w.WriteString("int64(")
-	if err != nil {
-		return err
+// encodeFunc calls fn and encodes the result, see ResolveFuncs
+func (e *Encoder) encodeFunc(fn interface{}) error {
+	if !e.resolveFuncs {
+		return fmt.Errorf("Unsupported value type: %T", fn)
 	}
-	if v > MAX_SAFE_INTEGER || v < MIN_SAFE_INTEGER {
-		err := e.w.WriteByte('"')
-		if err != nil {
-			return err
+	var v interface{}
+	switch fn := fn.(type) {
+	case func() interface{}:
+		if fn == nil {
+			return e.encodeNull()
 		}
-	}
-	_, err = e.w.WriteString(strconv.FormatInt(int64(v), 10))
-	if err != nil {
-		return err
-	}
-	if v > MAX_SAFE_INTEGER || v < MIN_SAFE_INTEGER {
-		err := e.w.WriteByte('"')
-		if err != nil {
+		v = fn()
+	case func() (interface{}, error):
+		if fn == nil {
+			return e.encodeNull()
+		}
+		var err error
+		if v, err = fn(); err != nil {
 			return err
 		}
 	}
-	return e.w.WriteByte(')')
+	return e.encodeValue(v)
 }
 
-func (e *Encoder) encodeUInt8(v uint8) error {
-	_, err := e.w.WriteString("uint8(")
-	if err != nil {
-		return err
+func (e *Encoder) encodeNumber(n json.Number) error {
+	if n == "" {
+		n = "0"
+	} else if !isValidNumber(string(n)) {
+		return fmt.Errorf("invalid number literal %q", string(n))
 	}
-	_, err = e.w.WriteString(strconv.FormatUint(uint64(v), 10))
-	if err != nil {
-		return err
+	if e.canonical {
+		return e.encodeNumberLiteral(string(n))
 	}
-	return e.w.WriteByte(')')
+	_, err := e.w.WriteString(string(n))
+	return err
 }
 
-func (e *Encoder) encodeUInt16(v uint16) error {
-	_, err := e.w.WriteString("uint16(")
-	if err != nil {
-		return err
+func (e *Encoder) encodeRawNumber(n RawNumber) error {
+	if !isValidNumber(string(n)) {
+		return fmt.Errorf("invalid number literal %q", string(n))
 	}
-	_, err = e.w.WriteString(strconv.FormatUint(uint64(v), 10))
-	if err != nil {
-		return err
+	if e.canonical {
+		return e.encodeNumberLiteral(string(n))
 	}
-	return e.w.WriteByte(')')
+	_, err := e.w.WriteString(string(n))
+	return err
 }
 
-func (e *Encoder) encodeUInt32(v uint32) error {
-	_, err := e.w.WriteString("uint32(")
-	if err != nil {
-		return err
-	}
-	_, err = e.w.WriteString(strconv.FormatUint(uint64(v), 10))
+// encodeNumberLiteral writes a valid number literal in the float64 form
+func (e *Encoder) encodeNumberLiteral(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
 	if err != nil {
 		return err
 	}
-	return e.w.WriteByte(')')
+	return e.encodeFloat64(f)
 }
 
-func (e *Encoder) encodeUInt64(v uint64) error {
-	_, err := e.w.WriteString("uint64(")
-	if err != nil {
-		return err
+// isValidNumber reports whether s is a valid JSON number literal
+func isValidNumber(s string) bool {
+	if s == "" {
+		return false
 	}
-	if v > MAX_SAFE_INTEGER {
-		err := e.w.WriteByte('"')
-		if err != nil {
-			return err
+	if s[0] == '-' {
+		s = s[1:]
+		if s == "" {
+			return false
 		}
 	}
-	_, err = e.w.WriteString(strconv.FormatUint(uint64(v), 10))
-	if err != nil {
-		return err
+
+	// digits
+	switch {
+	case s[0] == '0':
+		s = s[1:]
+	case '1' <= s[0] && s[0] <= '9':
+		s = s[1:]
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	default:
+		return false
 	}
-	if v > MAX_SAFE_INTEGER {
-		err := e.w.WriteByte('"')
+
+	// . followed by 1 or more digits
+	if len(s) >= 2 && s[0] == '.' && '0' <= s[1] && s[1] <= '9' {
+		s = s[2:]
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+
+	// e or E followed by an optional - or + and 1 or more digits
+	if len(s) >= 2 && (s[0] == 'e' || s[0] == 'E') {
+		s = s[1:]
+		if s[0] == '+' || s[0] == '-' {
+			s = s[1:]
+			if s == "" {
+				return false
+			}
+		}
+		if s[0] < '0' || s[0] > '9' {
+			return false
+		}
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+
+	return s == ""
+}
+
+func (e *Encoder) encodeTime(t time.Time) error {
+	layout := e.timeLayout
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	if e.canonical {
+		t = t.UTC()
+		layout = time.RFC3339
+	}
+	if e.compat {
+		return e.encodeString(t.Format(layout))
+	}
+	_, err := fmt.Fprintf(e.w, "datetime(\"%s\")", t.Format(layout))
+	return err
+}
+
+func (e *Encoder) encodeDuration(d time.Duration) error {
+	if e.compat {
+		return e.encodeString(d.String())
+	}
+	_, err := fmt.Fprintf(e.w, "duration(\"%s\")", d.String())
+	return err
+}
+
+func (e *Encoder) encodeIP(ip net.IP) error {
+	if e.compat {
+		return e.encodeString(e.ipString(ip))
+	}
+	_, err := fmt.Fprintf(e.w, "ip(\"%s\")", e.ipString(ip))
+	return err
+}
+
+func (e *Encoder) encodeCIDR(n *net.IPNet) error {
+	if n == nil {
+		return e.encodeNull()
+	}
+	if e.compat {
+		return e.encodeString(n.String())
+	}
+	_, err := fmt.Fprintf(e.w, "cidr(\"%s\")", n.String())
+	return err
+}
+
+func (e *Encoder) encodeRegexp(re *regexp.Regexp) error {
+	if re == nil {
+		return e.encodeNull()
+	}
+	if e.compat {
+		return e.encodeString(re.String())
+	}
+	_, err := e.w.WriteString("regexp(")
+	if err != nil {
+		return err
+	}
+	err = e.encodeString(re.String())
+	if err != nil {
+		return err
+	}
+	return e.w.WriteByte(')')
+}
+
+func (e *Encoder) encodeIPPort(ip net.IP, port int) (err error) {
+	if e.compat {
+		return e.encodeString(net.JoinHostPort(e.ipString(ip), strconv.Itoa(port)))
+	}
+	if e.isIPv4Mapped(ip) {
+		_, err = fmt.Fprintf(e.w, "ipport(\"[%s]:%d\")", e.ipString(ip), port)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		_, err = fmt.Fprintf(e.w, "ipport(\"%s:%d\")", ip4.String(), port)
+	} else {
+		_, err = fmt.Fprintf(e.w, "ipport(\"[%s]:%d\")", ip.String(), port)
+	}
+
+	return
+}
+
+// isIPv4Mapped returns true if ip should be written in the ::ffff:a.b.c.d form, see PreserveIPv4Mapped
+func (e *Encoder) isIPv4Mapped(ip net.IP) bool {
+	return e.ipv4Mapped && len(ip) == net.IPv6len && ip.To4() != nil
+}
+
+func (e *Encoder) ipString(ip net.IP) string {
+	if e.isIPv4Mapped(ip) {
+		return "::ffff:" + ip.To4().String()
+	}
+	return ip.String()
+}
+
+func (e *Encoder) encodeFloat64(v float64) error {
+	if e.canonical && v == 0 {
+		// negative zero
+		v = 0
+	}
+	_, err := e.w.Write(strconv.AppendFloat(e.scratch[:0], v, 'g', -1, 64))
+	return err
+}
+
+func (e *Encoder) encodeInt(v int) error {
+	return e.encodeInteger("int", strconv.AppendInt(e.scratch[:0], int64(v), 10), false)
+}
+
+func (e *Encoder) encodeUInt(v uint) error {
+	return e.encodeInteger("uint", strconv.AppendUint(e.scratch[:0], uint64(v), 10), false)
+}
+
+func (e *Encoder) encodeInt8(v int8) error {
+	return e.encodeInteger("int8", strconv.AppendInt(e.scratch[:0], int64(v), 10), false)
+}
+
+func (e *Encoder) encodeInt16(v int16) error {
+	return e.encodeInteger("int16", strconv.AppendInt(e.scratch[:0], int64(v), 10), false)
+}
+
+func (e *Encoder) encodeInt32(v int32) error {
+	return e.encodeInteger("int32", strconv.AppendInt(e.scratch[:0], int64(v), 10), false)
+}
+
+func (e *Encoder) encodeInt64(v int64) error {
+	return e.encodeInteger("int64", strconv.AppendInt(e.scratch[:0], v, 10), v > MAX_SAFE_INTEGER || v < MIN_SAFE_INTEGER)
+}
+
+func (e *Encoder) encodeUInt8(v uint8) error {
+	return e.encodeInteger("uint8", strconv.AppendUint(e.scratch[:0], uint64(v), 10), false)
+}
+
+func (e *Encoder) encodeUInt16(v uint16) error {
+	return e.encodeInteger("uint16", strconv.AppendUint(e.scratch[:0], uint64(v), 10), false)
+}
+
+func (e *Encoder) encodeUInt32(v uint32) error {
+	return e.encodeInteger("uint32", strconv.AppendUint(e.scratch[:0], uint64(v), 10), false)
+}
+
+func (e *Encoder) encodeUInt64(v uint64) error {
+	return e.encodeInteger("uint64", strconv.AppendUint(e.scratch[:0], v, 10), v > MAX_SAFE_INTEGER)
+}
+
+// encodeInteger writes an integer atom, e.g. int8(5). Values that can't be represented exactly
+// as a JavaScript number (unsafe) are quoted.
+func (e *Encoder) encodeInteger(typ string, digits []byte, unsafe bool) error {
+	if e.compat || e.bareInts && isSafeInteger(digits) {
+		_, err := e.w.Write(digits)
+		return err
+	}
+	unsafe = unsafe && !e.unquotedInts
+	_, err := e.w.WriteString(typ)
+	if err != nil {
+		return err
+	}
+	err = e.w.WriteByte('(')
+	if err != nil {
+		return err
+	}
+	if unsafe {
+		err = e.w.WriteByte('"')
+		if err != nil {
+			return err
+		}
+	}
+	_, err = e.w.Write(digits)
+	if err != nil {
+		return err
+	}
+	if unsafe {
+		err = e.w.WriteByte('"')
 		if err != nil {
 			return err
 		}
@@ -336,6 +1126,15 @@ func (e *Encoder) encodeUInt64(v uint64) error {
 	return e.w.WriteByte(')')
 }
 
+// isSafeInteger returns true if the decimal integer is between MIN_SAFE_INTEGER and MAX_SAFE_INTEGER
+func isSafeInteger(digits []byte) bool {
+	const max = "9007199254740991"
+	if len(digits) > 0 && digits[0] == '-' {
+		digits = digits[1:]
+	}
+	return len(digits) < len(max) || len(digits) == len(max) && string(digits) <= max
+}
+
 func (e *Encoder) writeIndent() error {
 	err := e.w.WriteByte('\n')
 	if err != nil {
@@ -356,39 +1155,147 @@ func (e *Encoder) writeIndent() error {
 	return nil
 }
 
-func (e *Encoder) encodeMap(m map[string]interface{}) error {
-	keys := make([]string, len(m))
-	i := 0
-	for key := range m {
-		keys[i] = key
-		i++
-	}
-	sort.Strings(keys)
-	e.w.WriteByte('{')
-	if e.pretty {
+// fitsInline returns true if the array or object written by encode fits on the current line (see
+// SetMaxLineWidth) when written inline. The output is measured by a dry run which stops as soon as the
+// width is exceeded.
+func (e *Encoder) fitsInline(encode func(c *Encoder) error) bool {
+	width := e.maxWidth - len(e.prefix) - e.level*len(e.indent) - e.keyWidth
+	e.keyWidth = 0
+	if width <= 0 {
+		return false
+	}
+	w := countWriter{max: width}
+	c := *e
+	c.w = &w
+	c.base64Encoder = nil
+	c.inline = true
+	return encode(&c) == nil
+}
+
+// measureKey sets keyWidth to the width of the key followed by ": "
+func (e *Encoder) measureKey(key string) {
+	var w countWriter
+	c := *e
+	c.w = &w
+	c.encodeKey(key)
+	e.keyWidth = w.n + 2
+}
+
+// beginContainer writes the opening bracket, wrap is true if the elements begin on new lines
+func (e *Encoder) beginContainer(open byte, wrap bool) error {
+	err := e.w.WriteByte(open)
+	if err != nil {
+		return err
+	}
+	if wrap {
 		e.level++
+		return e.writeIndent()
+	}
+	return nil
+}
+
+// writeSeparator writes the separator between two elements of a container
+func (e *Encoder) writeSeparator(wrap bool) error {
+	err := e.w.WriteByte(',')
+	if err != nil {
+		return err
+	}
+	if wrap {
+		return e.writeIndent()
+	}
+	if e.inline {
+		return e.w.WriteByte(' ')
+	}
+	return nil
+}
+
+// endContainer writes the closing bracket
+func (e *Encoder) endContainer(close byte, wrap bool) error {
+	if wrap {
+		e.level--
 		err := e.writeIndent()
 		if err != nil {
 			return err
 		}
 	}
+	return e.w.WriteByte(close)
+}
+
+func (e *Encoder) encodeMap(m map[string]interface{}) error {
+	keys := make([]string, 0, len(m))
+	for key, v := range m {
+		if v == nil && e.omitNull {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if !e.unsorted {
+		sort.Strings(keys)
+	}
+	return e.encodeObject(keys, m, nil)
+}
+
+func (e *Encoder) encodeOrderedMap(m *OrderedMap) error {
+	if m == nil {
+		return e.encodeNull()
+	}
+	keys := m.keys
+	if e.omitNull || !e.unsorted {
+		keys = make([]string, 0, len(m.keys))
+		for _, key := range m.keys {
+			if m.values[key] == nil && e.omitNull {
+				continue
+			}
+			keys = append(keys, key)
+		}
+		if !e.unsorted {
+			sort.Strings(keys)
+		}
+	}
+	var comments map[string]string
+	if e.pretty && !e.compat {
+		comments = m.comments
+	}
+	return e.encodeObject(keys, m.values, comments)
+}
+
+// encodeObject writes the keys and their values in the given order, comments are written before the keys
+// in pretty mode
+func (e *Encoder) encodeObject(keys []string, m map[string]interface{}, comments map[string]string) error {
+	if e.inline && len(comments) != 0 {
+		// fitsInline is measuring an enclosing container, which cannot be inlined without losing the comments
+		return errTooLong
+	}
+	if e.maxWidth > 0 && e.pretty && !e.inline && len(comments) == 0 &&
+		e.fitsInline(func(c *Encoder) error { return c.encodeObject(keys, m, nil) }) {
+		e.inline = true
+		defer func() { e.inline = false }()
+	}
+	wrap := e.pretty && !e.inline
+	err := e.beginContainer('{', wrap)
+	if err != nil {
+		return err
+	}
 	first := true
 	for _, k := range keys {
 		if !first {
-			err := e.w.WriteByte(',')
+			err := e.writeSeparator(wrap)
 			if err != nil {
 				return err
 			}
-			if e.pretty {
-				err = e.writeIndent()
-				if err != nil {
-					return err
-				}
-			}
 		} else {
 			first = false
 		}
+		if comment, ok := comments[k]; ok && wrap {
+			err := e.writeComment(comment)
+			if err != nil {
+				return err
+			}
+		}
 		v := m[k]
+		if wrap && e.maxWidth > 0 {
+			e.measureKey(k)
+		}
 		err := e.encodeKey(k)
 		if err != nil {
 			return err
@@ -407,64 +1314,106 @@ func (e *Encoder) encodeMap(m map[string]interface{}) error {
 		if err != nil {
 			return err
 		}
+		// not consumed by fitsInline if the value is not a container
+		e.keyWidth = 0
 	}
 
-	if e.pretty {
-		e.level--
-		err := e.writeIndent()
+	return e.endContainer('}', wrap)
+}
+
+// writeComment writes each line of the comment as a // comment followed by a new line
+func (e *Encoder) writeComment(comment string) error {
+	for _, line := range strings.Split(strings.TrimSuffix(comment, "\n"), "\n") {
+		_, err := e.w.WriteString("//")
+		if err != nil {
+			return err
+		}
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			_, err = e.w.WriteString(" " + line)
+			if err != nil {
+				return err
+			}
+		}
+		err = e.writeIndent()
 		if err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	return e.w.WriteByte('}')
+// encodeReflectMap encodes a map of a type other than map[string]interface{}
+func (e *Encoder) encodeReflectMap(m reflect.Value) error {
+	if k := m.Type().Key(); k.Kind() != reflect.String {
+		return fmt.Errorf("Unsupported map key type: %s", k)
+	}
+	values := make(map[string]interface{}, m.Len())
+	for _, k := range m.MapKeys() {
+		values[k.String()] = m.MapIndex(k).Interface()
+	}
+	return e.encodeMap(values)
 }
 
+// encodeKey writes an object key. It is quoted unless it is an identifier (or an extended key, see
+// ExtendedKeys) and therefore cannot contain separators, brackets, whitespace or be empty.
 func (e *Encoder) encodeKey(key string) error {
-	if len(key) > 0 {
-		if c := key[0]; c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
-			for i := 1; i < len(key); i++ {
-				if c := key[i]; c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
-
-				} else {
-					goto notatom
-				}
-			}
+	if e.quoteKeys {
+		return e.encodeString(key)
+	}
+	if e.extendedKeys && !e.compat && isExtendedKey(key) {
+		_, err := e.w.WriteString(key)
+		return err
+	}
+	if !e.compat && isAtomKey(key) {
+		_, err := e.w.WriteString(key)
+		return err
+	}
+	return e.encodeString(key)
+}
 
-			_, err := e.w.WriteString(key)
-			return err
+// isAtomKey returns true if the key can be written without quotes, i.e. it consists only of the characters
+// the decoder accepts in an atom (see scanAtom): letters, digits and '_', not starting with a digit
+func isAtomKey(key string) bool {
+	if len(key) == 0 {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || i > 0 && c >= '0' && c <= '9') {
+			return false
 		}
 	}
+	return true
+}
 
-notatom:
-	return e.encodeString(key)
+func isExtendedKey(key string) bool {
+	if len(key) == 0 {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if !isExtendedKeyChar(key[i]) {
+			return false
+		}
+	}
+	return true
 }
 
 func (e *Encoder) encodeArray(a []interface{}) error {
-	err := e.w.WriteByte('[')
+	if e.maxWidth > 0 && e.pretty && !e.inline && e.fitsInline(func(c *Encoder) error { return c.encodeArray(a) }) {
+		e.inline = true
+		defer func() { e.inline = false }()
+	}
+	wrap := e.pretty && !e.inline
+	err := e.beginContainer('[', wrap)
 	if err != nil {
 		return err
 	}
-	if e.pretty {
-		e.level++
-		err := e.writeIndent()
-		if err != nil {
-			return err
-		}
-	}
 	first := true
 	for _, v := range a {
 		if !first {
-			err = e.w.WriteByte(',')
+			err = e.writeSeparator(wrap)
 			if err != nil {
 				return err
 			}
-			if e.pretty {
-				err = e.writeIndent()
-				if err != nil {
-					return err
-				}
-			}
 		} else {
 			first = false
 		}
@@ -474,63 +1423,62 @@ func (e *Encoder) encodeArray(a []interface{}) error {
 		}
 	}
 
-	if e.pretty {
-		e.level--
-		err := e.writeIndent()
-		if err != nil {
-			return err
-		}
-	}
-
-	return e.w.WriteByte(']')
+	return e.endContainer(']', wrap)
 }
 
 func (e *Encoder) encodeSlice(s reflect.Value) error {
-	err := e.w.WriteByte('[')
+	if e.maxWidth > 0 && e.pretty && !e.inline && e.fitsInline(func(c *Encoder) error { return c.encodeSlice(s) }) {
+		e.inline = true
+		defer func() { e.inline = false }()
+	}
+	wrap := e.pretty && !e.inline
+	err := e.beginContainer('[', wrap)
 	if err != nil {
 		return err
 	}
-	if e.pretty {
-		e.level++
-		err := e.writeIndent()
-		if err != nil {
-			return err
-		}
+	elem := s.Type().Elem()
+	if e.typeEncoders != nil {
+		// the elements may have a type encoder, so they must go through encodeValue
+		elem = nil
 	}
 	first := true
 	for i := 0; i < s.Len(); i++ {
 		if !first {
-			err = e.w.WriteByte(',')
+			err = e.writeSeparator(wrap)
 			if err != nil {
 				return err
 			}
-			if e.pretty {
-				err = e.writeIndent()
-				if err != nil {
-					return err
-				}
-			}
 		} else {
 			first = false
 		}
-		err = e.encodeValue(s.Index(i).Interface())
-		if err != nil {
-			return err
+		// the common element types are encoded without boxing into interface{}
+		switch elem {
+		case stringType:
+			err = e.encodeStringValue(s.Index(i).String())
+		case intType:
+			err = e.encodeInt(int(s.Index(i).Int()))
+		case int64Type:
+			err = e.encodeInt64(s.Index(i).Int())
+		case float64Type:
+			err = e.encodeFloat64(s.Index(i).Float())
+		default:
+			err = e.encodeValue(s.Index(i).Interface())
 		}
-	}
-
-	if e.pretty {
-		e.level--
-		err := e.writeIndent()
 		if err != nil {
 			return err
 		}
 	}
 
-	return e.w.WriteByte(']')
+	return e.endContainer(']', wrap)
 }
 
 func (e *Encoder) encodeBytes(b []byte) error {
+	if e.bytesFormat == Hex {
+		return e.encodeHex(b)
+	}
+	if e.compat {
+		return e.encodeString(base64.StdEncoding.EncodeToString(b))
+	}
 	_, err := e.w.WriteString("bytes(\"")
 	if err != nil {
 		return err
@@ -550,30 +1498,194 @@ func (e *Encoder) encodeBytes(b []byte) error {
 	return err
 }
 
-func (e *Encoder) encodeString(str string) (err error) {
-	err = e.w.WriteByte('"')
-	for _, c := range str {
-		switch c {
-		case '\\', '"', '\r', '\n', '\f', '\t':
-			err = e.w.WriteByte('\\')
-			if err != nil {
-				return
-			}
+func (e *Encoder) encodeHex(b []byte) error {
+	if e.compat {
+		return e.encodeString(hex.EncodeToString(b))
+	}
+	_, err := e.w.WriteString("hex(\"")
+	if err != nil {
+		return err
+	}
+	var buf [64]byte
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > len(buf)/2 {
+			chunk = chunk[:len(buf)/2]
+		}
+		n := hex.Encode(buf[:], chunk)
+		if _, err = e.w.Write(buf[:n]); err != nil {
+			return err
 		}
-		switch c {
-		case '\r':
-			c = 'r'
+		b = b[len(chunk):]
+	}
+	_, err = e.w.WriteString("\")")
+	return err
+}
+
+// useRawString returns true if str benefits from being written as a raw string and can be represented
+// as one, i.e. it is valid UTF-8, does not contain """ or control characters other than '\n' and '\t'
+// and does not end with '"'.
+func useRawString(str string, escapeHTML, escapeUnicode, escapeSlash bool) bool {
+	if !utf8.ValidString(str) || strings.Contains(str, `"""`) || strings.HasSuffix(str, `"`) {
+		return false
+	}
+	newlines, escapes := 0, 0
+	for i := 0; i < len(str); i++ {
+		switch c := str[i]; c {
 		case '\n':
-			c = 'n'
-		case '\f':
-			c = 'f'
+			newlines++
 		case '\t':
-			c = 't'
+		case '"', '\\':
+			escapes++
+		case '<', '>', '&':
+			if escapeHTML {
+				return false
+			}
+		case '/':
+			if escapeSlash {
+				return false
+			}
+		default:
+			if c < ' ' || escapeUnicode && c > '~' {
+				return false
+			}
+		}
+	}
+	return newlines > 0 || escapes > 1
+}
+
+func (e *Encoder) encodeRawString(str string) error {
+	_, err := e.w.WriteString(`"""`)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.WriteString(str)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.WriteString(`"""`)
+	return err
+}
+
+func (e *Encoder) encodeString(str string) error {
+	err := e.w.WriteByte('"')
+	if err != nil {
+		return err
+	}
+	// start is the beginning of the current run of bytes that can be written as is
+	start := 0
+	for i := 0; i < len(str); {
+		if c := str[i]; c < utf8.RuneSelf {
+			if c >= ' ' && c != '"' && c != '\\' && !(e.escapeHTML && (c == '<' || c == '>' || c == '&')) &&
+				!(e.escapeUnicode && c == 0x7f) && !(e.escapeSlash && c == '/') {
+				i++
+				continue
+			}
+			if start < i {
+				_, err = e.w.WriteString(str[start:i])
+				if err != nil {
+					return err
+				}
+			}
+			err = e.encodeEscapedByte(c)
+			if err != nil {
+				return err
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(str[i:])
+		if r == utf8.RuneError && size == 1 {
+			// invalid UTF-8 is coerced to the replacement character
+			if start < i {
+				_, err = e.w.WriteString(str[start:i])
+				if err != nil {
+					return err
+				}
+			}
+			if e.escapeUnicode {
+				err = e.encodeEscapedRune(utf8.RuneError)
+			} else {
+				_, err = e.w.WriteString("\ufffd")
+			}
+			if err != nil {
+				return err
+			}
+			i += size
+			start = i
+			continue
 		}
-		_, err = e.w.WriteRune(c)
+		if e.escapeUnicode {
+			if start < i {
+				_, err = e.w.WriteString(str[start:i])
+				if err != nil {
+					return err
+				}
+			}
+			err = e.encodeEscapedRune(r)
+			if err != nil {
+				return err
+			}
+			start = i + size
+		}
+		i += size
+	}
+	if start < len(str) {
+		_, err = e.w.WriteString(str[start:])
 		if err != nil {
 			return err
 		}
 	}
 	return e.w.WriteByte('"')
 }
+
+// encodeEscapedRune writes r as \uXXXX, or as a surrogate pair if it is outside the BMP
+func (e *Encoder) encodeEscapedRune(r rune) error {
+	if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+		err := e.encodeEscapedRune(r1)
+		if err != nil {
+			return err
+		}
+		return e.encodeEscapedRune(r2)
+	}
+	var buf [6]byte
+	buf[0] = '\\'
+	buf[1] = 'u'
+	for i := 5; i >= 2; i-- {
+		buf[i] = hexDigits[r&0xF]
+		r >>= 4
+	}
+	_, err := e.w.Write(buf[:])
+	return err
+}
+
+func (e *Encoder) encodeEscapedByte(c byte) error {
+	err := e.w.WriteByte('\\')
+	if err != nil {
+		return err
+	}
+	switch c {
+	case '\\', '"', '/':
+		return e.w.WriteByte(c)
+	case '\b':
+		return e.w.WriteByte('b')
+	case '\f':
+		return e.w.WriteByte('f')
+	case '\n':
+		return e.w.WriteByte('n')
+	case '\r':
+		return e.w.WriteByte('r')
+	case '\t':
+		return e.w.WriteByte('t')
+	}
+	_, err = e.w.WriteString("u00")
+	if err != nil {
+		return err
+	}
+	err = e.w.WriteByte(hexDigits[c>>4])
+	if err != nil {
+		return err
+	}
+	return e.w.WriteByte(hexDigits[c&0xF])
+}
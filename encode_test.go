@@ -1,11 +1,26 @@
 package jsonx
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math"
 	"net"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 )
 
 var (
@@ -87,3 +102,1530 @@ func TestMarshalIndent(t *testing.T) {
 		t.Fatalf("Unexpected value: '%s'", s)
 	}
 }
+
+func TestEncodeString(t *testing.T) {
+	for i, tt := range []struct {
+		in, expected string
+	}{
+		{in: "", expected: `""`},
+		{in: "test", expected: `"test"`},
+		{in: `a"b\c`, expected: `"a\"b\\c"`},
+		{in: "\r\n\f\t\b", expected: `"\r\n\f\t\b"`},
+		{in: "a\x00b\x1fc", expected: `"a\u0000b\u001fc"`},
+		{in: "Déjà vu \U0001D11E", expected: "\"Déjà vu \U0001D11E\""},
+		{in: "hello\xffworld", expected: "\"hello�world\""},
+		{in: "\xed\xa0\x80", expected: "\"���\""},
+	} {
+		b, err := Marshal(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := string(b); s != tt.expected {
+			t.Errorf("#%d: %q, want %q", i, s, tt.expected)
+		}
+		v, err := Decode(b)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if expected, _ := Decode([]byte(tt.expected)); v != expected {
+			t.Errorf("#%d: decoded %q, want %q", i, v, expected)
+		}
+	}
+}
+
+func BenchmarkEncodeString(b *testing.B) {
+	buf := make([]byte, 1<<20)
+	for i := range buf {
+		if i%1000 == 999 {
+			buf[i] = '\n'
+		} else {
+			buf[i] = 'a' + byte(i%26)
+		}
+	}
+	s := string(buf)
+	b.SetBytes(int64(len(s)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := Marshal(s)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestEncodeRawStrings(t *testing.T) {
+	for i, tt := range []struct {
+		in, expected string
+	}{
+		{in: "test", expected: `"test"`},
+		{in: `say "hi"`, expected: `"say \"hi\""`},
+		{in: `"a" and "b" x`, expected: `""""a" and "b" x"""`},
+		{in: "line1\n\"line2\"\n", expected: "\"\"\"line1\n\"line2\"\n\"\"\""},
+		{in: "a\nb\"", expected: `"a\nb\""`},
+		{in: "a\n\"\"\"b", expected: `"a\n\"\"\"b"`},
+		{in: "a\r\nb", expected: `"a\r\nb"`},
+		{in: "a\n\xffb", expected: "\"a\\n\ufffdb\""},
+	} {
+		var buf bytes.Buffer
+		e := NewEncoder(&buf)
+		e.RawStrings(true)
+		if err := e.Encode(tt.in); err != nil {
+			t.Fatal(err)
+		}
+		if s := buf.String(); s != tt.expected {
+			t.Errorf("#%d: %q, want %q", i, s, tt.expected)
+			continue
+		}
+		if !utf8.ValidString(tt.in) {
+			continue
+		}
+		d := NewDecoder(buf.Bytes())
+		d.AllowRawStrings()
+		v, err := d.Decode()
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if v != tt.in {
+			t.Errorf("#%d: decoded %q, want %q", i, v, tt.in)
+		}
+	}
+}
+
+func TestEncoderTerminator(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.SetTerminator("\n")
+	for _, v := range []interface{}{
+		map[string]interface{}{"a": 1},
+		"test",
+		[]interface{}{true, nil},
+	} {
+		if err := e.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := buf.String(); s != "{a:int(1)}\n\"test\"\n[true,null]\n" {
+		t.Fatalf("Unexpected value: %q", s)
+	}
+
+	buf.Reset()
+	e = NewEncoder(&buf)
+	for _, v := range []interface{}{"a", "b"} {
+		if err := e.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := buf.String(); s != `"a""b"` {
+		t.Fatalf("Unexpected value without terminator: %q", s)
+	}
+}
+
+func TestEncodeDateTimeLayout(t *testing.T) {
+	tm := time.Date(2017, 12, 25, 15, 0, 0, 123456789, time.UTC)
+	for i, tt := range []struct {
+		layout, expected string
+		preserved        bool
+	}{
+		{layout: "", expected: `datetime("2017-12-25T15:00:00Z")`},
+		{layout: time.RFC3339, expected: `datetime("2017-12-25T15:00:00Z")`},
+		{layout: time.RFC3339Nano, expected: `datetime("2017-12-25T15:00:00.123456789Z")`, preserved: true},
+	} {
+		var buf bytes.Buffer
+		e := NewEncoder(&buf)
+		e.SetDateTimeLayout(tt.layout)
+		if err := e.Encode(tm); err != nil {
+			t.Fatal(err)
+		}
+		if s := buf.String(); s != tt.expected {
+			t.Errorf("#%d: %s, want %s", i, s, tt.expected)
+			continue
+		}
+		v, err := Decode(buf.Bytes())
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if equal := v.(time.Time).Equal(tm); equal != tt.preserved {
+			t.Errorf("#%d: decoded %v, original %v", i, v, tm)
+		}
+	}
+}
+
+func TestEncodeNumber(t *testing.T) {
+	const src = `[12345678901234567890,-0.1000]`
+	d := NewDecoder([]byte(src))
+	d.UseNumber()
+	v, err := d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != src {
+		t.Fatalf("Unexpected value: %s", s)
+	}
+
+	b, err = MarshalIndent(map[string]interface{}{"n": json.Number("1.5e300")}, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != "{\n  n: 1.5e300\n}" {
+		t.Fatalf("Unexpected indented value: %q", s)
+	}
+
+	for _, n := range []json.Number{"1.", "+1", "01", "1e", "NaN", "0x10", "1 "} {
+		if _, err := Marshal(n); err == nil {
+			t.Errorf("Expected error for %q", n)
+		}
+	}
+}
+
+func TestEncodeIPv4Mapped(t *testing.T) {
+	for i, tt := range []struct {
+		ip       net.IP
+		expected string
+	}{
+		{ip: net.IPv4(192, 168, 1, 2).To4(), expected: `[ip("192.168.1.2"),ipport("192.168.1.2:80")]`},
+		{ip: net.IPv4(192, 168, 1, 2), expected: `[ip("::ffff:192.168.1.2"),ipport("[::ffff:192.168.1.2]:80")]`},
+		{ip: net.ParseIP("2001:db8::1"), expected: `[ip("2001:db8::1"),ipport("[2001:db8::1]:80")]`},
+	} {
+		var buf bytes.Buffer
+		e := NewEncoder(&buf)
+		e.PreserveIPv4Mapped(true)
+		if err := e.Encode([]interface{}{tt.ip, net.TCPAddr{IP: tt.ip, Port: 80}}); err != nil {
+			t.Fatal(err)
+		}
+		if s := buf.String(); s != tt.expected {
+			t.Errorf("#%d: %s, want %s", i, s, tt.expected)
+			continue
+		}
+		d := NewDecoder(buf.Bytes())
+		d.PreserveIPv4Mapped()
+		v, err := d.DecodeArray()
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if ip := v[0].(net.IP); !bytes.Equal(ip, tt.ip) {
+			t.Errorf("#%d: decoded %#v, want %#v", i, ip, tt.ip)
+		}
+		if addr := v[1].(net.TCPAddr); !bytes.Equal(addr.IP, tt.ip) || addr.Port != 80 {
+			t.Errorf("#%d: decoded %#v", i, addr)
+		}
+	}
+
+	// by default both forms are written as plain IPv4
+	b, err := Marshal([]interface{}{net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 1).To4()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != `[ip("10.0.0.1"),ip("10.0.0.1")]` {
+		t.Fatalf("Unexpected value: %s", s)
+	}
+}
+
+func TestMarshalCanonical(t *testing.T) {
+	decode := func(s string) interface{} {
+		d := NewDecoder([]byte(s))
+		d.RawNumbers()
+		v, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	for i, tt := range []struct {
+		a, b     interface{}
+		expected string
+	}{
+		{
+			a:        decode(`{b: [1.0, -0, 1e3], a: "x"}`),
+			b:        decode(`{"a": "x", "b": [1, 0, 1000.000]}`),
+			expected: `{a:"x",b:[1,0,1000]}`,
+		},
+		{
+			a:        decode(`datetime("2017-12-25T17:00:00+02:00")`),
+			b:        time.Date(2017, 12, 25, 15, 0, 0, 0, time.UTC),
+			expected: `datetime("2017-12-25T15:00:00Z")`,
+		},
+		{
+			a:        decode(`datetime("2017-12-25T15:00:00.5Z")`),
+			b:        time.Date(2017, 12, 25, 16, 0, 0, 999999999, time.FixedZone("", 3600)),
+			expected: `datetime("2017-12-25T15:00:00Z")`,
+		},
+		{
+			a:        decode(`[ip("::ffff:10.0.0.1"), ipport("[::ffff:10.0.0.1]:80"), ip("2001:0db8:0000::1")]`),
+			b:        []interface{}{net.IPv4(10, 0, 0, 1).To4(), net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 80}, net.ParseIP("2001:db8::1")},
+			expected: `[ip("10.0.0.1"),ipport("10.0.0.1:80"),ip("2001:db8::1")]`,
+		},
+		{
+			a:        map[string]interface{}{"n": json.Number("0.50"), "m": math.Copysign(0, -1)},
+			b:        map[string]interface{}{"m": 0.0, "n": 0.5},
+			expected: `{m:0,n:0.5}`,
+		},
+	} {
+		a, err := MarshalCanonical(tt.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := MarshalCanonical(tt.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(a) != tt.expected || string(b) != tt.expected {
+			t.Errorf("#%d: %s, %s; want %s", i, a, b, tt.expected)
+		}
+		if sha256.Sum256(a) != sha256.Sum256(b) {
+			t.Errorf("#%d: hashes differ", i)
+		}
+	}
+}
+
+func TestEncodeExtendedKeys(t *testing.T) {
+	m := map[string]interface{}{"2fa": true, "x-api-key": "k", "a.b.c": 1.0, "123": "n", "a b": nil, "": nil}
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.ExtendedKeys(true)
+	if err := e.Encode(m); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); s != `{"":null,123:"n",2fa:true,"a b":null,a.b.c:1,x-api-key:"k"}` {
+		t.Fatalf("Unexpected value: %s", s)
+	}
+	d := NewDecoder(buf.Bytes())
+	d.AllowExtendedKeys()
+	v, err := d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, m) {
+		t.Fatalf("Unexpected value: %#v", v)
+	}
+}
+
+func TestEncodeDuration(t *testing.T) {
+	m := map[string]interface{}{"timeout": 90 * time.Minute, "tick": 1500 * time.Microsecond}
+	b, err := Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != `{tick:duration("1.5ms"),timeout:duration("1h30m0s")}` {
+		t.Fatalf("Unexpected value: %s", s)
+	}
+	v, err := Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, m) {
+		t.Fatalf("Unexpected value: %#v", v)
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.CompatJSON(true)
+	if err := e.Encode(m); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); s != `{"tick":"1.5ms","timeout":"1h30m0s"}` {
+		t.Fatalf("Unexpected compat value: %s", s)
+	}
+}
+
+func TestEncodeQuoteKeys(t *testing.T) {
+	v := map[string]interface{}{
+		"a":   int64(1),
+		"b c": map[string]interface{}{"d": net.IPv4(10, 0, 0, 1)},
+	}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != `{a:int64(1),"b c":{d:ip("10.0.0.1")}}` {
+		t.Fatalf("Unexpected default value: %s", s)
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.QuoteKeys(true)
+	e.ExtendedKeys(true)
+	if err := e.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); s != `{"a":int64(1),"b c":{"d":ip("10.0.0.1")}}` {
+		t.Fatalf("Unexpected quoted value: %s", s)
+	}
+}
+
+func TestMarshalAppend(t *testing.T) {
+	expected, err := Marshal(testMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := []byte("prefix:")
+	b, err := MarshalAppend(buf, testMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != "prefix:"+string(expected) {
+		t.Fatalf("Unexpected value: %s", s)
+	}
+
+	b, err = MarshalAppend(b[:0], "Déjà vu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != `"Déjà vu"` {
+		t.Fatalf("Unexpected value: %s", s)
+	}
+
+	b, err = MarshalAppend(b[:0], map[string]interface{}{"f": func() {}})
+	if err == nil {
+		t.Fatal("Expected error for unsupported type")
+	}
+	if len(b) != 0 {
+		t.Fatalf("Unexpected value on error: %q", b)
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(testMap); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalAppend(b *testing.B) {
+	b.ReportAllocs()
+	var buf []byte
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = MarshalAppend(buf[:0], testMap); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalCompact(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := MarshalCompact(testMap); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalIndent(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := MarshalIndent(testMap, "", "  "); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalPretty(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := MarshalPretty(testMap); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMarshalPooled(t *testing.T) {
+	for i, v := range []interface{}{
+		testMap,
+		[]interface{}{[]byte("abcd"), int8(1), "x"},
+		map[string]interface{}{"a": []byte{1, 2, 3}, "b": map[string]interface{}{}},
+		nil,
+		"str",
+	} {
+		// twice to make sure the pooled encoders are reused correctly
+		for j := 0; j < 2; j++ {
+			expected, err := Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := MarshalCompact(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, expected) {
+				t.Errorf("#%d: MarshalCompact: %q, expected %q", i, b, expected)
+			}
+			expected, err = MarshalIndent(v, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err = MarshalPretty(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, expected) {
+				t.Errorf("#%d: MarshalPretty: %q, expected %q", i, b, expected)
+			}
+		}
+	}
+
+	// the returned slice must not be affected by subsequent calls
+	b, _ := MarshalCompact("first")
+	MarshalCompact("second")
+	if string(b) != `"first"` {
+		t.Fatalf("Unexpected value: %q", b)
+	}
+
+	// an error must not leave any state behind
+	if _, err := MarshalPretty([]interface{}{make(chan int)}); err == nil {
+		t.Fatal("Expected error")
+	}
+	if b, err := MarshalCompact([]interface{}{1.0}); err != nil || string(b) != "[1]" {
+		t.Fatalf("Unexpected result: %q, %v", b, err)
+	}
+}
+
+func TestEncodeEscapeUnicode(t *testing.T) {
+	for i, tt := range []struct {
+		in, raw, escaped string
+	}{
+		{in: "ascii ~", raw: `"ascii ~"`, escaped: `"ascii ~"`},
+		{in: "Déjà vu", raw: `"Déjà vu"`, escaped: `"D\u00e9j\u00e0 vu"`},
+		{in: "日本\x7f", raw: "\"日本\x7f\"", escaped: `"\u65e5\u672c\u007f"`},
+		{in: "clef \U0001D11E!", raw: "\"clef \U0001D11E!\"", escaped: `"clef \ud834\udd1e!"`},
+		{in: "bad\xff", raw: "\"bad�\"", escaped: `"bad\ufffd"`},
+	} {
+		for _, escape := range []bool{false, true} {
+			var buf bytes.Buffer
+			e := NewEncoder(&buf)
+			e.EscapeUnicode(escape)
+			if err := e.Encode(tt.in); err != nil {
+				t.Fatal(err)
+			}
+			expected := tt.raw
+			if escape {
+				expected = tt.escaped
+			}
+			if s := buf.String(); s != expected {
+				t.Errorf("#%d (%v): %s, want %s", i, escape, s, expected)
+				continue
+			}
+			v, err := Decode(buf.Bytes())
+			if err != nil {
+				t.Errorf("#%d (%v): %v", i, escape, err)
+				continue
+			}
+			if expected := strings.ToValidUTF8(tt.in, "�"); v != expected {
+				t.Errorf("#%d (%v): decoded %q, want %q", i, escape, v, expected)
+			}
+		}
+	}
+}
+
+// testDecimal is a stub decimal type: an integer coefficient and a number of fractional digits
+type testDecimal struct {
+	coef  int64
+	scale int
+}
+
+func parseTestDecimal(raw []byte) (interface{}, error) {
+	s := string(raw)
+	scale := 0
+	if i := strings.IndexByte(s, '.'); i != -1 {
+		scale = len(s) - i - 1
+		s = s[:i] + s[i+1:]
+	}
+	coef, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return testDecimal{coef, scale}, nil
+}
+
+func (d testDecimal) MarshalJSONX() ([]byte, error) {
+	s := strconv.FormatInt(d.coef, 10)
+	neg := d.coef < 0
+	if neg {
+		s = s[1:]
+	}
+	for len(s) <= d.scale {
+		s = "0" + s
+	}
+	if d.scale > 0 {
+		s = s[:len(s)-d.scale] + "." + s[len(s)-d.scale:]
+	}
+	if neg {
+		s = "-" + s
+	}
+	return []byte(s), nil
+}
+
+type testBadMarshaler struct{}
+
+type testAtomsMarshaler struct{}
+
+func (testAtomsMarshaler) MarshalJSONX() ([]byte, error) {
+	return []byte(`{b: int(1), a: datetime("2020-01-02T03:04:05+01:00"), n: 1.50, c: [-0, 1e0]}`), nil
+}
+
+func (testBadMarshaler) MarshalJSONX() ([]byte, error) {
+	return []byte(`{a: 1} x`), nil
+}
+
+func TestNumberConverter(t *testing.T) {
+	const src = `{price:19.990,qty:3,rate:-0.05,n:int(1)}`
+	d := NewDecoder([]byte(src))
+	d.SetNumberConverter(parseTestDecimal)
+	v, err := d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"price": testDecimal{19990, 3},
+		"qty":   testDecimal{3, 0},
+		"rate":  testDecimal{-5, 2},
+		"n":     1,
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("Unexpected value: %#v", v)
+	}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != `{n:int(1),price:19.990,qty:3,rate:-0.05}` {
+		t.Fatalf("Unexpected value: %s", s)
+	}
+
+	d = NewDecoder([]byte(`[1e3]`))
+	d.SetNumberConverter(parseTestDecimal)
+	if _, err := d.Decode(); err == nil {
+		t.Fatal("Expected converter error")
+	}
+
+	if _, err := Marshal([]interface{}{testBadMarshaler{}}); err == nil {
+		t.Fatal("Expected error for invalid MarshalJSONX output")
+	}
+	if _, err := MarshalCanonical([]interface{}{testBadMarshaler{}}); err == nil {
+		t.Fatal("Expected error for invalid MarshalJSONX output in canonical mode")
+	}
+
+	// the output is re-encoded in the JSON compatible and the canonical modes
+	var buf bytes.Buffer
+	if err := NewEncoderWithOptions(&buf, WithCompatJSON()).Encode(testAtomsMarshaler{}); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); s != `{"a":"2020-01-02T03:04:05+01:00","b":1,"c":[-0,1e0],"n":1.50}` {
+		t.Fatalf("Unexpected compat output: %s", s)
+	}
+	if b, err := MarshalCanonical(testAtomsMarshaler{}); err != nil || string(b) != `{a:datetime("2020-01-02T02:04:05Z"),b:int(1),c:[0,1],n:1.5}` {
+		t.Fatalf("Unexpected canonical output: %s, %v", b, err)
+	}
+}
+
+type testTextID [2]byte
+
+func (id testTextID) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("id-%02x%02x", id[0], id[1])), nil
+}
+
+type testBinaryID [2]byte
+
+func (id testBinaryID) MarshalBinary() ([]byte, error) {
+	return id[:], nil
+}
+
+// testBothID implements all marshaler interfaces, Marshaler takes precedence
+type testBothID struct {
+	testTextID
+	testBinaryID
+}
+
+func (testBothID) MarshalJSONX() ([]byte, error) {
+	return []byte(`"both"`), nil
+}
+
+type testTextBinaryID struct {
+	testTextID
+	testBinaryID
+}
+
+type testTextError struct{}
+
+func (testTextError) MarshalText() ([]byte, error) {
+	return nil, fmt.Errorf("text error")
+}
+
+func TestEncodeTextBinaryMarshaler(t *testing.T) {
+	for i, tt := range []struct {
+		in       interface{}
+		expected string
+	}{
+		{in: testTextID{1, 2}, expected: `"id-0102"`},
+		{in: testBinaryID{0xfb, 0xff}, expected: `bytes("+/8=")`},
+		{in: testBothID{}, expected: `"both"`},
+		{in: testTextBinaryID{testTextID: testTextID{0xab, 0}}, expected: `"id-ab00"`},
+		{in: map[string]interface{}{"a": testTextID{}}, expected: `{a:"id-0000"}`},
+		// built-in encoding takes precedence over TextMarshaler
+		{in: net.IPv4(1, 2, 3, 4).To4(), expected: `ip("1.2.3.4")`},
+	} {
+		b, err := Marshal(tt.in)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if string(b) != tt.expected {
+			t.Errorf("#%d: %s, expected %s", i, b, tt.expected)
+		}
+	}
+
+	if _, err := Marshal(testTextError{}); err == nil || err.Error() != "text error" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestEncodeSQLNull(t *testing.T) {
+	for i, tt := range []struct {
+		in       interface{}
+		expected string
+	}{
+		{in: sql.NullString{String: "abc", Valid: true}, expected: `"abc"`},
+		{in: sql.NullString{String: "abc"}, expected: `null`},
+		{in: sql.NullInt64{Int64: 42, Valid: true}, expected: `int64(42)`},
+		{in: sql.NullInt64{}, expected: `null`},
+		{in: sql.NullBool{Bool: false, Valid: true}, expected: `false`},
+		{in: sql.NullBool{}, expected: `null`},
+		{in: sql.NullFloat64{Float64: 1.5, Valid: true}, expected: `1.5`},
+		{in: map[string]interface{}{"a": sql.NullString{}, "b": sql.NullBool{Bool: true, Valid: true}}, expected: `{a:null,b:true}`},
+	} {
+		b, err := Marshal(tt.in)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if string(b) != tt.expected {
+			t.Errorf("#%d: %s, expected %s", i, b, tt.expected)
+		}
+	}
+}
+
+func TestEncodeOmitNull(t *testing.T) {
+	v := map[string]interface{}{
+		"a": nil,
+		"b": false,
+		"c": 0.0,
+		"d": "",
+		"e": map[string]interface{}{"f": nil},
+		"g": []interface{}{nil},
+	}
+	for i, tt := range []struct {
+		opts     []EncodeOption
+		in       interface{}
+		expected string
+	}{
+		{in: v, expected: `{a:null,b:false,c:0,d:"",e:{f:null},g:[null]}`},
+		{opts: []EncodeOption{WithOmitNull(true)}, in: v, expected: `{b:false,c:0,d:"",e:{},g:[null]}`},
+		{opts: []EncodeOption{WithOmitNull(true), WithIndent("", " ")}, in: map[string]interface{}{"a": nil, "b": 1.0},
+			expected: "{\n b: 1\n}"},
+	} {
+		var buf bytes.Buffer
+		e := NewEncoderWithOptions(&buf, tt.opts...)
+		if err := e.Encode(tt.in); err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if s := buf.String(); s != tt.expected {
+			t.Errorf("#%d: %q, expected %q", i, s, tt.expected)
+		}
+	}
+
+	// a map with only null values is written the same as an empty one
+	expected, _ := MarshalIndent(map[string]interface{}{}, "", " ")
+	var buf bytes.Buffer
+	e := NewEncoderWithOptions(&buf, WithOmitNull(true), WithIndent("", " "))
+	if err := e.Encode(map[string]interface{}{"a": nil}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != string(expected) {
+		t.Fatalf("Unexpected value: %q", buf.String())
+	}
+}
+
+func TestEncodeEscapeSlash(t *testing.T) {
+	v := map[string]interface{}{"html": `</script><script>alert(1)</script>`, "url": "http://example.com/"}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != `{html:"</script><script>alert(1)</script>",url:"http://example.com/"}` {
+		t.Fatalf("Unexpected default value: %s", s)
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoderWithOptions(&buf, WithEscapeSlash(true), WithEscapeHTML(false), WithRawStringOutput(true))
+	if err = e.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); s != `{html:"<\/script><script>alert(1)<\/script>",url:"http:\/\/example.com\/"}` {
+		t.Fatalf("Unexpected value: %s", s)
+	}
+	if strings.Contains(buf.String(), "</") {
+		t.Fatal("Output contains </")
+	}
+
+	// all two-character escapes survive a round trip
+	const src = `"\"\\\/\b\f\n\r\t"`
+	decoded, err := Decode([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err = e.Encode(decoded); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); s != src {
+		t.Fatalf("Unexpected round trip value: %s", s)
+	}
+}
+
+type testKey string
+
+func TestMarshalMap(t *testing.T) {
+	for i, tt := range []struct {
+		in       interface{}
+		expected string
+	}{
+		{in: map[string]int{"b": 2, "a": 1}, expected: `{a:int(1),b:int(2)}`},
+		{in: map[testKey]string{"x y": "z"}, expected: `{"x y":"z"}`},
+		{in: map[string][]float64{"a": {1, 2}}, expected: `{a:[1,2]}`},
+		{in: map[string]interface{}{"n": map[string]bool{"t": true}}, expected: `{n:{t:true}}`},
+		{in: map[string]int(nil), expected: `{}`},
+	} {
+		b, err := MarshalMap(tt.in)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if string(b) != tt.expected {
+			t.Errorf("#%d: %s, expected %s", i, b, tt.expected)
+		}
+	}
+
+	if _, err := MarshalMap([]int{1}); err == nil || err.Error() != "MarshalMap: argument of type []int is not a map" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := MarshalMap(map[int]string{1: "a"}); err == nil || err.Error() != "MarshalMap: unsupported map key type int" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := Marshal([]interface{}{map[bool]int{}}); err == nil {
+		t.Fatal("Expected error for unsupported key type")
+	}
+}
+
+type testInts []int
+
+func TestEncodeTypedSlices(t *testing.T) {
+	for i, tt := range []struct {
+		in      interface{}
+		generic []interface{}
+	}{
+		{in: []string{"a", "b \"c\"", ""}, generic: []interface{}{"a", "b \"c\"", ""}},
+		{in: []int{1, -2, 0}, generic: []interface{}{1, -2, 0}},
+		{in: testInts{3}, generic: []interface{}{3}},
+		{in: []int64{1, MAX_SAFE_INTEGER + 1}, generic: []interface{}{int64(1), int64(MAX_SAFE_INTEGER + 1)}},
+		{in: []float64{0.5, -1, math.Inf(1)}, generic: []interface{}{0.5, -1.0, math.Inf(1)}},
+		{in: []bool{true}, generic: []interface{}{true}},
+		{in: []int{}, generic: []interface{}{}},
+	} {
+		for _, opts := range [][]EncodeOption{nil, {WithIndent("", " ")}, {WithCompatJSON()}, {WithRawStringOutput(true)}} {
+			var expected, actual bytes.Buffer
+			if err := NewEncoderWithOptions(&expected, opts...).Encode(tt.generic); err != nil {
+				t.Fatal(err)
+			}
+			if err := NewEncoderWithOptions(&actual, opts...).Encode(tt.in); err != nil {
+				t.Errorf("#%d: %v", i, err)
+				continue
+			}
+			if actual.String() != expected.String() {
+				t.Errorf("#%d: %s, expected %s", i, actual.String(), expected.String())
+			}
+		}
+	}
+}
+
+func BenchmarkEncodeIntSlice(b *testing.B) {
+	s := make([]int, 10000)
+	for i := range s {
+		s[i] = i * 1000
+	}
+	b.ReportAllocs()
+	var buf []byte
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = MarshalAppend(buf[:0], s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestEncodeKeyQuoting(t *testing.T) {
+	for i, tt := range []struct {
+		key      string
+		expected string
+	}{
+		{key: "abc", expected: `abc`},
+		{key: "a_b1", expected: `a_b1`},
+		{key: "_x", expected: `_x`},
+		{key: "1a", expected: `"1a"`},
+		{key: "", expected: `""`},
+		{key: "a b", expected: `"a b"`},
+		{key: "a.b", expected: `"a.b"`},
+		{key: "a-b", expected: `"a-b"`},
+		{key: "a\x00", expected: `"a\u0000"`},
+		{key: "\x01", expected: `"\u0001"`},
+		{key: "tab\t", expected: `"tab\t"`},
+		{key: "a\x7f", expected: "\"a\x7f\""},
+		{key: "ü", expected: `"ü"`},
+	} {
+		v := map[string]interface{}{tt.key: 1.0}
+		b, err := Marshal(v)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if s := string(b); s != "{"+tt.expected+":1}" {
+			t.Errorf("#%d: %s, expected {%s:1}", i, s, tt.expected)
+		}
+		decoded, err := Decode(b)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(decoded, v) {
+			t.Errorf("#%d: decoded %#v", i, decoded)
+		}
+	}
+
+	// control bytes are not accepted in unquoted keys
+	if _, err := Decode([]byte("{a\x00: 1}")); err == nil {
+		t.Fatal("Expected error")
+	}
+}
+
+type testTextError2 struct{}
+
+func (testTextError2) Error() string {
+	return "error text"
+}
+
+func (testTextError2) MarshalText() ([]byte, error) {
+	return []byte("marshaled text"), nil
+}
+
+func TestEncodeErrorsAsString(t *testing.T) {
+	v := map[string]interface{}{
+		"err":  fmt.Errorf("connection refused: %s", `"host"`),
+		"nil":  (*os.PathError)(nil),
+		"text": testTextError2{},
+	}
+	if _, err := Marshal(v); err == nil {
+		t.Fatal("Expected error by default")
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoderWithOptions(&buf, WithErrorsAsString(true))
+	if err := e.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); s != `{err:"connection refused: \"host\"",nil:null,text:"marshaled text"}` {
+		t.Fatalf("Unexpected value: %s", s)
+	}
+}
+
+func TestEncodeQuoteLargeIntegers(t *testing.T) {
+	v := []interface{}{int64(MAX_SAFE_INTEGER + 2), int64(MIN_SAFE_INTEGER - 2), uint64(math.MaxUint64), int64(5)}
+	for i, tt := range []struct {
+		quote    bool
+		expected string
+	}{
+		{quote: true, expected: `[int64("9007199254740993"),int64("-9007199254740993"),uint64("18446744073709551615"),int64(5)]`},
+		{quote: false, expected: `[int64(9007199254740993),int64(-9007199254740993),uint64(18446744073709551615),int64(5)]`},
+	} {
+		var buf bytes.Buffer
+		if err := NewEncoderWithOptions(&buf, WithQuoteLargeIntegers(tt.quote)).Encode(v); err != nil {
+			t.Fatal(err)
+		}
+		if s := buf.String(); s != tt.expected {
+			t.Errorf("#%d: %s, expected %s", i, s, tt.expected)
+		}
+		decoded, err := Decode(buf.Bytes())
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(decoded, v) {
+			t.Errorf("#%d: decoded %#v", i, decoded)
+		}
+	}
+}
+
+func TestEncodedLen(t *testing.T) {
+	for i, v := range []interface{}{
+		testMap,
+		nil,
+		"Déjà vu \U0001D11E\x01",
+		[]interface{}{[]byte("abcde"), int64(MAX_SAFE_INTEGER + 1), map[string]interface{}{"a b": 1.5}},
+		map[string]interface{}{},
+	} {
+		b, err := Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := EncodedLen(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(b) {
+			t.Errorf("#%d: %d, expected %d", i, n, len(b))
+		}
+
+		var buf bytes.Buffer
+		e := NewEncoderIndent(&buf, "> ", "\t")
+		e.SetTerminator("\n")
+		e.CompatJSON(true)
+		if n, err = e.EncodedLen(v); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() != 0 {
+			t.Fatalf("#%d: unexpected output: %q", i, buf.String())
+		}
+		if err = e.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+		if n != buf.Len() {
+			t.Errorf("#%d: pretty: %d, expected %d", i, n, buf.Len())
+		}
+	}
+
+	if _, err := EncodedLen(make(chan int)); err == nil {
+		t.Fatal("Expected error")
+	}
+}
+
+type testPlainStruct struct {
+	A int
+}
+
+func TestEncodeInterfacesAndPointers(t *testing.T) {
+	n := int8(5)
+	pn := &n
+	tm := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	ip := net.IPv4(10, 0, 0, 1)
+	for i, tt := range []struct {
+		in       interface{}
+		expected string
+	}{
+		{in: map[string]fmt.Stringer{"a": nil}, expected: `{a:null}`},
+		{in: []error{nil, errors.New("x")}, expected: ``},
+		{in: []fmt.Stringer{nil}, expected: `[null]`},
+		{in: (*int)(nil), expected: `null`},
+		{in: []interface{}{(*time.Time)(nil), (*testPlainStruct)(nil)}, expected: `[null,null]`},
+		{in: &n, expected: `int8(5)`},
+		{in: &pn, expected: `int8(5)`},
+		{in: []interface{}{&testDecimal{15, 1}}, expected: `[1.5]`},
+		{in: []encoding.TextMarshaler{testTextID{'a', 'b'}}, expected: `["id-6162"]`},
+		{in: map[string]*string{"s": new(string)}, expected: `{s:""}`},
+		{in: []interface{}{&tm, tm, &ip, ip}, expected: `[datetime("2020-01-02T03:04:05Z"),datetime("2020-01-02T03:04:05Z"),ip("10.0.0.1"),ip("10.0.0.1")]`},
+		{in: []interface{}{(*net.IP)(nil), (*net.TCPAddr)(nil), (*net.UDPAddr)(nil)}, expected: `[null,null,null]`},
+	} {
+		b, err := Marshal(tt.in)
+		if tt.expected == "" {
+			if err == nil {
+				t.Errorf("#%d: expected error, got %q", i, b)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if string(b) != tt.expected {
+			t.Errorf("#%d: %q, expected %q", i, b, tt.expected)
+		}
+	}
+
+	// a struct without an encoding is reported with its concrete type
+	var v interface{} = testPlainStruct{A: 1}
+	_, err := Marshal([]interface{}{&v})
+	if err == nil || !strings.Contains(err.Error(), "jsonx.testPlainStruct") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestEncodeMaxLineWidth(t *testing.T) {
+	v := map[string]interface{}{
+		"short": []interface{}{1.0, 2.0, 3.0},
+		"long":  []interface{}{"aaaaaaaaaa", "bbbbbbbbbbbb", "cccccccccc"},
+		"obj":   map[string]interface{}{"a": 1.0, "b": []interface{}{}},
+		"ints":  []int{1, 2},
+	}
+	for i, tt := range []struct {
+		width    int
+		expected string
+	}{
+		{width: 30, expected: "{\n  ints: [int(1), int(2)],\n  long: [\n    \"aaaaaaaaaa\",\n    \"bbbbbbbbbbbb\",\n    \"cccccccccc\"\n  ],\n  obj: {a: 1, b: []},\n  short: [1, 2, 3]\n}"},
+		// the short array exactly fits, the object does not
+		{width: 18, expected: "{\n  ints: [\n    int(1),\n    int(2)\n  ],\n  long: [\n    \"aaaaaaaaaa\",\n    \"bbbbbbbbbbbb\",\n    \"cccccccccc\"\n  ],\n  obj: {\n    a: 1,\n    b: []\n  },\n  short: [1, 2, 3]\n}"},
+		{width: 1000, expected: `{ints: [int(1), int(2)], long: ["aaaaaaaaaa", "bbbbbbbbbbbb", "cccccccccc"], obj: {a: 1, b: []}, short: [1, 2, 3]}`},
+	} {
+		var buf bytes.Buffer
+		e := NewEncoderIndent(&buf, "", "  ")
+		e.SetMaxLineWidth(tt.width)
+		if err := e.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.expected {
+			t.Errorf("#%d: %s\nexpected\n%s", i, buf.String(), tt.expected)
+		}
+		if n, err := e.EncodedLen(v); err != nil || n != buf.Len() {
+			t.Errorf("#%d: EncodedLen %d, %v, expected %d", i, n, err, buf.Len())
+		}
+	}
+
+	// the width of a key followed by a non-container value does not apply to the next container
+	var buf bytes.Buffer
+	e := NewEncoderWithOptions(&buf, WithIndent("", "  "), WithMaxLineWidth(20))
+	if err := e.Encode([]interface{}{map[string]interface{}{"aaaaaaaaaaaaaa": "bbbbbbbbbbbbbbb"}, []interface{}{1.0, 2.0, 3.0, 4.0}}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "[\n  {\n    aaaaaaaaaaaaaa: \"bbbbbbbbbbbbbbb\"\n  },\n  [1, 2, 3, 4]\n]"; buf.String() != expected {
+		t.Errorf("%s\nexpected\n%s", buf.String(), expected)
+	}
+
+	// no effect without pretty-printing
+	buf.Reset()
+	e = NewEncoder(&buf)
+	e.SetMaxLineWidth(30)
+	if err := e.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	if expected, _ := Marshal(v); buf.String() != string(expected) {
+		t.Fatalf("Unexpected output: %s", buf.String())
+	}
+}
+
+func TestRegexp(t *testing.T) {
+	for i, tt := range []struct {
+		pattern, encoded string
+	}{
+		{pattern: `a+b`, encoded: `regexp("a+b")`},
+		{pattern: `^[a-z]+\d*$`, encoded: `regexp("^[a-z]+\\d*$")`},
+		{pattern: `^"x"$`, encoded: `regexp("^\"x\"$")`},
+	} {
+		re := regexp.MustCompile(tt.pattern)
+		b, err := Marshal(re)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.encoded {
+			t.Errorf("#%d: %s, expected %s", i, b, tt.encoded)
+		}
+		v, err := Decode(b)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if re1, ok := v.(*regexp.Regexp); !ok || re1.String() != tt.pattern {
+			t.Errorf("#%d: decoded %#v", i, v)
+		}
+	}
+
+	_, err := Decode([]byte(`{a: regexp("a(b")}`))
+	if expected := (&SyntaxError{"invalid regexp: error parsing regexp: missing closing ): `a(b`", 13}); !reflect.DeepEqual(err, expected) {
+		t.Fatalf("Unexpected error: %#v", err)
+	}
+
+	b, err := Marshal([]interface{}{(*regexp.Regexp)(nil)})
+	if err != nil || string(b) != "[null]" {
+		t.Fatalf("Unexpected result: %s, %v", b, err)
+	}
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.CompatJSON(true)
+	if err = e.Encode(regexp.MustCompile(`\d`)); err != nil || buf.String() != `"\\d"` {
+		t.Fatalf("Unexpected result: %s, %v", buf.String(), err)
+	}
+}
+
+type testColor uint32
+
+func TestSetTypeEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.SetTypeEncoder(reflect.TypeOf(testColor(0)), func(e *Encoder, v interface{}) error {
+		return e.EncodeValue(fmt.Sprintf("#%06x", uint32(v.(testColor))))
+	})
+	e.SetTypeEncoder(reflect.TypeOf(""), func(e *Encoder, v interface{}) error {
+		return e.EncodeValue(strings.ToUpper(v.(string)))
+	})
+	v := map[string]interface{}{
+		"fg":      testColor(0xff8000),
+		"palette": []testColor{0x000000, 0xffffff},
+		"nested":  map[string]interface{}{"bg": []interface{}{testColor(0x102030)}},
+		"names":   []string{"red"},
+	}
+	if err := e.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	// the output of a type encoder goes through the other type encoders
+	const expected = `{fg:"#FF8000",names:["RED"],nested:{bg:["#102030"]},palette:["#000000","#FFFFFF"]}`
+	if buf.String() != expected {
+		t.Fatalf("Unexpected output: %s", buf.String())
+	}
+
+	// the type encoder takes precedence over Marshaler
+	buf.Reset()
+	e.SetTypeEncoder(reflect.TypeOf(""), nil)
+	e.SetTypeEncoder(reflect.TypeOf(testDecimal{}), func(e *Encoder, v interface{}) error {
+		return e.EncodeValue("decimal")
+	})
+	if err := e.Encode([]interface{}{testDecimal{15, 1}, "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != `["decimal","x"]` {
+		t.Fatalf("Unexpected output: %s", buf.String())
+	}
+}
+
+func TestEncodeOmitIntegerTypeTags(t *testing.T) {
+	v := []interface{}{
+		5, int8(-5), int16(300), int32(-70000), int64(MAX_SAFE_INTEGER), int64(MIN_SAFE_INTEGER),
+		uint(7), uint8(10), uint16(65535), uint32(4294967295), uint64(MAX_SAFE_INTEGER),
+		int64(MAX_SAFE_INTEGER + 1), int64(MIN_SAFE_INTEGER - 1), uint64(math.MaxUint64), int(MAX_SAFE_INTEGER + 1),
+	}
+	const (
+		tagged = `[int(5),int8(-5),int16(300),int32(-70000),int64(9007199254740991),int64(-9007199254740991),` +
+			`uint(7),uint8(10),uint16(65535),uint32(4294967295),uint64(9007199254740991),` +
+			`int64("9007199254740992"),int64("-9007199254740992"),uint64("18446744073709551615"),int(9007199254740992)]`
+		untagged = `[5,-5,300,-70000,9007199254740991,-9007199254740991,` +
+			`7,10,65535,4294967295,9007199254740991,` +
+			`int64("9007199254740992"),int64("-9007199254740992"),uint64("18446744073709551615"),int(9007199254740992)]`
+	)
+	for _, omit := range []bool{false, true} {
+		var buf bytes.Buffer
+		e := NewEncoder(&buf)
+		e.OmitIntegerTypeTags(omit)
+		if err := e.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+		expected := tagged
+		if omit {
+			expected = untagged
+		}
+		if buf.String() != expected {
+			t.Errorf("%v: %s\nexpected %s", omit, buf.String(), expected)
+		}
+	}
+
+	// typed slices use the same encoding
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.OmitIntegerTypeTags(true)
+	if err := e.Encode([]int64{1, MAX_SAFE_INTEGER + 1}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != `[1,int64("9007199254740992")]` {
+		t.Fatalf("Unexpected output: %s", buf.String())
+	}
+}
+
+type testBlob []byte
+
+type testByte byte
+
+func TestEncodeByteSlices(t *testing.T) {
+	for i, tt := range []struct {
+		in       interface{}
+		expected string
+	}{
+		{in: testBlob("ab"), expected: `bytes("YWI=")`},
+		{in: [][]byte{[]byte("ab"), nil}, expected: `[bytes("YWI="),bytes("")]`},
+		{in: []testBlob{testBlob("ab")}, expected: `[bytes("YWI=")]`},
+		{in: map[string]testBlob{"a": testBlob("ab")}, expected: `{a:bytes("YWI=")}`},
+		{in: []testByte{'a', 'b'}, expected: `bytes("YWI=")`},
+		{in: []uint8{'a', 'b'}, expected: `bytes("YWI=")`},
+	} {
+		b, err := Marshal(tt.in)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if string(b) != tt.expected {
+			t.Errorf("#%d: %s, expected %s", i, b, tt.expected)
+		}
+	}
+
+	var v struct{ B testBlob }
+	if err := Unmarshal([]byte(`{B: bytes("YWI=")}`), &v); err != nil || string(v.B) != "ab" {
+		t.Fatalf("Unexpected result: %q, %v", v.B, err)
+	}
+}
+
+func TestBytesFormat(t *testing.T) {
+	data := []byte("\xde\xad\xbe\xef" + strings.Repeat("x", 40))
+	for i, tt := range []struct {
+		format  BytesFormat
+		compat  bool
+		encoded string
+	}{
+		{format: Base64, encoded: `bytes("` + base64.StdEncoding.EncodeToString(data) + `")`},
+		{format: Hex, encoded: `hex("deadbeef` + strings.Repeat("78", 40) + `")`},
+		{format: Hex, compat: true, encoded: `"deadbeef` + strings.Repeat("78", 40) + `"`},
+	} {
+		var buf bytes.Buffer
+		e := NewEncoderWithOptions(&buf, WithBytesFormat(tt.format))
+		e.CompatJSON(tt.compat)
+		if err := e.Encode(data); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.encoded {
+			t.Errorf("#%d: %s, expected %s", i, buf.String(), tt.encoded)
+			continue
+		}
+		if tt.compat {
+			continue
+		}
+		v, err := Decode(buf.Bytes())
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !bytes.Equal(v.([]byte), data) {
+			t.Errorf("#%d: decoded %q", i, v)
+		}
+	}
+
+	for i, tt := range []struct {
+		in  string
+		err error
+	}{
+		{in: `hex("")`},
+		{in: `hex(DEADbeef)`},
+		{in: `hex("abc")`, err: &SyntaxError{"odd length hex bytes", 8}},
+		{in: `[hex("0g")]`, err: &SyntaxError{"invalid character 'g' in hex bytes", 8}},
+	} {
+		_, err := Decode([]byte(tt.in))
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("#%d: %v, expected %v", i, err, tt.err)
+		}
+		if tt.err == nil {
+			if typ, _ := NewDecoder([]byte(tt.in)).PeekType(); typ != Bytes {
+				t.Errorf("#%d: type %v", i, typ)
+			}
+		}
+	}
+}
+
+func TestResolveFuncs(t *testing.T) {
+	calls := 0
+	m := map[string]interface{}{
+		"lazy": func() interface{} {
+			calls++
+			return []interface{}{"a", 1.0}
+		},
+		"nested": func() (interface{}, error) {
+			return func() interface{} { return true }, nil
+		},
+		"nil": (func() interface{})(nil),
+	}
+	var buf bytes.Buffer
+	e := NewEncoderWithOptions(&buf, WithResolveFuncs(true))
+	if err := e.Encode(m); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != `{lazy:["a",1],nested:true,nil:null}` {
+		t.Fatalf("Unexpected output: %s", buf.String())
+	}
+	if calls != 1 {
+		t.Fatalf("Unexpected number of calls: %d", calls)
+	}
+
+	errLazy := errors.New("not available")
+	m["failing"] = func() (interface{}, error) {
+		return nil, errLazy
+	}
+	buf.Reset()
+	if err := e.Encode(m); err != errLazy {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// disabled by default
+	if _, err := Marshal(map[string]interface{}{"lazy": m["lazy"]}); err == nil {
+		t.Fatal("Expected an error")
+	}
+}
+
+func TestSetMaxOutputBytes(t *testing.T) {
+	large := make([]interface{}, 1000)
+	for i := range large {
+		large[i] = strings.Repeat("x", i%50)
+	}
+	small := map[string]interface{}{"a": []byte("abc"), "b": "é"}
+	smallLen, err := EncodedLen(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range []struct {
+		name string
+		w    func(*bytes.Buffer) io.Writer
+	}{
+		{name: "direct", w: func(b *bytes.Buffer) io.Writer { return b }},
+		{name: "buffered", w: func(b *bytes.Buffer) io.Writer { return struct{ io.Writer }{b} }},
+	} {
+		var buf bytes.Buffer
+		e := NewEncoder(tt.w(&buf))
+		e.SetMaxOutputBytes(1000)
+		if err := e.Encode(large); err != ErrOutputTooLarge {
+			t.Errorf("#%d (%s): unexpected error %v", i, tt.name, err)
+		}
+		if buf.Len() > 1000 {
+			t.Errorf("#%d (%s): %d bytes written", i, tt.name, buf.Len())
+		}
+
+		// the limit applies to each call separately and includes the terminator
+		buf.Reset()
+		e = NewEncoder(tt.w(&buf))
+		e.SetTerminator("\n")
+		e.SetMaxOutputBytes(smallLen + 1)
+		for j := 0; j < 2; j++ {
+			if err := e.Encode(small); err != nil {
+				t.Errorf("#%d (%s): %v", i, tt.name, err)
+			}
+		}
+		e.SetMaxOutputBytes(smallLen)
+		if err := e.Encode(small); err != ErrOutputTooLarge {
+			t.Errorf("#%d (%s): unexpected error %v", i, tt.name, err)
+		}
+		e.SetMaxOutputBytes(0)
+		if err := e.Encode(large); err != nil {
+			t.Errorf("#%d (%s): %v", i, tt.name, err)
+		}
+
+		// the incomplete output is not written in front of the next value
+		buf.Reset()
+		e = NewEncoderWithOptions(tt.w(&buf), WithMaxOutputBytes(16))
+		if err := e.Encode([]interface{}{"abc", []byte("defgh")}); err != ErrOutputTooLarge {
+			t.Errorf("#%d (%s): unexpected error %v", i, tt.name, err)
+		}
+		buf.Reset()
+		if err := e.Encode("a"); err != nil || buf.String() != `"a"` {
+			t.Errorf("#%d (%s): %q, %v", i, tt.name, buf.String(), err)
+		}
+		buf.Reset()
+		if err := e.Encode([]byte{1}); err != nil || buf.String() != `bytes("AQ==")` {
+			t.Errorf("#%d (%s): %q, %v", i, tt.name, buf.String(), err)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	corpus := []string{
+		`null`, `true`, `false`, `"stré\n\"\\"`, `""`, `0`, `-0`, `1.5`, `-2.5e-10`, `1e300`, `123456789012345678`,
+		`[]`, `{}`, `[[], {}, [[]]]`, `{"a b": 1, "": 2, "x:y": [3]}`,
+		`int(-454365464)`, `uint(455645765)`, `int8(-128)`, `uint8(255)`, `int16(32767)`, `uint16(65535)`,
+		`int32(2147483647)`, `uint32(4294967295)`, `int64("9223372036854775807")`, `int64(-9223372036854775808)`,
+		`uint64("18446744073709551615")`,
+		`datetime("2017-12-25T15:00:00Z")`, `datetime("2017-12-25T15:00:00.123456789+02:00")`, `datetime(1514214000)`,
+		`duration("1h30m0s")`, `duration("-1.5µs")`, `duration("0s")`,
+		`ip("192.168.1.2")`, `ip("::1")`, `ip("::ffff:10.0.0.1")`, `ip("010.000.000.001")`,
+		`ipport("192.168.1.2:65000")`, `ipport("[::1]:65000")`,
+		`cidr("10.0.0.0/8")`, `cidr("fd00::/64")`,
+		`regexp("^[a-z]+\\d*$")`, `regexp("")`,
+		`bytes("YWJjZA==")`, `bytes("")`, `hex("deadbeef")`,
+	}
+	if readme, err := ioutil.ReadFile("README.md"); err == nil {
+		// the example
+		if m := regexp.MustCompile("(?s)```js\n(.*?)```").FindSubmatch(readme); m != nil {
+			corpus = append(corpus, string(m[1]))
+		}
+	}
+	for i, in := range corpus {
+		expected, err := Decode([]byte(in))
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		out, err := RoundTrip([]byte(in))
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		v, err := Decode(out)
+		if err != nil {
+			t.Errorf("#%d: decoding %s: %v", i, out, err)
+			continue
+		}
+		if !Equal(v, expected) {
+			t.Errorf("#%d: %s decoded as %#v, expected %#v", i, out, v, expected)
+		}
+		// the output is stable
+		if out1, err := RoundTrip(out); err != nil || !bytes.Equal(out1, out) {
+			t.Errorf("#%d: %s, then %s (%v)", i, out, out1, err)
+		}
+	}
+
+	for i, in := range []string{`1 x`, `1e400`, "2" + strings.Repeat("0", 400), "[-2" + strings.Repeat("0", 400) + "]"} {
+		if _, err := RoundTrip([]byte(in)); err == nil {
+			t.Errorf("#%d: expected an error", i)
+		}
+	}
+}
+
+func TestSpecialCharKeys(t *testing.T) {
+	for i, key := range []string{
+		":", "a:b", ",", "a,b", "{", "a{", "}", "[", "a]b", "]", " ", "a b", " a", "a\t", "\n", "\r", "",
+		"(", "a(b)", ")", `"`, "'", "/", "a//b", "/*", "#", "=", "+1", "-", "1a", "a-b", ".", "a.b", "é", "\x00",
+	} {
+		for _, extended := range []bool{false, true} {
+			var buf bytes.Buffer
+			e := NewEncoder(&buf)
+			e.ExtendedKeys(extended)
+			if err := e.Encode(map[string]interface{}{key: 1.0}); err != nil {
+				t.Fatal(err)
+			}
+			out := buf.String()
+			if !strings.HasPrefix(out, `{"`) && !(extended && isExtendedKey(key)) {
+				t.Errorf("#%d (extended: %v): %q not quoted: %s", i, extended, key, out)
+			}
+			d := NewDecoder(buf.Bytes())
+			if extended {
+				d.AllowExtendedKeys()
+			}
+			m, err := d.DecodeObject()
+			if err != nil {
+				t.Errorf("#%d (extended: %v): %s: %v", i, extended, out, err)
+				continue
+			}
+			if len(m) != 1 || m[key] != 1.0 {
+				t.Errorf("#%d (extended: %v): %s decoded as %v", i, extended, out, m)
+			}
+		}
+	}
+
+	// keys that are atoms, including keywords and the names of typed atoms, are not quoted
+	b, err := Marshal(map[string]interface{}{"a_1": 1.0, "true": 2.0, "null": 3.0, "int": 4.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{a_1:1,int:4,null:3,true:2}` {
+		t.Fatalf("Unexpected output: %s", b)
+	}
+	if m, err := DecodeObject(b); err != nil || len(m) != 4 || m["true"] != 2.0 || m["int"] != 4.0 {
+		t.Fatalf("Unexpected result: %v, %v", m, err)
+	}
+}
@@ -0,0 +1,52 @@
+package jsonx
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FlattenToRows converts an array of objects into a table, e.g. for CSV export. The headers are the sorted
+// union of the keys of all objects and each object becomes a row with a cell for each header. Strings
+// are written as is and other values as encoded by Marshal (so nested arrays and objects are written
+// as JSONX), a cell for a key that is missing in the object is empty. An element that is not an object
+// results in an error.
+func FlattenToRows(v []interface{}) (headers []string, rows [][]string, err error) {
+	objects := make([]map[string]interface{}, len(v))
+	seen := make(map[string]struct{})
+	for i, elem := range v {
+		obj, ok := objectMap(elem)
+		if !ok {
+			return nil, nil, fmt.Errorf("FlattenToRows: element %d is %s, not an object", i, Type(elem))
+		}
+		objects[i] = obj
+		for key := range objects[i] {
+			if _, exists := seen[key]; !exists {
+				seen[key] = struct{}{}
+				headers = append(headers, key)
+			}
+		}
+	}
+	sort.Strings(headers)
+
+	rows = make([][]string, len(objects))
+	for i, obj := range objects {
+		row := make([]string, len(headers))
+		for j, key := range headers {
+			val, exists := obj[key]
+			if !exists {
+				continue
+			}
+			if s, ok := val.(string); ok {
+				row[j] = s
+				continue
+			}
+			b, err := Marshal(val)
+			if err != nil {
+				return nil, nil, fmt.Errorf("FlattenToRows: element %d, key %q: %v", i, key, err)
+			}
+			row[j] = string(b)
+		}
+		rows[i] = row
+	}
+	return headers, rows, nil
+}
@@ -0,0 +1,43 @@
+package jsonx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFlattenToRows(t *testing.T) {
+	v, err := Decode([]byte(`[
+		{name: "a", size: 1.5, tags: ["x", "y"]},
+		{name: "b,c", port: int(80), enabled: true},
+		{},
+		{size: null, addr: ip("10.0.0.1"), meta: {k: "v"}},
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, rows, err := FlattenToRows(v.([]interface{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(headers, []string{"addr", "enabled", "meta", "name", "port", "size", "tags"}) {
+		t.Fatalf("Unexpected headers: %q", headers)
+	}
+	expected := [][]string{
+		{"", "", "", "a", "", "1.5", `["x","y"]`},
+		{"", "true", "", "b,c", "int(80)", "", ""},
+		{"", "", "", "", "", "", ""},
+		{`ip("10.0.0.1")`, "", `{k:"v"}`, "", "", "null", ""},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("Unexpected rows: %q", rows)
+	}
+
+	if headers, rows, err = FlattenToRows(nil); err != nil || len(headers) != 0 || len(rows) != 0 {
+		t.Fatalf("Unexpected result for empty array: %q, %q, %v", headers, rows, err)
+	}
+
+	_, _, err = FlattenToRows([]interface{}{map[string]interface{}{}, "x"})
+	if err == nil || err.Error() != "FlattenToRows: element 1 is string, not an object" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
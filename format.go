@@ -0,0 +1,172 @@
+package jsonx
+
+import (
+	"bytes"
+	"io"
+)
+
+// Format re-indents the JSONX-encoded data without decoding it: key order, number literals, strings and
+// typed atoms are preserved as they appear in src, only the whitespace between tokens is changed. Each
+// element of an array or an object begins on a new line starting with prefix followed by one or more
+// copies of indent according to the nesting depth, the same as MarshalIndent. Empty arrays and objects
+// are written as [] and {}. Trailing commas are dropped.
+//
+// Comments are preserved. A comment that follows a token on the same line stays on the line of that token
+// (after the comma, if there is one), any other comment is written on its own line before the next token.
+// If a run of comments that includes a line comment is followed by a comma, the comma is written before the
+// first of them. A comment between a key and its value is written after the colon. Comments inside typed
+// atoms are dropped.
+func Format(src []byte, prefix, indent string) ([]byte, error) {
+	d := NewDecoder(src)
+	d.AllowComments()
+	if err := d.Skip(); err != nil {
+		return nil, err
+	}
+	if err := d.extraData(); err != nil {
+		return nil, err
+	}
+
+	s := NewScanner(src)
+	s.KeepComments()
+	var tokens []scannedToken
+	for {
+		kind, raw, err := s.Scan()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, scannedToken{kind, raw, s.start})
+	}
+
+	var (
+		buf        bytes.Buffer
+		level      int
+		newline    bool // a newline is due before the next token
+		afterColon bool
+		commaDone  bool // the comma following a run of comments has been written before it
+		lastEnd    int
+	)
+	writeNewline := func() {
+		if newline {
+			buf.WriteByte('\n')
+			buf.WriteString(prefix)
+			for i := 0; i < level; i++ {
+				buf.WriteString(indent)
+			}
+			newline = false
+		}
+	}
+	// nextIsClose returns true if the next token other than a comment closes an array or an object
+	nextIsClose := func(i int, skipComments bool) bool {
+		for i++; i < len(tokens); i++ {
+			switch tokens[i].kind {
+			case TokenBraceClose, TokenBracketClose:
+				return true
+			case TokenComment:
+				if skipComments {
+					continue
+				}
+			}
+			break
+		}
+		return false
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		if tok.kind == TokenComment {
+			comment := bytes.TrimRight(tok.raw, "\r")
+			trailing := buf.Len() > 0 && bytes.IndexByte(src[lastEnd:tok.start], '\n') == -1
+			if !commaDone {
+				// look past the run of comments for a comma, which would otherwise end up inside a line comment
+				line := false
+				next := i
+				for ; next < len(tokens) && tokens[next].kind == TokenComment; next++ {
+					line = line || tokens[next].raw[1] == '/'
+				}
+				if line && next < len(tokens) && tokens[next].kind == TokenComma && !nextIsClose(next, true) {
+					buf.WriteByte(',')
+					commaDone = true
+				}
+			}
+			if trailing {
+				if afterColon {
+					buf.Write(comment)
+					if comment[1] != '/' {
+						buf.WriteByte(' ')
+					}
+				} else {
+					buf.WriteByte(' ')
+					buf.Write(comment)
+				}
+			} else {
+				if buf.Len() > 0 {
+					newline = true
+				}
+				writeNewline()
+				buf.Write(comment)
+				afterColon = false
+			}
+			if comment[1] == '/' || !trailing {
+				// a line comment must be followed by a newline
+				newline = true
+			}
+			lastEnd = tok.start + len(tok.raw)
+			continue
+		}
+		lastEnd = tok.start + len(tok.raw)
+		afterColon = false
+
+		switch tok.kind {
+		case TokenBraceOpen, TokenBracketOpen:
+			writeNewline()
+			buf.Write(tok.raw)
+			if nextIsClose(i, false) {
+				i++
+				lastEnd = tokens[i].start + len(tokens[i].raw)
+				buf.Write(tokens[i].raw)
+				continue
+			}
+			level++
+			newline = true
+		case TokenBraceClose, TokenBracketClose:
+			level--
+			newline = true
+			writeNewline()
+			buf.Write(tok.raw)
+		case TokenComma:
+			if nextIsClose(i, true) {
+				// trailing comma
+				continue
+			}
+			if !commaDone {
+				buf.WriteByte(',')
+			}
+			commaDone = false
+			newline = true
+		case TokenColon:
+			buf.WriteString(": ")
+			afterColon = true
+		case TokenTypedOpen:
+			writeNewline()
+			buf.Write(tok.raw)
+			buf.WriteByte('(')
+		case TokenTypedArg:
+			buf.Write(bytes.TrimRight(tok.raw, " \t\r\n"))
+		case TokenTypedClose:
+			buf.Write(tok.raw)
+		default:
+			writeNewline()
+			buf.Write(tok.raw)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+type scannedToken struct {
+	kind  TokenKind
+	raw   []byte
+	start int
+}
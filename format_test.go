@@ -0,0 +1,127 @@
+package jsonx
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	for i, tt := range []struct {
+		in, expected string
+	}{
+		{
+			in: `{z:1.50,a:[int64("9223372036854775807"),ipport( 10.0.0.1:80 ),"s"],"q k":{},e:[]}`,
+			expected: `{
+  z: 1.50,
+  a: [
+    int64("9223372036854775807"),
+    ipport(10.0.0.1:80),
+    "s"
+  ],
+  "q k": {},
+  e: []
+}`,
+		},
+		{
+			in: "[1e3, // comment\n {b: true, a: null,}, /* another */ [ ], ]",
+			expected: `[
+  1e3, // comment
+  {
+    b: true,
+    a: null
+  }, /* another */
+  []
+]`,
+		},
+		{in: ` "string" `, expected: `"string"`},
+	} {
+		b, err := Format([]byte(tt.in), "", "  ")
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if s := string(b); s != tt.expected {
+			t.Errorf("#%d: %s\nwant %s", i, s, tt.expected)
+		}
+	}
+
+	b, err := Format([]byte(`{a:[1]}`), ">", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != "{\n>\ta: [\n>\t\t1\n>\t]\n>}" {
+		t.Fatalf("Unexpected value: %q", s)
+	}
+
+	for _, in := range []string{`{a:}`, `[1] 2`, `{a:1`} {
+		if _, err := Format([]byte(in), "", "  "); err == nil {
+			t.Errorf("Expected error for %s", in)
+		}
+	}
+}
+
+func TestFormatComments(t *testing.T) {
+	for i, tt := range []struct {
+		in, expected string
+	}{
+		{
+			in: `// header
+/* block
+   header */
+{
+  // leading
+  a: 1, // trailing
+  b: /* inline */ 2,
+  c: // line after colon
+    3,
+  d: [1 /* after element */, 2,], // after array
+  e: {
+    // only a comment
+  },
+  /* before close */
+}
+// footer`,
+			expected: `// header
+/* block
+   header */
+{
+  // leading
+  a: 1, // trailing
+  b: /* inline */ 2,
+  c: // line after colon
+  3,
+  d: [
+    1 /* after element */,
+    2
+  ], // after array
+  e: {
+    // only a comment
+  }
+  /* before close */
+}
+// footer`,
+		},
+		{in: "[1,2]\r\n// crlf\r\n", expected: "[\n  1,\n  2\n]\n// crlf"},
+		{in: "[1 // one\n, 2]", expected: "[\n  1, // one\n  2\n]"},
+		{in: "[1\n// own line\n, 2]", expected: "[\n  1,\n  // own line\n  2\n]"},
+		{in: "{a: 1 /* block */ // line\n, b: 2 // last\n,}", expected: "{\n  a: 1, /* block */ // line\n  b: 2 // last\n}"},
+		{in: "[1 // a\n // b\n, 2]", expected: "[\n  1, // a\n  // b\n  2\n]"},
+		{in: "[1 // a\n /* b */ /* c */\n, 2, 3 /* d */ /* e */, 4]", expected: "[\n  1, // a\n  /* b */ /* c */\n  2,\n  3 /* d */ /* e */,\n  4\n]"},
+	} {
+		b, err := Format([]byte(tt.in), "", "  ")
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if s := string(b); s != tt.expected {
+			t.Errorf("#%d: %s\nwant %s", i, s, tt.expected)
+			continue
+		}
+		d := NewDecoder(b)
+		d.AllowComments()
+		if _, err := d.Decode(); err != nil {
+			t.Errorf("#%d: decoding the output: %v", i, err)
+		}
+		// formatting is idempotent
+		if b2, err := Format(b, "", "  "); err != nil || string(b2) != tt.expected {
+			t.Errorf("#%d: second pass: %s, %v", i, b2, err)
+		}
+	}
+}
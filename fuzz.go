@@ -8,7 +8,17 @@ func Fuzz(data []byte) int {
 		return 0
 	}
 
-	_, err = Marshal(v)
+	out, err := RoundTrip(data)
+	if err != nil {
+		panic(err)
+	}
+	v1, err := Decode(out)
+	if err != nil {
+		panic(err)
+	}
+	if !Equal(v, v1) {
+		panic("round trip mismatch: " + string(out))
+	}
 
 	return 1
 }
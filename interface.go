@@ -1,5 +1,16 @@
 package jsonx
 
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+)
+
 // A SyntaxError is a description of a JSON syntax error.
 type SyntaxError struct {
 	msg    string // description of error
@@ -8,19 +19,71 @@ type SyntaxError struct {
 
 func (e *SyntaxError) Error() string { return e.msg }
 
+// Is reports whether target is a SyntaxError with the same description. Predefined errors (which have
+// Offset set to -1) match regardless of the offset, so errors.Is(err, ErrUnexpectedEOF) works for
+// positioned errors too.
+func (e *SyntaxError) Is(target error) bool {
+	t, ok := target.(*SyntaxError)
+	return ok && t.msg == e.msg && (t.Offset == -1 || t.Offset == e.Offset)
+}
+
+// Unwrap returns io.ErrUnexpectedEOF for errors caused by premature end of input, nil otherwise.
+func (e *SyntaxError) Unwrap() error {
+	if e.msg == ErrUnexpectedEOF.msg {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
 // ExtraDataError is returned when a non-space data was found after parsing the top-level value.
-// Offset contains the position of the first byte.
+// Offset contains the position of the first byte, Tail the data starting at that position (it refers
+// to the input, so it must not be modified).
 type ExtraDataError struct {
 	Offset int
+	Tail   []byte
 }
 
 func (e *ExtraDataError) Error() string { return "Extra data after top-level value" }
 
+// InvalidUTF8Error is returned in StrictUTF8 mode when a string contains bytes that are not valid UTF-8
+// or an escaped UTF-16 surrogate that is not part of a valid pair. Offset contains the position of the
+// offending byte or escape sequence.
+type InvalidUTF8Error struct {
+	Offset int
+}
+
+func (e *InvalidUTF8Error) Error() string {
+	return "invalid UTF-8 in string at offset " + strconv.Itoa(e.Offset)
+}
+
+// IntRangeError is returned when the value of an integer atom (e.g. int8(-500)) is out of range for its type.
+// It unwraps to strconv.ErrRange.
+type IntRangeError struct {
+	Type   string // atom type, e.g. "int8"
+	Value  string // the offending literal
+	Offset int    // error occurred after reading Offset bytes
+}
+
+func (e *IntRangeError) Error() string { return "value " + e.Value + " out of range for " + e.Type }
+
+func (e *IntRangeError) Unwrap() error { return strconv.ErrRange }
+
 // Predefined errors
 var (
 	ErrUnexpectedEOF    = &SyntaxError{"unexpected end of JSON input", -1}
 	ErrInvalidHexEscape = &SyntaxError{"invalid hexadecimal escape sequence", -1}
 	ErrStringEscape     = &SyntaxError{"encountered an invalid escape sequence in a string", -1}
+	ErrMaxDepth         = &SyntaxError{"exceeded maximum nesting depth", -1}
+	ErrStringTooLong    = &SyntaxError{"string exceeds maximum length", -1}
+	ErrTooManyKeys      = &SyntaxError{"object exceeds maximum number of keys", -1}
+
+	ErrInputTooLarge = errors.New("input exceeds maximum size")
+	// ErrOutputTooLarge is returned by Encoder.Encode if the output exceeds the limit set with SetMaxOutputBytes.
+	ErrOutputTooLarge = errors.New("output exceeds maximum size")
+	// ErrEmptyInput is returned by Decode and the other Decoder methods that decode a top-level value (e.g.
+	// DecodeObject, EachArrayElement, PeekType or Skip) if the input is empty or contains only whitespace (and
+	// comments, if allowed).
+	ErrEmptyInput = errors.New("empty input")
 )
 
 // ValueType identifies the type of a parsed value.
@@ -38,6 +101,17 @@ const (
 	Object
 	Array
 	Unknown
+
+	// extended types
+	DateTime // time.Time
+	Duration // time.Duration
+	IP       // net.IP
+	IPPort   // net.TCPAddr
+	Bytes    // []byte
+	Int      // int, int8, int16, int32 and int64
+	Uint     // uint, uint8, uint16, uint32 and uint64
+	CIDR     // *net.IPNet
+	Regexp   // *regexp.Regexp
 )
 
 var types = map[ValueType]string{
@@ -48,9 +122,20 @@ var types = map[ValueType]string{
 	Object:  "object",
 	Array:   "array",
 	Unknown: "unknown",
+
+	DateTime: "datetime",
+	Duration: "duration",
+	IP:       "ip",
+	IPPort:   "ipport",
+	Bytes:    "bytes",
+	Int:      "int",
+	Uint:     "uint",
+	CIDR:     "cidr",
+	Regexp:   "regexp",
 }
 
-// Type returns the JSON-type of the given value
+// Type returns the JSON-type of the given value or, for the types produced by the typed atoms, the
+// extended type
 func Type(v interface{}) ValueType {
 	t := Unknown
 	switch v.(type) {
@@ -60,12 +145,36 @@ func Type(v interface{}) ValueType {
 		t = Bool
 	case string:
 		t = String
-	case float64:
+	case float64, json.Number, RawNumber:
 		t = Number
 	case []interface{}:
 		t = Array
 	case map[string]interface{}:
 		t = Object
+	case *OrderedMap:
+		if nilOrderedMap(v) == nil {
+			t = Null
+		} else {
+			t = Object
+		}
+	case time.Time:
+		t = DateTime
+	case time.Duration:
+		t = Duration
+	case net.IP:
+		t = IP
+	case net.TCPAddr, *net.TCPAddr:
+		t = IPPort
+	case []byte:
+		t = Bytes
+	case int, int8, int16, int32, int64:
+		t = Int
+	case uint, uint8, uint16, uint32, uint64:
+		t = Uint
+	case *net.IPNet, net.IPNet:
+		t = CIDR
+	case *regexp.Regexp:
+		t = Regexp
 	}
 	return t
 }
@@ -87,3 +196,32 @@ func DecodeObject(data []byte) (map[string]interface{}, error) {
 func DecodeArray(data []byte) ([]interface{}, error) {
 	return NewDecoder(data).DecodeArray()
 }
+
+// DecodeFile reads the named file and decodes its content, see Decode.
+// Errors reading the file are returned as is (i.e. as *os.PathError), so they can be distinguished
+// from the decoding errors.
+func DecodeFile(path string) (interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(data)
+}
+
+// DecodeFileObject is the same as DecodeFile but it returns map[string]interface{}.
+func DecodeFileObject(path string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeObject(data)
+}
+
+// DecodeFileArray is the same as DecodeFile but it returns []interface{}.
+func DecodeFileArray(path string) ([]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeArray(data)
+}
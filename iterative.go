@@ -0,0 +1,161 @@
+package jsonx
+
+// frame is an array or an object being decoded by nested
+type frame struct {
+	array []interface{}
+	obj   map[string]interface{}
+	omap  *OrderedMap // the object if it preserves the key order, obj is its map
+	key   string      // key of the value being decoded, objects only
+	n     int         // number of values decoded so far
+}
+
+func (f *frame) closing() byte {
+	if f.obj != nil {
+		return '}'
+	}
+	return ']'
+}
+
+func (f *frame) add(v interface{}) {
+	if f.omap != nil {
+		f.omap.Set(f.key, v)
+	} else if f.obj != nil {
+		f.obj[f.key] = v
+	} else {
+		f.array = append(f.array, v)
+	}
+	f.n++
+}
+
+func (f *frame) value() interface{} {
+	if f.omap != nil {
+		return f.omap
+	}
+	if f.obj != nil {
+		return f.obj
+	}
+	if f.array == nil {
+		return emptyArrayValue
+	}
+	return f.array
+}
+
+// Iterative makes the Decoder decode nested arrays and objects using a stack allocated on the heap rather
+// than recursive calls, so that the goroutine stack usage does not depend on the nesting depth of the
+// input. The result is the same as with the recursive decoding, which is somewhat faster and remains
+// the default. Skip is not affected.
+func (d *Decoder) Iterative() {
+	d.iterative = true
+}
+
+// nested decodes the array or the object at the current position without recursion. If root is not nil
+// the object's keys are stored in it.
+func (d *Decoder) nested(root map[string]interface{}) (v interface{}, err error) {
+	depth := d.depth
+	defer func() {
+		if err != nil {
+			d.depth = depth
+		}
+	}()
+
+	var stack []frame
+	push := func() error {
+		if err := d.enter(); err != nil {
+			return err
+		}
+		var f frame
+		if d.data[d.pos] == '{' {
+			if root != nil {
+				f.obj = root
+			} else if d.ordered {
+				f.omap = NewOrderedMap()
+				f.obj = f.omap.values
+			} else {
+				f.obj = make(map[string]interface{})
+			}
+			root = nil
+		}
+		// the '[' or '{' token already scanned
+		d.pos++
+		stack = append(stack, f)
+		return nil
+	}
+	if err = push(); err != nil {
+		return nil, err
+	}
+
+	for {
+		top := &stack[len(stack)-1]
+		if c := d.skipSpaces(); c == top.closing() {
+			if d.strict && top.n != 0 {
+				if top.obj != nil {
+					return nil, d.error(c, "looking for beginning of object key string")
+				}
+				return nil, d.error(c, "looking for beginning of value")
+			}
+			d.pos++
+		} else {
+			if top.obj != nil {
+				keyPos := d.pos
+				if top.key, err = d.objectKey(); err != nil {
+					return nil, err
+				}
+				if d.maxKeys > 0 && len(top.obj) >= d.maxKeys {
+					if _, exists := top.obj[top.key]; !exists {
+						return nil, &SyntaxError{ErrTooManyKeys.msg, keyPos + 1}
+					}
+				}
+				if c = d.skipSpaces(); c != ':' {
+					return nil, d.error(c, "after object key")
+				}
+				d.pos++
+				d.skipSpaces()
+			}
+			if d.pos < d.end && (d.data[d.pos] == '[' || d.data[d.pos] == '{') {
+				if err = push(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if v, err = d.any(); err != nil {
+				return nil, err
+			}
+			top.add(v)
+			if closed, err := d.separator(top); err != nil {
+				return nil, err
+			} else if !closed {
+				continue
+			}
+		}
+
+		// the top container is complete, add it to its parent and close the parents that are complete too
+		for {
+			v = stack[len(stack)-1].value()
+			stack = stack[:len(stack)-1]
+			d.depth--
+			if len(stack) == 0 {
+				return v, nil
+			}
+			top = &stack[len(stack)-1]
+			top.add(v)
+			if closed, err := d.separator(top); err != nil {
+				return nil, err
+			} else if !closed {
+				break
+			}
+		}
+	}
+}
+
+// separator reads the ',' or the closing bracket following an element of f and returns true in the latter case
+func (d *Decoder) separator(f *frame) (bool, error) {
+	c := d.skipSpaces()
+	if c == ',' || c == f.closing() {
+		d.pos++
+		return c != ',', nil
+	}
+	if f.obj != nil {
+		return false, d.error(c, "after object key:value pair")
+	}
+	return false, d.error(c, "after array element")
+}
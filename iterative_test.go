@@ -0,0 +1,83 @@
+package jsonx
+
+import (
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestIterative(t *testing.T) {
+	for i, tt := range []struct {
+		in   string
+		opts []DecodeOption
+	}{
+		{in: `[]`},
+		{in: `{}`},
+		{in: `[1, [2, []], {a: [{}], b: {c: "x"}}, null,]`},
+		{in: `{a: {b: {c: [1, 2, {d: int8(3)}]}}, e: [[]], f: ip("1.2.3.4")}`},
+		{in: ` [ "a" "b" ] `},
+		{in: `{a: 1 b: 2}`},
+		{in: `[1, 2,]`, opts: []DecodeOption{WithStrict()}},
+		{in: `{a: 1,}`, opts: []DecodeOption{WithStrict()}},
+		{in: `[[[[1]]]]`, opts: []DecodeOption{WithMaxDepth(3)}},
+		{in: `{a: 1, b: {c: 2, d: 3}}`, opts: []DecodeOption{WithMaxObjectKeys(1)}},
+		{in: `[{a: 1}, {a: 2}] x`},
+		{in: `[1, {a: `},
+		{in: `{"a" 1}`},
+	} {
+		rd := NewDecoderWithOptions([]byte(tt.in), tt.opts...)
+		expected, expectedErr := rd.Decode()
+		id := NewDecoderWithOptions([]byte(tt.in), append(tt.opts, WithIterative())...)
+		v, err := id.Decode()
+		if !reflect.DeepEqual(err, expectedErr) {
+			t.Errorf("#%d: error %v, expected %v", i, err, expectedErr)
+			continue
+		}
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("#%d: %#v, expected %#v", i, v, expected)
+		}
+		if id.Offset() != rd.Offset() || id.depth != 0 {
+			t.Errorf("#%d: offset %d, depth %d, expected offset %d", i, id.Offset(), id.depth, rd.Offset())
+		}
+	}
+}
+
+func TestIterativeDecodeInto(t *testing.T) {
+	d := NewDecoderWithOptions([]byte(`{a: [1, {b: 2}]}`), WithIterative())
+	m := map[string]interface{}{"x": true}
+	if err := d.DecodeInto(m, true); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"x": true, "a": []interface{}{1.0, map[string]interface{}{"b": 2.0}}}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("Unexpected value: %#v", m)
+	}
+}
+
+func TestIterativeDeep(t *testing.T) {
+	const depth = 100000
+	// far less than the recursive decoding needs for this depth
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+
+	src := strings.Repeat(`[{a:`, depth) + `1` + strings.Repeat(`}]`, depth)
+	d := NewDecoderWithOptions([]byte(src), WithIterative())
+	v, err := d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < depth; i++ {
+		a, ok := v.([]interface{})
+		if !ok || len(a) != 1 {
+			t.Fatalf("%d: unexpected value %T", i, v)
+		}
+		m, ok := a[0].(map[string]interface{})
+		if !ok || len(m) != 1 {
+			t.Fatalf("%d: unexpected value %T", i, a[0])
+		}
+		v = m["a"]
+	}
+	if v != 1.0 {
+		t.Fatalf("Unexpected value: %v", v)
+	}
+}
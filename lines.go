@@ -0,0 +1,41 @@
+package jsonx
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// LineError is returned by DecodeLines when a line cannot be decoded or the callback fails.
+type LineError struct {
+	Line int   // 1-based line number
+	Err  error // the error, offsets of syntax errors are relative to the beginning of the line
+}
+
+func (e *LineError) Error() string { return "line " + strconv.Itoa(e.Line) + ": " + e.Err.Error() }
+
+func (e *LineError) Unwrap() error { return e.Err }
+
+// DecodeLines decodes newline-delimited values (e.g. NDJSON): each line that is not blank must contain exactly
+// one value, which is passed to fn. Decoding stops at the first error, which is returned as LineError.
+func DecodeLines(data []byte, fn func(v interface{}) error) error {
+	for line := 1; len(data) > 0; line++ {
+		var l []byte
+		if i := bytes.IndexByte(data, '\n'); i != -1 {
+			l, data = data[:i], data[i+1:]
+		} else {
+			l, data = data, nil
+		}
+		d := NewDecoder(l)
+		if d.skipSpaces(); d.pos >= d.end {
+			continue
+		}
+		v, err := d.Decode()
+		if err == nil {
+			err = fn(v)
+		}
+		if err != nil {
+			return &LineError{Line: line, Err: err}
+		}
+	}
+	return nil
+}
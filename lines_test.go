@@ -0,0 +1,55 @@
+package jsonx
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeLines(t *testing.T) {
+	var values []interface{}
+	collect := func(v interface{}) error {
+		values = append(values, v)
+		return nil
+	}
+	err := DecodeLines([]byte("{a: 1}\n\n  [1, 2]\r\n \t\n\"s\""), collect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{map[string]interface{}{"a": 1.0}, []interface{}{1.0, 2.0}, "s"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Fatalf("Unexpected values: %#v", values)
+	}
+
+	for i, tt := range []struct {
+		in    string
+		line  int
+		err   error
+		count int
+	}{
+		{in: "{a: 1}\n{a: }\n{a: 3}\n", line: 2, err: &SyntaxError{"invalid character '}' looking for atom", 5}, count: 1},
+		{in: "1\n\n2 3\n", line: 3, err: &ExtraDataError{2, []byte("3")}, count: 1},
+		{in: "[1,\n2]", line: 1, err: ErrUnexpectedEOF},
+	} {
+		values = nil
+		err := DecodeLines([]byte(tt.in), collect)
+		var lerr *LineError
+		if !errors.As(err, &lerr) || lerr.Line != tt.line || !reflect.DeepEqual(lerr.Err, tt.err) {
+			t.Errorf("#%d: unexpected error %#v", i, err)
+		}
+		if len(values) != tt.count {
+			t.Errorf("#%d: unexpected values %v", i, values)
+		}
+	}
+
+	stop := errors.New("stop")
+	err = DecodeLines([]byte("1\n2\n3"), func(v interface{}) error {
+		if v == 2.0 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || err.Error() != "line 2: stop" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+package jsonx
+
+import (
+	"net"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// Node is a decoded value represented as a tagged union rather than interface{}, see Decoder.DecodeNode.
+// Kind reports the type of the value (including the extended types produced by the typed atoms) and the
+// getters return the value if it is of the matching kind. Arrays and objects contain Nodes, object keys
+// are kept in the order they appear in the input. The zero value is a null Node.
+type Node struct {
+	kind ValueType
+	v    interface{} // the value as returned by Decode, scalars only
+	arr  []Node
+	keys []string
+	obj  map[string]Node
+}
+
+// NodeOf converts a value as returned by Decode to a Node. The keys of map[string]interface{} are sorted,
+// the keys of *OrderedMap keep their order. Values of types that Decode does not produce have Unknown kind.
+func NodeOf(v interface{}) Node {
+	switch v := v.(type) {
+	case []interface{}:
+		arr := make([]Node, len(v))
+		for i, e := range v {
+			arr[i] = NodeOf(e)
+		}
+		return Node{kind: Array, arr: arr}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return objectNode(keys, v)
+	case *OrderedMap:
+		if v == nil {
+			return NodeOf(nil)
+		}
+		return objectNode(v.Keys(), v.values)
+	}
+	return Node{kind: Type(v), v: v}
+}
+
+func objectNode(keys []string, m map[string]interface{}) Node {
+	obj := make(map[string]Node, len(keys))
+	for _, k := range keys {
+		obj[k] = NodeOf(m[k])
+	}
+	return Node{kind: Object, keys: keys, obj: obj}
+}
+
+// DecodeNode is the same as Decode but it returns the value as a Node.
+func (d *Decoder) DecodeNode() (Node, error) {
+	ordered := d.ordered
+	d.ordered = true
+	v, err := d.Decode()
+	d.ordered = ordered
+	if v == nil && err != nil {
+		return Node{}, err
+	}
+	return NodeOf(v), err
+}
+
+// Kind returns the type of the value.
+func (n Node) Kind() ValueType {
+	return n.kind
+}
+
+// IsNull returns true if the value is null.
+func (n Node) IsNull() bool {
+	return n.kind == Null
+}
+
+// Value returns the value as returned by Decode, arrays as []interface{} and objects as *OrderedMap.
+func (n Node) Value() interface{} {
+	switch n.kind {
+	case Array:
+		arr := make([]interface{}, len(n.arr))
+		for i, e := range n.arr {
+			arr[i] = e.Value()
+		}
+		return arr
+	case Object:
+		m := NewOrderedMap()
+		for _, k := range n.keys {
+			m.Set(k, n.obj[k].Value())
+		}
+		return m
+	}
+	return n.v
+}
+
+// Len returns the number of elements of an array or keys of an object, 0 for other kinds.
+func (n Node) Len() int {
+	if n.kind == Object {
+		return len(n.keys)
+	}
+	return len(n.arr)
+}
+
+// Index returns the i-th element of an array. It panics if the Node is not an array or i is out of range.
+func (n Node) Index(i int) Node {
+	if n.kind != Array {
+		panic("jsonx: Index of " + n.kind.String() + " Node")
+	}
+	return n.arr[i]
+}
+
+// Elements returns the elements of an array, nil for other kinds. The slice must not be modified.
+func (n Node) Elements() []Node {
+	return n.arr
+}
+
+// Keys returns the keys of an object in the input order, nil for other kinds. The slice must not be modified.
+func (n Node) Keys() []string {
+	return n.keys
+}
+
+// Get returns the value for the key of an object and whether it exists.
+func (n Node) Get(key string) (Node, bool) {
+	v, ok := n.obj[key]
+	return v, ok
+}
+
+// AsBool returns the value if the Node is a boolean.
+func (n Node) AsBool() (bool, bool) {
+	return AsBool(n.v)
+}
+
+// AsString returns the value if the Node is a string.
+func (n Node) AsString() (string, bool) {
+	return AsString(n.v)
+}
+
+// AsFloat returns the value if the Node is a number, an int or a uint, see AsFloat.
+func (n Node) AsFloat() (float64, bool) {
+	return AsFloat(n.v)
+}
+
+// AsInt64 returns the value if the Node is an integral number, an int or a uint in range, see AsInt64.
+func (n Node) AsInt64() (int64, bool) {
+	return AsInt64(n.v)
+}
+
+// AsUint64 returns the value if the Node is a uint.
+func (n Node) AsUint64() (uint64, bool) {
+	switch v := n.v.(type) {
+	case uint:
+		return uint64(v), true
+	case uint8:
+		return uint64(v), true
+	case uint16:
+		return uint64(v), true
+	case uint32:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	}
+	return 0, false
+}
+
+// AsTime returns the value if the Node is a datetime.
+func (n Node) AsTime() (time.Time, bool) {
+	t, ok := n.v.(time.Time)
+	return t, ok
+}
+
+// AsDuration returns the value if the Node is a duration.
+func (n Node) AsDuration() (time.Duration, bool) {
+	d, ok := n.v.(time.Duration)
+	return d, ok
+}
+
+// AsIP returns the value if the Node is an ip.
+func (n Node) AsIP() (net.IP, bool) {
+	ip, ok := n.v.(net.IP)
+	return ip, ok
+}
+
+// AsTCPAddr returns the value if the Node is an ipport.
+func (n Node) AsTCPAddr() (net.TCPAddr, bool) {
+	switch v := n.v.(type) {
+	case net.TCPAddr:
+		return v, true
+	case *net.TCPAddr:
+		if v != nil {
+			return *v, true
+		}
+	}
+	return net.TCPAddr{}, false
+}
+
+// AsIPNet returns the value if the Node is a cidr.
+func (n Node) AsIPNet() (*net.IPNet, bool) {
+	switch v := n.v.(type) {
+	case *net.IPNet:
+		return v, true
+	case net.IPNet:
+		return &v, true
+	}
+	return nil, false
+}
+
+// AsBytes returns the value if the Node is bytes.
+func (n Node) AsBytes() ([]byte, bool) {
+	b, ok := n.v.([]byte)
+	return b, ok
+}
+
+// AsRegexp returns the value if the Node is a regexp.
+func (n Node) AsRegexp() (*regexp.Regexp, bool) {
+	re, ok := n.v.(*regexp.Regexp)
+	return re, ok
+}
@@ -0,0 +1,118 @@
+package jsonx
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeNode(t *testing.T) {
+	d := NewDecoder([]byte(`{name: "x", tags: ["a", true, null], size: 1.5, count: int8(3), id: uint64(7), ` +
+		`ttl: duration("1m"), addr: ip("10.0.0.1"), nested: {b: 1, a: 2}}`))
+	n, err := d.DecodeNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Kind() != Object {
+		t.Fatalf("Unexpected kind: %v", n.Kind())
+	}
+	if keys := n.Keys(); !reflect.DeepEqual(keys, []string{"name", "tags", "size", "count", "id", "ttl", "addr", "nested"}) {
+		t.Fatalf("Unexpected keys: %v", keys)
+	}
+
+	expected := map[string]ValueType{
+		"name":   String,
+		"tags":   Array,
+		"size":   Number,
+		"count":  Int,
+		"id":     Uint,
+		"ttl":    Duration,
+		"addr":   IP,
+		"nested": Object,
+	}
+	for key, kind := range expected {
+		v, ok := n.Get(key)
+		if !ok || v.Kind() != kind {
+			t.Errorf("%s: unexpected kind %v (%v)", key, v.Kind(), ok)
+		}
+	}
+
+	name, _ := n.Get("name")
+	if s, ok := name.AsString(); !ok || s != "x" {
+		t.Errorf("Unexpected name: %q", s)
+	}
+	if _, ok := name.AsFloat(); ok {
+		t.Error("String node converted to float")
+	}
+
+	tags, _ := n.Get("tags")
+	if tags.Len() != 3 {
+		t.Fatalf("Unexpected length: %d", tags.Len())
+	}
+	if b, ok := tags.Index(1).AsBool(); !ok || !b {
+		t.Error("Unexpected tags[1]")
+	}
+	if !tags.Index(2).IsNull() {
+		t.Error("tags[2] is not null")
+	}
+
+	count, _ := n.Get("count")
+	if i, ok := count.AsInt64(); !ok || i != 3 {
+		t.Errorf("Unexpected count: %d", i)
+	}
+	id, _ := n.Get("id")
+	if u, ok := id.AsUint64(); !ok || u != 7 {
+		t.Errorf("Unexpected id: %d", u)
+	}
+	ttl, _ := n.Get("ttl")
+	if v, ok := ttl.AsDuration(); !ok || v != time.Minute {
+		t.Errorf("Unexpected ttl: %v", v)
+	}
+	addr, _ := n.Get("addr")
+	if ip, ok := addr.AsIP(); !ok || ip.String() != "10.0.0.1" {
+		t.Errorf("Unexpected addr: %v", ip)
+	}
+
+	nested, _ := n.Get("nested")
+	if keys := nested.Keys(); !reflect.DeepEqual(keys, []string{"b", "a"}) {
+		t.Errorf("Unexpected nested keys: %v", keys)
+	}
+	if _, ok := nested.Get("c"); ok {
+		t.Error("Missing key found")
+	}
+
+	// the Decoder's own setting is not affected
+	if d.ordered {
+		t.Error("PreserveKeyOrder changed")
+	}
+}
+
+func TestNodeOf(t *testing.T) {
+	n := NodeOf(map[string]interface{}{
+		"b": []interface{}{1.0, "s"},
+		"a": nil,
+	})
+	if keys := n.Keys(); !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Fatalf("Unexpected keys: %v", keys)
+	}
+	b, _ := n.Get("b")
+	if f, ok := b.Elements()[0].AsFloat(); !ok || f != 1 {
+		t.Errorf("Unexpected b[0]: %v", f)
+	}
+	if NodeOf(struct{}{}).Kind() != Unknown {
+		t.Error("Unexpected kind of a struct")
+	}
+
+	var zero Node
+	if !zero.IsNull() || zero.Len() != 0 || zero.Value() != nil {
+		t.Error("Zero Node is not null")
+	}
+
+	data, err := Marshal(n.Value())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{a:null,b:[1,"s"]}` {
+		t.Errorf("Unexpected value: %s", data)
+	}
+}
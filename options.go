@@ -0,0 +1,342 @@
+package jsonx
+
+import "io"
+
+// DecodeOption configures a Decoder, see NewDecoderWithOptions.
+type DecodeOption func(d *Decoder)
+
+// NewDecoderWithOptions creates new Decoder from the JSON-encoded data and applies the options.
+func NewDecoderWithOptions(data []byte, opts ...DecodeOption) *Decoder {
+	d := NewDecoder(data)
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// WithAllocString is the option equivalent of Decoder.AllocString.
+func WithAllocString() DecodeOption {
+	return func(d *Decoder) {
+		d.AllocString()
+	}
+}
+
+// WithUseNumber is the option equivalent of Decoder.UseNumber.
+func WithUseNumber() DecodeOption {
+	return func(d *Decoder) {
+		d.UseNumber()
+	}
+}
+
+// WithIPv4Mapped is the option equivalent of Decoder.PreserveIPv4Mapped.
+func WithIPv4Mapped() DecodeOption {
+	return func(d *Decoder) {
+		d.PreserveIPv4Mapped()
+	}
+}
+
+// WithCaseInsensitiveFields is the option equivalent of Decoder.CaseInsensitiveFields.
+func WithCaseInsensitiveFields(enable bool) DecodeOption {
+	return func(d *Decoder) {
+		d.CaseInsensitiveFields(enable)
+	}
+}
+
+// WithRawNumbers is the option equivalent of Decoder.RawNumbers.
+func WithRawNumbers() DecodeOption {
+	return func(d *Decoder) {
+		d.RawNumbers()
+	}
+}
+
+// WithEpochUnit is the option equivalent of Decoder.SetEpochUnit.
+func WithEpochUnit(unit EpochUnit) DecodeOption {
+	return func(d *Decoder) {
+		d.SetEpochUnit(unit)
+	}
+}
+
+// WithNumberConverter is the option equivalent of Decoder.SetNumberConverter.
+func WithNumberConverter(conv func(raw []byte) (interface{}, error)) DecodeOption {
+	return func(d *Decoder) {
+		d.SetNumberConverter(conv)
+	}
+}
+
+// WithInternKeys is the option equivalent of Decoder.InternKeys.
+func WithInternKeys() DecodeOption {
+	return func(d *Decoder) {
+		d.InternKeys()
+	}
+}
+
+// WithComments is the option equivalent of Decoder.AllowComments.
+func WithComments() DecodeOption {
+	return func(d *Decoder) {
+		d.AllowComments()
+	}
+}
+
+// WithRawStrings is the option equivalent of Decoder.AllowRawStrings.
+func WithRawStrings() DecodeOption {
+	return func(d *Decoder) {
+		d.AllowRawStrings()
+	}
+}
+
+// WithStringConcat is the option equivalent of Decoder.AllowStringConcat.
+func WithStringConcat() DecodeOption {
+	return func(d *Decoder) {
+		d.AllowStringConcat()
+	}
+}
+
+// WithExtendedKeys is the option equivalent of Decoder.AllowExtendedKeys.
+func WithExtendedKeys() DecodeOption {
+	return func(d *Decoder) {
+		d.AllowExtendedKeys()
+	}
+}
+
+// WithStrictUTF8 is the option equivalent of Decoder.StrictUTF8.
+func WithStrictUTF8() DecodeOption {
+	return func(d *Decoder) {
+		d.StrictUTF8()
+	}
+}
+
+// WithInvalidUTF8Policy is the option equivalent of Decoder.SetInvalidUTF8Policy.
+func WithInvalidUTF8Policy(policy InvalidUTF8Policy) DecodeOption {
+	return func(d *Decoder) {
+		d.SetInvalidUTF8Policy(policy)
+	}
+}
+
+// WithPreserveKeyOrder is the option equivalent of Decoder.PreserveKeyOrder.
+func WithPreserveKeyOrder() DecodeOption {
+	return func(d *Decoder) {
+		d.PreserveKeyOrder()
+	}
+}
+
+// WithIterative is the option equivalent of Decoder.Iterative.
+func WithIterative() DecodeOption {
+	return func(d *Decoder) {
+		d.Iterative()
+	}
+}
+
+// WithLeadingPlus is the option equivalent of Decoder.AllowLeadingPlus.
+func WithLeadingPlus() DecodeOption {
+	return func(d *Decoder) {
+		d.AllowLeadingPlus()
+	}
+}
+
+// WithBoolAliases is the option equivalent of Decoder.AllowBoolAliases.
+func WithBoolAliases() DecodeOption {
+	return func(d *Decoder) {
+		d.AllowBoolAliases()
+	}
+}
+
+// WithCaseInsensitiveKeywords is the option equivalent of Decoder.CaseInsensitiveKeywords.
+func WithCaseInsensitiveKeywords() DecodeOption {
+	return func(d *Decoder) {
+		d.CaseInsensitiveKeywords()
+	}
+}
+
+// WithTrailingData is the option equivalent of Decoder.AllowTrailingData.
+func WithTrailingData() DecodeOption {
+	return func(d *Decoder) {
+		d.AllowTrailingData()
+	}
+}
+
+// WithStrict is the option equivalent of Decoder.Strict.
+func WithStrict() DecodeOption {
+	return func(d *Decoder) {
+		d.Strict()
+	}
+}
+
+// WithMaxDepth is the option equivalent of Decoder.SetMaxDepth.
+func WithMaxDepth(n int) DecodeOption {
+	return func(d *Decoder) {
+		d.SetMaxDepth(n)
+	}
+}
+
+// WithMaxStringLen is the option equivalent of Decoder.SetMaxStringLen.
+func WithMaxStringLen(n int) DecodeOption {
+	return func(d *Decoder) {
+		d.SetMaxStringLen(n)
+	}
+}
+
+// WithMaxObjectKeys is the option equivalent of Decoder.SetMaxObjectKeys.
+func WithMaxObjectKeys(n int) DecodeOption {
+	return func(d *Decoder) {
+		d.SetMaxObjectKeys(n)
+	}
+}
+
+// WithMaxInputSize is the option equivalent of Decoder.SetMaxInputSize.
+func WithMaxInputSize(n int64) DecodeOption {
+	return func(d *Decoder) {
+		d.SetMaxInputSize(n)
+	}
+}
+
+// EncodeOption configures an Encoder, see NewEncoderWithOptions.
+type EncodeOption func(e *Encoder)
+
+// NewEncoderWithOptions creates new Encoder writing to w and applies the options.
+func NewEncoderWithOptions(w io.Writer, opts ...EncodeOption) *Encoder {
+	e := NewEncoder(w)
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// WithIndent is the option equivalent of Encoder.SetIndent.
+func WithIndent(prefix, indent string) EncodeOption {
+	return func(e *Encoder) {
+		e.SetIndent(prefix, indent)
+	}
+}
+
+// WithSortKeys is the option equivalent of Encoder.SortKeys.
+func WithSortKeys(sort bool) EncodeOption {
+	return func(e *Encoder) {
+		e.SortKeys(sort)
+	}
+}
+
+// WithEscapeHTML is the option equivalent of Encoder.EscapeHTML.
+func WithEscapeHTML(escape bool) EncodeOption {
+	return func(e *Encoder) {
+		e.EscapeHTML(escape)
+	}
+}
+
+// WithCompatJSON is the option equivalent of Encoder.CompatJSON(true).
+func WithCompatJSON() EncodeOption {
+	return func(e *Encoder) {
+		e.CompatJSON(true)
+	}
+}
+
+// WithRawStringOutput is the option equivalent of Encoder.RawStrings.
+func WithRawStringOutput(raw bool) EncodeOption {
+	return func(e *Encoder) {
+		e.RawStrings(raw)
+	}
+}
+
+// WithTerminator is the option equivalent of Encoder.SetTerminator.
+func WithTerminator(terminator string) EncodeOption {
+	return func(e *Encoder) {
+		e.SetTerminator(terminator)
+	}
+}
+
+// WithDateTimeLayout is the option equivalent of Encoder.SetDateTimeLayout.
+func WithDateTimeLayout(layout string) EncodeOption {
+	return func(e *Encoder) {
+		e.SetDateTimeLayout(layout)
+	}
+}
+
+// WithBytesFormat is the option equivalent of Encoder.SetBytesFormat.
+func WithBytesFormat(format BytesFormat) EncodeOption {
+	return func(e *Encoder) {
+		e.SetBytesFormat(format)
+	}
+}
+
+// WithIPv4MappedOutput is the option equivalent of Encoder.PreserveIPv4Mapped.
+func WithIPv4MappedOutput(preserve bool) EncodeOption {
+	return func(e *Encoder) {
+		e.PreserveIPv4Mapped(preserve)
+	}
+}
+
+// WithExtendedKeyOutput is the option equivalent of Encoder.ExtendedKeys.
+func WithExtendedKeyOutput(extended bool) EncodeOption {
+	return func(e *Encoder) {
+		e.ExtendedKeys(extended)
+	}
+}
+
+// WithQuoteKeys is the option equivalent of Encoder.QuoteKeys.
+func WithQuoteKeys(quote bool) EncodeOption {
+	return func(e *Encoder) {
+		e.QuoteKeys(quote)
+	}
+}
+
+// WithEscapeUnicode is the option equivalent of Encoder.EscapeUnicode.
+func WithEscapeUnicode(escape bool) EncodeOption {
+	return func(e *Encoder) {
+		e.EscapeUnicode(escape)
+	}
+}
+
+// WithOmitNull is the option equivalent of Encoder.OmitNull.
+func WithOmitNull(omit bool) EncodeOption {
+	return func(e *Encoder) {
+		e.OmitNull(omit)
+	}
+}
+
+// WithEscapeSlash is the option equivalent of Encoder.EscapeSlash.
+func WithEscapeSlash(escape bool) EncodeOption {
+	return func(e *Encoder) {
+		e.EscapeSlash(escape)
+	}
+}
+
+// WithErrorsAsString is the option equivalent of Encoder.EncodeErrorsAsString.
+func WithErrorsAsString(enable bool) EncodeOption {
+	return func(e *Encoder) {
+		e.EncodeErrorsAsString(enable)
+	}
+}
+
+// WithQuoteLargeIntegers is the option equivalent of Encoder.QuoteLargeIntegers.
+func WithQuoteLargeIntegers(quote bool) EncodeOption {
+	return func(e *Encoder) {
+		e.QuoteLargeIntegers(quote)
+	}
+}
+
+// WithOmitIntegerTypeTags is the option equivalent of Encoder.OmitIntegerTypeTags.
+func WithOmitIntegerTypeTags(omit bool) EncodeOption {
+	return func(e *Encoder) {
+		e.OmitIntegerTypeTags(omit)
+	}
+}
+
+// WithResolveFuncs is the option equivalent of Encoder.ResolveFuncs.
+func WithResolveFuncs(resolve bool) EncodeOption {
+	return func(e *Encoder) {
+		e.ResolveFuncs(resolve)
+	}
+}
+
+// WithMaxLineWidth is the option equivalent of Encoder.SetMaxLineWidth.
+func WithMaxLineWidth(n int) EncodeOption {
+	return func(e *Encoder) {
+		e.SetMaxLineWidth(n)
+	}
+}
+
+// WithMaxOutputBytes is the option equivalent of Encoder.SetMaxOutputBytes.
+func WithMaxOutputBytes(n int) EncodeOption {
+	return func(e *Encoder) {
+		e.SetMaxOutputBytes(n)
+	}
+}
@@ -0,0 +1,193 @@
+package jsonx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecoderOptions(t *testing.T) {
+	data := []byte(`// header
+	{
+		"a": [1, /* inline */ 2], // trailing
+		"b": {"c": true}
+	}`)
+	d := NewDecoderWithOptions(data, WithComments(), WithStrict(), WithMaxDepth(2), WithAllocString(), WithInternKeys())
+	if !d.comments || !d.strict || d.maxDepth != 2 || !d.usestring || d.keys == nil {
+		t.Fatalf("Options were not applied: %+v", d)
+	}
+	v, err := d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"a": []interface{}{1.0, 2.0},
+		"b": map[string]interface{}{"c": true},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("Unexpected value: %v", v)
+	}
+}
+
+func TestComments(t *testing.T) {
+	for i, tt := range []struct {
+		in       string
+		expected interface{}
+		err      error
+	}{
+		{in: `/* a */ 1 // b`, expected: 1.0},
+		{in: "[1, // one\n 2 /* two */,]", expected: []interface{}{1.0, 2.0}},
+		{in: `{a /* key */ : /* value */ int(1)}`, expected: map[string]interface{}{"a": 1}},
+		{in: `"/* not a comment */"`, expected: "/* not a comment */"},
+		{in: `[1 /* unterminated`, err: ErrUnexpectedEOF},
+		{in: `{a:1} /*`, expected: map[string]interface{}{"a": 1.0}, err: ErrUnexpectedEOF},
+		{in: `1 /* unterminated *`, expected: 1.0, err: ErrUnexpectedEOF},
+		{in: ` /* only a comment`, err: ErrUnexpectedEOF},
+		{in: `1 /**/`, expected: 1.0},
+		{in: `[1 / 2]`, err: &SyntaxError{"invalid character '/' after array element", 4}},
+	} {
+		d := NewDecoderWithOptions([]byte(tt.in), WithComments())
+		v, err := d.Decode()
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("#%d: %v, want %v", i, err, tt.err)
+		}
+		if !reflect.DeepEqual(v, tt.expected) {
+			t.Errorf("#%d: %v, want %v", i, v, tt.expected)
+		}
+	}
+
+	if _, err := Decode([]byte(`1 // comment`)); err == nil {
+		t.Fatal("comments are accepted by default")
+	}
+	if _, err := Format([]byte(`[1] /* x`), "", "  "); err != ErrUnexpectedEOF {
+		t.Fatalf("Format: unexpected error %v", err)
+	}
+	s := NewScanner([]byte(`[1] /* x`))
+	s.KeepComments()
+	var err error
+	for err == nil {
+		_, _, err = s.Scan()
+	}
+	if err != ErrUnexpectedEOF {
+		t.Fatalf("Scan: unexpected error %v", err)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	for i, tt := range []struct {
+		in  string
+		err error
+	}{
+		{in: `{"a": [1, 2], "b": null}`},
+		{in: `{a: 1}`, err: &SyntaxError{"invalid character 'a' looking for beginning of object key string", 2}},
+		{in: `[1, 2,]`, err: &SyntaxError{"invalid character ']' looking for beginning of value", 7}},
+		{in: `{"a": 1,}`, err: &SyntaxError{"invalid character '}' looking for beginning of object key string", 9}},
+		{in: `int(1)`, err: &SyntaxError{"invalid character 'i' looking for beginning of value", 4}},
+	} {
+		_, err := NewDecoderWithOptions([]byte(tt.in), WithStrict()).Decode()
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("#%d: %v, want %v", i, err, tt.err)
+		}
+		d := NewDecoderWithOptions([]byte(tt.in), WithStrict())
+		if err := d.Skip(); !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("#%d: Skip: %v, want %v", i, err, tt.err)
+		}
+		if _, err := Decode([]byte(tt.in)); err != nil {
+			t.Errorf("#%d: not accepted in default mode: %v", i, err)
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	for i, tt := range []struct {
+		in       string
+		maxDepth int
+		fail     bool
+	}{
+		{in: `[[1]]`, maxDepth: 2},
+		{in: `[[[1]]]`, maxDepth: 2, fail: true},
+		{in: `{a: [{}]}`, maxDepth: 3},
+		{in: `{a: [{b: {}}]}`, maxDepth: 3, fail: true},
+		{in: `[[], [], {a: []}]`, maxDepth: 3},
+		{in: `[[[[[[[[1]]]]]]]]`, maxDepth: 0},
+	} {
+		_, err := NewDecoderWithOptions([]byte(tt.in), WithMaxDepth(tt.maxDepth)).Decode()
+		if tt.fail != errors.Is(err, ErrMaxDepth) {
+			t.Errorf("#%d: unexpected error %v", i, err)
+		}
+		if !tt.fail && err != nil {
+			t.Errorf("#%d: %v", i, err)
+		}
+		err = NewDecoderWithOptions([]byte(tt.in), WithMaxDepth(tt.maxDepth)).Skip()
+		if tt.fail != errors.Is(err, ErrMaxDepth) {
+			t.Errorf("#%d: Skip: unexpected error %v", i, err)
+		}
+	}
+}
+
+func TestEncoderOptions(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoderWithOptions(&buf, WithIndent(">", "  "), WithSortKeys(false))
+	if !e.pretty || e.prefix != ">" || e.indent != "  " || !e.unsorted {
+		t.Fatalf("Options were not applied: %+v", e)
+	}
+	v := map[string]interface{}{
+		"b": map[string]interface{}{"x": []interface{}{true}},
+	}
+	if err := e.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); s != `{
+>  b: {
+>    x: [
+>      true
+>    ]
+>  }
+>}` {
+		t.Fatalf("Unexpected value: '%s'", s)
+	}
+
+	buf.Reset()
+	e = NewEncoderWithOptions(&buf, WithSortKeys(false), WithIndent("", "\t"))
+	v = map[string]interface{}{
+		"b": map[string]interface{}{"x": 1.0, "y": 2.0},
+		"a": []interface{}{true},
+		"c": "s",
+	}
+	if err := e.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	out, err := Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, v) {
+		t.Fatalf("Unexpected value: %v", out)
+	}
+}
+
+func TestEscapeHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewEncoderWithOptions(&buf, WithEscapeHTML(true)).Encode("<a href='x'>&</a>"); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); s != `"\u003ca href='x'\u003e\u0026\u003c/a\u003e"` {
+		t.Fatalf("Unexpected value: '%s'", s)
+	}
+}
+
+func TestCompatJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewEncoderWithOptions(&buf, WithCompatJSON()).Encode(testMap); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); s != `{"k01":null,"k02":false,"k03":true,"k04":"test","k05":1.45678e-98,"k06":-454365464,"k07":455645765,"k08":-128,"k09":255,"k10":32767,"k11":65535,"k12":2147483647,"k13":4294967295,"k14":9223372036854775807,"k15":18446744073709551615,"k16":"2017-12-25T15:00:00Z","k17":"192.168.1.2","k18":"192.168.1.2:65000","k19":"::1","k20":"[::1]:65000","k21":["test",123],"k22":{"test":true}}` {
+		t.Fatalf("Unexpected value: '%s'", s)
+	}
+	var v interface{}
+	if err := json.Unmarshal(buf.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,140 @@
+package jsonx
+
+// OrderedMap is an object that preserves the order of its keys. It is returned by Decode for objects
+// if the Decoder is in PreserveKeyOrder mode and is accepted wherever map[string]interface{} is: it can
+// be encoded, unmarshalled into structs and maps and used with GetPointer, Walk, Diff, Equal, Compact,
+// Flatten and AsMap. The zero value is an empty map ready to use. A nil *OrderedMap is written as null,
+// its read-only methods behave as if it was empty.
+type OrderedMap struct {
+	keys     []string
+	values   map[string]interface{}
+	comments map[string]string
+}
+
+// NewOrderedMap creates new empty OrderedMap.
+func NewOrderedMap() *OrderedMap {
+	return &OrderedMap{values: make(map[string]interface{})}
+}
+
+// Set sets the value for the key. A new key is added at the end, an existing one keeps its position.
+func (m *OrderedMap) Set(key string, value interface{}) {
+	if m.values == nil {
+		m.values = make(map[string]interface{})
+	}
+	if _, exists := m.values[key]; !exists {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// Get returns the value for the key and whether it exists.
+func (m *OrderedMap) Get(key string) (interface{}, bool) {
+	if m == nil {
+		return nil, false
+	}
+	v, exists := m.values[key]
+	return v, exists
+}
+
+// Delete removes the key.
+func (m *OrderedMap) Delete(key string) {
+	if _, exists := m.values[key]; !exists {
+		return
+	}
+	delete(m.values, key)
+	delete(m.comments, key)
+	for i, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// SetComment attaches a comment to the key, which is written as // lines before the key when the map is
+// pretty-printed (see Encoder.SetIndent). Comments are not written in the compact and the JSON compatible
+// output. An empty comment removes the existing one. Comments are not valid by default, so decoding the
+// pretty-printed output requires Decoder.AllowComments.
+func (m *OrderedMap) SetComment(key, comment string) {
+	if comment == "" {
+		delete(m.comments, key)
+		return
+	}
+	if m.comments == nil {
+		m.comments = make(map[string]string)
+	}
+	m.comments[key] = comment
+}
+
+// Comment returns the comment attached to the key, see SetComment.
+func (m *OrderedMap) Comment(key string) string {
+	if m == nil {
+		return ""
+	}
+	return m.comments[key]
+}
+
+// Keys returns the keys in order. The returned slice must not be modified.
+func (m *OrderedMap) Keys() []string {
+	if m == nil {
+		return nil
+	}
+	return m.keys
+}
+
+// Len returns the number of keys.
+func (m *OrderedMap) Len() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.keys)
+}
+
+// Map returns the underlying map. It must not be modified other than by changing the values of the existing keys.
+func (m *OrderedMap) Map() map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	return m.values
+}
+
+// objectMap returns the map holding the members of an object, which is either map[string]interface{}
+// or *OrderedMap
+func objectMap(v interface{}) (map[string]interface{}, bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return v, true
+	case *OrderedMap:
+		if v != nil {
+			return v.values, true
+		}
+	}
+	return nil, false
+}
+
+// nilOrderedMap returns nil if v is a nil *OrderedMap, which is written as null, otherwise v
+func nilOrderedMap(v interface{}) interface{} {
+	if m, ok := v.(*OrderedMap); ok && m == nil {
+		return nil
+	}
+	return v
+}
+
+// PreserveKeyOrder makes the Decoder return objects nested in the decoded value as *OrderedMap with
+// the keys in the order they first appear in the data (the value of a repeated key is the last one).
+// Together with Encoder.SortKeys(false) this makes decoding and re-encoding preserve the key order.
+// The objects returned by DecodeObject and DecodeInto themselves are not affected.
+func (d *Decoder) PreserveKeyOrder() {
+	d.ordered = true
+}
+
+// orderedObject reads an object into a new OrderedMap
+func (d *Decoder) orderedObject() (*OrderedMap, error) {
+	if d.iterative {
+		v, err := d.nested(nil)
+		m, _ := v.(*OrderedMap)
+		return m, err
+	}
+	m := NewOrderedMap()
+	return m, d.objectKeys(m.values, &m.keys)
+}
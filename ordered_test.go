@@ -0,0 +1,265 @@
+package jsonx
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestOrderedMap(t *testing.T) {
+	var m OrderedMap
+	m.Set("b", 1.0)
+	m.Set("a", 2.0)
+	m.Set("c", 3.0)
+	m.Set("b", 4.0)
+	if !reflect.DeepEqual(m.Keys(), []string{"b", "a", "c"}) {
+		t.Fatalf("Unexpected keys: %v", m.Keys())
+	}
+	if v, ok := m.Get("b"); !ok || v != 4.0 {
+		t.Fatalf("Unexpected value: %v", v)
+	}
+	m.Delete("a")
+	m.Delete("x")
+	if !reflect.DeepEqual(m.Keys(), []string{"b", "c"}) || m.Len() != 2 {
+		t.Fatalf("Unexpected keys: %v", m.Keys())
+	}
+	if _, ok := m.Get("a"); ok {
+		t.Fatal("Deleted key exists")
+	}
+	if Type(&m) != Object {
+		t.Fatalf("Unexpected type: %v", Type(&m))
+	}
+}
+
+func TestPreserveKeyOrder(t *testing.T) {
+	const src = `{z:1,a:[{y:true,b:null,x:"s"},{}],m:{q:{c:1,b:2,a:3},p:int(2)},z:2}`
+	for _, opts := range [][]DecodeOption{{WithPreserveKeyOrder()}, {WithPreserveKeyOrder(), WithIterative()}} {
+		v, err := NewDecoderWithOptions([]byte(src), opts...).Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, ok := v.(*OrderedMap)
+		if !ok {
+			t.Fatalf("Unexpected value: %#v", v)
+		}
+		if !reflect.DeepEqual(m.Keys(), []string{"z", "a", "m"}) {
+			t.Fatalf("Unexpected keys: %v", m.Keys())
+		}
+		if z, _ := m.Get("z"); z != 2.0 {
+			t.Fatalf("Unexpected value: %v", z)
+		}
+
+		// the output is reproducible
+		for i := 0; i < 10; i++ {
+			var buf bytes.Buffer
+			e := NewEncoderWithOptions(&buf, WithSortKeys(false))
+			if err = e.Encode(v); err != nil {
+				t.Fatal(err)
+			}
+			if s := buf.String(); s != `{z:2,a:[{y:true,b:null,x:"s"},{}],m:{q:{c:1,b:2,a:3},p:int(2)}}` {
+				t.Fatalf("Unexpected value: %s", s)
+			}
+		}
+
+		b, err := Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := string(b); s != `{a:[{b:null,x:"s",y:true},{}],m:{p:int(2),q:{a:3,b:2,c:1}},z:2}` {
+			t.Fatalf("Unexpected sorted value: %s", s)
+		}
+
+		var buf bytes.Buffer
+		e := NewEncoderWithOptions(&buf, WithSortKeys(false), WithOmitNull(true))
+		if err = e.Encode(v.(*OrderedMap).values["a"]); err != nil {
+			t.Fatal(err)
+		}
+		if s := buf.String(); s != `[{y:true,x:"s"},{}]` {
+			t.Fatalf("Unexpected value: %s", s)
+		}
+	}
+}
+
+func TestOrderedMapComments(t *testing.T) {
+	m := NewOrderedMap()
+	m.Set("port", 8080.0)
+	m.Set("host", "localhost")
+	inner := NewOrderedMap()
+	inner.Set("level", "debug")
+	inner.SetComment("level", "one of debug, info, error")
+	m.Set("log", inner)
+	m.SetComment("port", "the port to listen on\nrequires restart")
+	m.SetComment("host", "removed")
+	m.SetComment("host", "")
+	m.SetComment("missing", "ignored")
+	if m.Comment("port") != "the port to listen on\nrequires restart" || m.Comment("host") != "" {
+		t.Fatalf("Unexpected comments: %q, %q", m.Comment("port"), m.Comment("host"))
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoderIndent(&buf, "", "  ")
+	e.SortKeys(false)
+	if err := e.Encode(m); err != nil {
+		t.Fatal(err)
+	}
+	const expected = "{\n  // the port to listen on\n  // requires restart\n  port: 8080,\n  host: \"localhost\",\n" +
+		"  log: {\n    // one of debug, info, error\n    level: \"debug\"\n  }\n}"
+	if buf.String() != expected {
+		t.Fatalf("Unexpected output:\n%s", buf.String())
+	}
+
+	// the output can only be decoded with comments enabled
+	if _, err := Decode(buf.Bytes()); err == nil {
+		t.Fatal("Expected an error without AllowComments")
+	}
+	d := NewDecoder(buf.Bytes())
+	d.AllowComments()
+	if v, err := d.Decode(); err != nil {
+		t.Fatal(err)
+	} else if !Equal(v, m) {
+		t.Fatalf("Unexpected decoded value: %v", v)
+	}
+
+	buf.Reset()
+	e = NewEncoder(&buf)
+	e.SortKeys(false)
+	if err := e.Encode(m); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != `{port:8080,host:"localhost",log:{level:"debug"}}` {
+		t.Fatalf("Unexpected compact output: %s", buf.String())
+	}
+
+	m.Delete("port")
+	if m.Comment("port") != "" {
+		t.Fatal("Comment not deleted")
+	}
+
+	// a container that fits the line width is not inlined if it has commented descendants, a trailing
+	// newline does not add an empty comment line
+	om := NewOrderedMap()
+	om.Set("a", 1)
+	om.Set("b", []int{1, 2})
+	om.SetComment("a", "first\r\n")
+	buf.Reset()
+	e = NewEncoderIndent(&buf, "", "  ")
+	e.SetMaxLineWidth(80)
+	if err := e.Encode(map[string]interface{}{"x": om, "y": []interface{}{1.0, 2.0}}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "{\n  x: {\n    // first\n    a: int(1),\n    b: [int(1), int(2)]\n  },\n  y: [1, 2]\n}"; buf.String() != expected {
+		t.Fatalf("Unexpected output:\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
+
+func TestOrderedMapSupport(t *testing.T) {
+	d := NewDecoder([]byte(`[{a: {b: 1, "long key": "long value"}, c: [true]}]`))
+	d.PreserveKeyOrder()
+	v, err := d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := Decode([]byte(`[{c: [true], a: {"long key": "long value", b: 1}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := GetPointer(v, "/0/a/b"); err != nil || b != 1.0 {
+		t.Errorf("GetPointer: %v, %v", b, err)
+	}
+
+	var paths []string
+	err = Walk(v, func(path []interface{}, value interface{}) error {
+		paths = append(paths, fmt.Sprint(path))
+		return nil
+	})
+	if expected := []string{"[]", "[0]", "[0 a]", "[0 a b]", "[0 a long key]", "[0 c]", "[0 c 0]"}; err != nil ||
+		!reflect.DeepEqual(paths, expected) {
+		t.Errorf("Walk: %v, %v", paths, err)
+	}
+
+	var s []struct {
+		A map[string]interface{}
+		C []bool
+	}
+	d = NewDecoder([]byte(`[{A: {b: 1}, C: [true]}]`))
+	d.PreserveKeyOrder()
+	if err = d.Unmarshal(&s); err != nil || len(s) != 1 || s[0].A["b"] != 1.0 || !reflect.DeepEqual(s[0].C, []bool{true}) {
+		t.Errorf("Unmarshal: %+v, %v", s, err)
+	}
+	var ms []map[string]map[string]interface{}
+	d = NewDecoder([]byte(`[{a: {b: 1}}]`))
+	d.PreserveKeyOrder()
+	if err = d.Unmarshal(&ms); err != nil || len(ms) != 1 || ms[0]["a"]["b"] != 1.0 {
+		t.Errorf("Unmarshal into a map: %+v, %v", ms, err)
+	}
+
+	if !Equal(v, plain) || !Equal(plain, v) {
+		t.Error("Equal: not equal to the same unordered value")
+	}
+	if changes := Diff(plain, v); len(changes) != 0 {
+		t.Errorf("Diff: %v", changes)
+	}
+	other, _ := Decode([]byte(`[{a: {b: 2, "long key": "long value"}, c: [true]}]`))
+	if changes := Diff(v, other); len(changes) != 1 || !reflect.DeepEqual(changes[0].Path, []interface{}{0, "a", "b"}) {
+		t.Errorf("Diff: %v", changes)
+	}
+
+	obj, _ := GetPointer(v, "/0/a")
+	m, ok := AsMap(obj)
+	if !ok || m["b"] != 1.0 {
+		t.Errorf("AsMap: %v, %v", m, ok)
+	}
+
+	om := obj.(*OrderedMap)
+	om.SetComment("long key", "a comment")
+	if res := CompactLarger(v, len("long key")); !Equal(res, plain) {
+		t.Errorf("Compact: %v", res)
+	}
+	if !reflect.DeepEqual(om.Keys(), []string{"b", "long key"}) || om.Comment("long key") != "a comment" {
+		t.Errorf("Compact: %v, %q", om.Keys(), om.Comment("long key"))
+	}
+}
+
+func TestNilOrderedMap(t *testing.T) {
+	var m *OrderedMap
+	if m.Len() != 0 || m.Keys() != nil || m.Map() != nil || m.Comment("a") != "" {
+		t.Fatal("Unexpected nil map contents")
+	}
+	if v, exists := m.Get("a"); v != nil || exists {
+		t.Fatalf("Get: %v, %v", v, exists)
+	}
+
+	v := map[string]interface{}{"a": m}
+	if b, err := Marshal(v); err != nil || string(b) != `{a:null}` {
+		t.Errorf("Marshal: %s, %v", b, err)
+	}
+	if b, err := AppendEncode(nil, m); err != nil || string(b) != `null` {
+		t.Errorf("AppendEncode: %s, %v", b, err)
+	}
+	if n, err := EncodedLen(m); err != nil || n != 4 {
+		t.Errorf("EncodedLen: %d, %v", n, err)
+	}
+	if n, _ := NodeOf(v).Get("a"); n.Kind() != Null {
+		t.Errorf("NodeOf: %v", n.Kind())
+	}
+	if Type(m) != Null {
+		t.Errorf("Type: %v", Type(m))
+	}
+	if res := Compact(m); res != interface{}(m) {
+		t.Errorf("Compact: %v", res)
+	}
+	if err := Walk(m, func(path []interface{}, value interface{}) error { return nil }); err != nil {
+		t.Errorf("Walk: %v", err)
+	}
+	if _, _, err := FlattenToRows([]interface{}{m}); err == nil {
+		t.Error("FlattenToRows: expected error")
+	}
+	if !Equal(m, m) || !Equal(m, nil) || Equal(m, NewOrderedMap()) {
+		t.Error("Equal: a nil map is only equal to null")
+	}
+	if changes := Diff(m, NewOrderedMap()); len(changes) != 1 || changes[0].Kind != Modified {
+		t.Errorf("Diff: %v", changes)
+	}
+}
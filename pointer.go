@@ -0,0 +1,86 @@
+package jsonx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GetPointer returns the value within the decoded value v referenced by an RFC 6901 JSON Pointer
+// (e.g. "/a/b/0"). An empty pointer references the whole document.
+func GetPointer(v interface{}, pointer string) (interface{}, error) {
+	if pointer == "" {
+		return v, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("invalid JSON pointer %q: must be empty or start with '/'", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		token = unescapePointerToken(token)
+		switch v1 := v.(type) {
+		case map[string]interface{}, *OrderedMap:
+			m, _ := objectMap(v1)
+			val, exists := m[token]
+			if !exists {
+				return nil, fmt.Errorf("JSON pointer %q: key %q not found at %s", pointer, token, pointerPrefix(tokens, i))
+			}
+			v = val
+		case []interface{}:
+			idx, err := parsePointerIndex(token)
+			if err != nil {
+				return nil, fmt.Errorf("JSON pointer %q: %v at %s", pointer, err, pointerPrefix(tokens, i))
+			}
+			if idx >= len(v1) {
+				return nil, fmt.Errorf("JSON pointer %q: index %d out of range at %s (length %d)", pointer, idx, pointerPrefix(tokens, i), len(v1))
+			}
+			v = v1[idx]
+		default:
+			return nil, fmt.Errorf("JSON pointer %q: cannot descend into %s at %s", pointer, Type(v), pointerPrefix(tokens, i))
+		}
+	}
+
+	return v, nil
+}
+
+func unescapePointerToken(token string) string {
+	if strings.IndexByte(token, '~') == -1 {
+		return token
+	}
+	return strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+}
+
+func escapePointerToken(token string) string {
+	if strings.IndexAny(token, "~/") == -1 {
+		return token
+	}
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+func parsePointerIndex(token string) (int, error) {
+	if token == "-" {
+		return 0, fmt.Errorf("index '-' refers to a nonexistent element")
+	}
+	if token == "" || len(token) > 1 && token[0] == '0' {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	for i := 0; i < len(token); i++ {
+		if c := token[i]; c < '0' || c > '9' {
+			return 0, fmt.Errorf("invalid array index %q", token)
+		}
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return idx, nil
+}
+
+// pointerPrefix returns the pointer to the value being descended into.
+func pointerPrefix(tokens []string, i int) string {
+	if i == 0 {
+		return `""`
+	}
+	return strconv.Quote("/" + strings.Join(tokens[:i], "/"))
+}
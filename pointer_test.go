@@ -0,0 +1,65 @@
+package jsonx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetPointer(t *testing.T) {
+	v, err := Decode([]byte(`{
+		a: {b: [int(1), "two", {c: true}]},
+		"x/y": 1,
+		"m~n": 2,
+		"": 3,
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range []struct {
+		pointer  string
+		expected interface{}
+		fail     bool
+	}{
+		{pointer: "", expected: v},
+		{pointer: "/a/b/0", expected: 1},
+		{pointer: "/a/b/1", expected: "two"},
+		{pointer: "/a/b/2/c", expected: true},
+		{pointer: "/x~1y", expected: 1.0},
+		{pointer: "/m~0n", expected: 2.0},
+		{pointer: "/", expected: 3.0},
+
+		{pointer: "a", fail: true},
+		{pointer: "/missing", fail: true},
+		{pointer: "/a/b/3", fail: true},
+		{pointer: "/a/b/-", fail: true},
+		{pointer: "/a/b/01", fail: true},
+		{pointer: "/a/b/x", fail: true},
+		{pointer: "/a/b/0/c", fail: true},
+	} {
+		out, err := GetPointer(v, tt.pointer)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("#%d (%q): expected error, got %v", i, tt.pointer, out)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d (%q): %v", i, tt.pointer, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, tt.expected) {
+			t.Errorf("#%d (%q): %v, want %v", i, tt.pointer, out, tt.expected)
+		}
+	}
+}
+
+func TestGetPointerErrorMessage(t *testing.T) {
+	_, err := GetPointer([]interface{}{1.0}, "/5")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if s := err.Error(); s != `JSON pointer "/5": index 5 out of range at "" (length 1)` {
+		t.Fatalf("Unexpected error: %s", s)
+	}
+}
@@ -0,0 +1,40 @@
+package jsonx
+
+import (
+	"math"
+	"strconv"
+)
+
+// RawNumber is a number literal as it appears in the input, see Decoder.RawNumbers. The Encoder writes
+// it verbatim.
+type RawNumber string
+
+// String returns the literal.
+func (n RawNumber) String() string {
+	return string(n)
+}
+
+// Float64 parses the literal as float64.
+func (n RawNumber) Float64() (float64, error) {
+	return strconv.ParseFloat(string(n), 64)
+}
+
+// Int64 parses the literal as int64. Literals in exponent or decimal form (e.g. 1e3 or 2.0) are
+// accepted if their value is integral and within range.
+func (n RawNumber) Int64() (int64, error) {
+	i, err := strconv.ParseInt(string(n), 10, 64)
+	if err == nil || err.(*strconv.NumError).Err == strconv.ErrRange {
+		return i, err
+	}
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return 0, err
+	}
+	if f != math.Trunc(f) {
+		return 0, &strconv.NumError{Func: "ParseInt", Num: string(n), Err: strconv.ErrSyntax}
+	}
+	if f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, &strconv.NumError{Func: "ParseInt", Num: string(n), Err: strconv.ErrRange}
+	}
+	return int64(f), nil
+}
@@ -0,0 +1,65 @@
+package jsonx
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestRawNumbers(t *testing.T) {
+	const src = `{a:1.0,b:1e3,c:1.2300,d:-0,e:[12345678901234567890123,-1E-7]}`
+	d := NewDecoder([]byte(src))
+	d.RawNumbers()
+	v, err := d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"a": RawNumber("1.0"),
+		"b": RawNumber("1e3"),
+		"c": RawNumber("1.2300"),
+		"d": RawNumber("-0"),
+		"e": []interface{}{RawNumber("12345678901234567890123"), RawNumber("-1E-7")},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("Unexpected value: %#v", v)
+	}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != src {
+		t.Fatalf("Unexpected value: %s", s)
+	}
+
+	if _, err := Marshal(RawNumber("1.2.3")); err == nil {
+		t.Fatal("Expected error for invalid literal")
+	}
+}
+
+func TestRawNumberAccessors(t *testing.T) {
+	for i, tt := range []struct {
+		n      RawNumber
+		f      float64
+		i      int64
+		intErr error
+	}{
+		{n: "1.0", f: 1, i: 1},
+		{n: "1e3", f: 1000, i: 1000},
+		{n: "1.2300", f: 1.23, intErr: strconv.ErrSyntax},
+		{n: "-42", f: -42, i: -42},
+		{n: "9223372036854775807", f: 9223372036854775807, i: 9223372036854775807},
+		{n: "9223372036854775808", f: 9223372036854775808, i: 9223372036854775807, intErr: strconv.ErrRange},
+		{n: "1e19", f: 1e19, intErr: strconv.ErrRange},
+	} {
+		f, err := tt.n.Float64()
+		if err != nil || f != tt.f {
+			t.Errorf("#%d: Float64() = %v, %v; want %v", i, f, err, tt.f)
+		}
+		n, err := tt.n.Int64()
+		if n != tt.i || !errors.Is(err, tt.intErr) || (err == nil) != (tt.intErr == nil) {
+			t.Errorf("#%d: Int64() = %v, %v; want %v, %v", i, n, err, tt.i, tt.intErr)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package jsonx
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReaderDecoder(t *testing.T) {
+	const data = `{a: [1, "two"], b: datetime("2017-12-25T15:00:00Z")} tail`
+	v0, err0 := Decode([]byte(data))
+
+	for i, d := range []*Decoder{
+		NewReaderDecoder(strings.NewReader(data)),
+		NewReaderDecoder(iotest.OneByteReader(strings.NewReader(data))),
+		NewReaderDecoder(iotest.HalfReader(strings.NewReader(data))),
+	} {
+		if i == 1 {
+			d.AllocString()
+		}
+		v, err := d.Decode()
+		if !reflect.DeepEqual(err, err0) {
+			t.Errorf("#%d: %v, want %v", i, err, err0)
+		}
+		if !reflect.DeepEqual(v, v0) {
+			t.Errorf("#%d: %v, want %v", i, v, v0)
+		}
+		if b := d.Buffered(); string(b) != "tail" {
+			t.Errorf("#%d: unexpected buffered data '%s'", i, b)
+		}
+	}
+}
+
+func TestReaderDecoderErrors(t *testing.T) {
+	d := NewReaderDecoder(strings.NewReader(`[1, 2, 3]`))
+	d.SetMaxInputSize(8)
+	if _, err := d.DecodeArray(); err != ErrInputTooLarge {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	d = NewReaderDecoder(strings.NewReader(`[1, 2, 3]`))
+	d.SetMaxInputSize(9)
+	if v, err := d.DecodeArray(); err != nil || len(v) != 3 {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+
+	readErr := errors.New("read error")
+	d = NewReaderDecoder(iotest.DataErrReader(iotest.ErrReader(readErr)))
+	if _, err := d.Decode(); err != readErr {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := d.Skip(); err != readErr {
+		t.Fatalf("Unexpected error on the second call: %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package jsonx
+
+import "io"
+
+// TokenKind identifies the kind of a token returned by Scanner.Scan.
+type TokenKind int
+
+const (
+	TokenInvalid      TokenKind = iota
+	TokenEOF                    // end of input
+	TokenBraceOpen              // {
+	TokenBraceClose             // }
+	TokenBracketOpen            // [
+	TokenBracketClose           // ]
+	TokenColon                  // :
+	TokenComma                  // ,
+	TokenString                 // string literal including the quotes
+	TokenNumber                 // number literal including the sign
+	TokenAtom                   // identifier: true, false, null or an unquoted object key
+	TokenTypedOpen              // name of a typed atom followed by '(', e.g. int in int(5)
+	TokenTypedArg               // unquoted typed atom argument, e.g. 5 in int(5)
+	TokenTypedClose             // ) terminating a typed atom
+	TokenComment                // comment including the delimiters, only returned in KeepComments mode
+)
+
+var tokenKinds = [...]string{
+	TokenInvalid:      "invalid",
+	TokenEOF:          "EOF",
+	TokenBraceOpen:    "{",
+	TokenBraceClose:   "}",
+	TokenBracketOpen:  "[",
+	TokenBracketClose: "]",
+	TokenColon:        ":",
+	TokenComma:        ",",
+	TokenString:       "string",
+	TokenNumber:       "number",
+	TokenAtom:         "atom",
+	TokenTypedOpen:    "typed open",
+	TokenTypedArg:     "typed argument",
+	TokenTypedClose:   "typed close",
+	TokenComment:      "comment",
+}
+
+func (k TokenKind) String() string {
+	if k >= 0 && int(k) < len(tokenKinds) {
+		return tokenKinds[k]
+	}
+	return "unknown"
+}
+
+const (
+	typedNone = iota
+	typedArg
+	typedClose
+)
+
+// Scanner splits JSONX-encoded data into tokens without constructing values. It only checks
+// the syntax of individual tokens, not whether they form a valid document.
+type Scanner struct {
+	d            Decoder
+	typed        int
+	keepComments bool
+	start        int // offset of the last token returned by Scan
+}
+
+// NewScanner creates new Scanner for the JSONX-encoded data.
+func NewScanner(data []byte) *Scanner {
+	return &Scanner{
+		d: Decoder{
+			data: data,
+			end:  len(data),
+		},
+	}
+}
+
+// AllowComments makes the Scanner skip comments, see Decoder.AllowComments.
+func (s *Scanner) AllowComments() {
+	s.d.AllowComments()
+}
+
+// AllowRawStrings makes the Scanner accept raw strings, see Decoder.AllowRawStrings.
+func (s *Scanner) AllowRawStrings() {
+	s.d.AllowRawStrings()
+}
+
+// KeepComments makes Scan return comments as TokenComment tokens rather than skipping them. A line
+// comment does not include the terminating newline. Comments inside typed atoms (e.g. int(/* x */ 1))
+// are still skipped.
+func (s *Scanner) KeepComments() {
+	s.d.AllowComments()
+	s.keepComments = true
+}
+
+// Offset returns the current position in the data.
+func (s *Scanner) Offset() int {
+	return s.d.pos
+}
+
+// Scan returns the next token and the slice of the data it occupies. At the end of the data
+// it returns TokenEOF and io.EOF. On a syntax error TokenInvalid is returned.
+func (s *Scanner) Scan() (TokenKind, []byte, error) {
+	d := &s.d
+	var c byte
+	if s.keepComments && s.typed == typedNone {
+		d.comments = false
+		c = d.skipSpaces()
+		d.comments = true
+		if s.start = d.pos; c == '/' && d.skipComment() {
+			if d.open {
+				return TokenInvalid, nil, ErrUnexpectedEOF
+			}
+			return TokenComment, d.data[s.start:d.pos], nil
+		}
+	} else {
+		c = d.skipSpaces()
+	}
+	start := d.pos
+	s.start = start
+	if d.pos >= d.end {
+		if s.typed != typedNone || d.open {
+			return TokenInvalid, nil, ErrUnexpectedEOF
+		}
+		return TokenEOF, nil, io.EOF
+	}
+
+	switch s.typed {
+	case typedArg:
+		s.typed = typedClose
+		switch c {
+		case ')':
+			// empty argument
+		case '"':
+			return s.token(TokenString, start, s.scanString())
+		default:
+			end, err := d.scanRawArg()
+			if err != nil {
+				return TokenInvalid, nil, err
+			}
+			return TokenTypedArg, d.data[start:end], nil
+		}
+		fallthrough
+	case typedClose:
+		if c != ')' {
+			return TokenInvalid, nil, d.error(c, "looking for )")
+		}
+		s.typed = typedNone
+		d.pos++
+		return TokenTypedClose, d.data[start:d.pos], nil
+	}
+
+	switch c {
+	case '{':
+		d.pos++
+		return TokenBraceOpen, d.data[start:d.pos], nil
+	case '}':
+		d.pos++
+		return TokenBraceClose, d.data[start:d.pos], nil
+	case '[':
+		d.pos++
+		return TokenBracketOpen, d.data[start:d.pos], nil
+	case ']':
+		d.pos++
+		return TokenBracketClose, d.data[start:d.pos], nil
+	case ':':
+		d.pos++
+		return TokenColon, d.data[start:d.pos], nil
+	case ',':
+		d.pos++
+		return TokenComma, d.data[start:d.pos], nil
+	case '"':
+		return s.token(TokenString, start, s.scanString())
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return s.token(TokenNumber, start, s.scanNumber())
+	}
+
+	if _, err := d.scanAtom(); err != nil {
+		return TokenInvalid, nil, err
+	}
+	end := d.pos
+	if d.skipSpaces() == '(' {
+		d.pos++
+		s.typed = typedArg
+		return TokenTypedOpen, d.data[start:end], nil
+	}
+	d.pos = end
+	return TokenAtom, d.data[start:end], nil
+}
+
+func (s *Scanner) token(kind TokenKind, start int, err error) (TokenKind, []byte, error) {
+	if err != nil {
+		return TokenInvalid, nil, err
+	}
+	return kind, s.d.data[start:s.d.pos], nil
+}
+
+func (s *Scanner) scanString() error {
+	_, _, _, err := s.d.scanString()
+	return err
+}
+
+func (s *Scanner) scanNumber() error {
+	d := &s.d
+	if d.data[d.pos] == '-' {
+		d.pos++
+		if d.pos >= d.end {
+			return ErrUnexpectedEOF
+		}
+		if c := d.data[d.pos]; c < '0' || c > '9' {
+			return d.error(c, "in numeric literal")
+		}
+	}
+	_, err := d.number()
+	return err
+}
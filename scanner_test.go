@@ -0,0 +1,108 @@
+package jsonx
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+type token struct {
+	kind TokenKind
+	raw  string
+}
+
+func scanAll(s *Scanner) ([]token, error) {
+	var tokens []token
+	for {
+		kind, raw, err := s.Scan()
+		if err == io.EOF {
+			return tokens, nil
+		}
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, token{kind, string(raw)})
+	}
+}
+
+func TestScanner(t *testing.T) {
+	s := NewScanner([]byte(`{
+		k1: [1, -2.5e3, "s\"q"],
+		"k2": int64("9223372036854775807"),
+		k3: ipport( 192.168.1.2:80 ), k4: null,
+		k5: bytes(),
+	}`))
+	tokens, err := scanAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []token{
+		{TokenBraceOpen, "{"},
+		{TokenAtom, "k1"}, {TokenColon, ":"},
+		{TokenBracketOpen, "["}, {TokenNumber, "1"}, {TokenComma, ","}, {TokenNumber, "-2.5e3"}, {TokenComma, ","},
+		{TokenString, `"s\"q"`}, {TokenBracketClose, "]"}, {TokenComma, ","},
+		{TokenString, `"k2"`}, {TokenColon, ":"},
+		{TokenTypedOpen, "int64"}, {TokenString, `"9223372036854775807"`}, {TokenTypedClose, ")"}, {TokenComma, ","},
+		{TokenAtom, "k3"}, {TokenColon, ":"},
+		{TokenTypedOpen, "ipport"}, {TokenTypedArg, "192.168.1.2:80 "}, {TokenTypedClose, ")"}, {TokenComma, ","},
+		{TokenAtom, "k4"}, {TokenColon, ":"}, {TokenAtom, "null"}, {TokenComma, ","},
+		{TokenAtom, "k5"}, {TokenColon, ":"}, {TokenTypedOpen, "bytes"}, {TokenTypedClose, ")"}, {TokenComma, ","},
+		{TokenBraceClose, "}"},
+	}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Fatalf("Unexpected tokens:\n%v\nwant:\n%v", tokens, expected)
+	}
+}
+
+func TestScannerComments(t *testing.T) {
+	s := NewScanner([]byte("[1, // one\n/* two */ 2]"))
+	s.AllowComments()
+	tokens, err := scanAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []token{
+		{TokenBracketOpen, "["}, {TokenNumber, "1"}, {TokenComma, ","}, {TokenNumber, "2"}, {TokenBracketClose, "]"},
+	}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Fatalf("Unexpected tokens: %v", tokens)
+	}
+}
+
+func TestScannerErrors(t *testing.T) {
+	for i, tt := range []struct {
+		in  string
+		err error
+	}{
+		{in: `"abc`, err: ErrUnexpectedEOF},
+		{in: `int(5`, err: ErrUnexpectedEOF},
+		{in: `int("5" x)`, err: &SyntaxError{"invalid character 'x' looking for )", 9}},
+		{in: `- 1`, err: &SyntaxError{"invalid character ' ' in numeric literal", 2}},
+		{in: `[1 @]`, err: &SyntaxError{"invalid character '@' looking for atom", 4}},
+	} {
+		_, err := scanAll(NewScanner([]byte(tt.in)))
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("#%d: %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+func TestScannerKeepComments(t *testing.T) {
+	s := NewScanner([]byte("// head\n[1, /* mid */ int( /* in */ 2)] // tail"))
+	s.KeepComments()
+	tokens, err := scanAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []token{
+		{TokenComment, "// head"},
+		{TokenBracketOpen, "["}, {TokenNumber, "1"}, {TokenComma, ","},
+		{TokenComment, "/* mid */"},
+		{TokenTypedOpen, "int"}, {TokenTypedArg, "2"}, {TokenTypedClose, ")"},
+		{TokenBracketClose, "]"},
+		{TokenComment, "// tail"},
+	}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Fatalf("Unexpected tokens: %v", tokens)
+	}
+}
@@ -0,0 +1,195 @@
+package jsonx
+
+// Skip advances past the next value without constructing it. Nested arrays and objects and
+// typed atoms (e.g. int8(5)) are skipped entirely, the content of typed atoms is not validated.
+func (d *Decoder) Skip() error {
+	if _, err := d.begin(); err != nil {
+		return err
+	}
+	return d.skipValue()
+}
+
+// Valid reports whether data is a single valid JSONX value (with the default Decoder settings) followed
+// by nothing but whitespace. The value is not constructed and, as with Skip, the arguments of typed atoms
+// are not validated.
+func Valid(data []byte) bool {
+	return valid(data, 0)
+}
+
+// ValidObject is the same as Valid but the value must be an object.
+func ValidObject(data []byte) bool {
+	return valid(data, '{')
+}
+
+// ValidArray is the same as Valid but the value must be an array.
+func ValidArray(data []byte) bool {
+	return valid(data, '[')
+}
+
+// valid implements Valid, if open is not zero the value must begin with it
+func valid(data []byte, open byte) bool {
+	d := NewDecoder(data)
+	if c := d.skipSpaces(); open != 0 && c != open {
+		return false
+	}
+	if err := d.skipValue(); err != nil {
+		return false
+	}
+	d.skipSpaces()
+	return d.pos >= d.end
+}
+
+func (d *Decoder) skipValue() error {
+	if d.pos >= d.end {
+		return d.error(0, "looking for beginning of value")
+	}
+
+	if d.data[d.pos] == '+' && d.leadPlus {
+		if err := d.skipPlus(); err != nil {
+			return err
+		}
+		_, err := d.number()
+		return err
+	}
+
+	switch c := d.data[d.pos]; c {
+	case '"':
+		_, _, _, err := d.scanString()
+		for err == nil && d.concat {
+			pos := d.pos
+			if d.skipSpaces() != '"' {
+				d.pos = pos
+				break
+			}
+			_, _, _, err = d.scanString()
+		}
+		return err
+	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		_, err := d.number()
+		return err
+	case '-':
+		d.pos++
+		if d.pos >= d.end {
+			return ErrUnexpectedEOF
+		}
+		_, err := d.number()
+		return err
+	case '[':
+		return d.skipArray()
+	case '{':
+		return d.skipObject()
+	default:
+		start, err := d.scanAtom()
+		if err != nil {
+			return err
+		}
+		atom := d.data[start:d.pos]
+		if _, ok := d.keyword(string(atom)); ok {
+			return nil
+		}
+		if !d.strict && isTypedAtom(atom) {
+			_, _, _, _, err = d.scanBracketExpr()
+			return err
+		}
+		return d.error(c, "looking for beginning of value")
+	}
+}
+
+// isTypedAtom returns true if name is one of the types that can be used as type(value)
+func isTypedAtom(name []byte) bool {
+	switch string(name) {
+	case "int", "datetime", "duration", "ip", "ipport", "cidr", "regexp", "bytes", "hex", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64":
+		return true
+	}
+	return false
+}
+
+func (d *Decoder) skipArray() error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer func() { d.depth-- }()
+	// the '[' token already scanned
+	d.pos++
+
+	for first := true; ; first = false {
+		if c := d.skipSpaces(); c == ']' {
+			if d.strict && !first {
+				return d.error(c, "looking for beginning of value")
+			}
+			d.pos++
+			return nil
+		}
+		if err := d.skipValue(); err != nil {
+			return err
+		}
+
+		// next token must be ',' or ']'
+		if c := d.skipSpaces(); c == ',' {
+			d.pos++
+		} else if c == ']' {
+			d.pos++
+			return nil
+		} else {
+			return d.error(c, "after array element")
+		}
+	}
+}
+
+func (d *Decoder) skipObject() error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer func() { d.depth-- }()
+	// the '{' token already scanned
+	d.pos++
+
+	for first := true; ; first = false {
+		c := d.skipSpaces()
+		if c == '}' {
+			if d.strict && !first {
+				return d.error(c, "looking for beginning of object key string")
+			}
+			d.pos++
+			return nil
+		}
+
+		// skip key
+		var err error
+		if d.pos >= d.end {
+			return ErrUnexpectedEOF
+		}
+		if c == '"' {
+			_, _, _, err = d.scanString()
+		} else if d.strict {
+			return d.error(c, "looking for beginning of object key string")
+		} else {
+			_, err = d.scanKeyAtom()
+		}
+		if err != nil {
+			return err
+		}
+
+		// read colon before value
+		if c = d.skipSpaces(); c != ':' {
+			return d.error(c, "after object key")
+		}
+		d.pos++
+
+		d.skipSpaces()
+		if err = d.skipValue(); err != nil {
+			return err
+		}
+
+		// next token must be ',' or '}'
+		if c = d.skipSpaces(); c == '}' {
+			d.pos++
+			return nil
+		} else if c == ',' {
+			d.pos++
+		} else {
+			return d.error(c, "after object key:value pair")
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package jsonx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSkip(t *testing.T) {
+	for i, tt := range []struct {
+		in       string
+		expected interface{}
+	}{
+		{in: `"str\"ing" 1`, expected: 1.0},
+		{in: `12.5e3 "next"`, expected: "next"},
+		{in: `-3 true`, expected: true},
+		{in: `[1, [2, "]"], {a: []},] null`, expected: nil},
+		{in: `{a: {"b": int(1), c: [{}]}, d: "}",} [2]`, expected: []interface{}{2.0}},
+		{in: `int8(5) false`, expected: false},
+		{in: `int64( "123" ) 3`, expected: 3.0},
+		{in: `ipport("[::1]:80") {x: 1}`, expected: map[string]interface{}{"x": 1.0}},
+		{in: `true int(7)`, expected: 7},
+		{in: `null "x"`, expected: "x"},
+	} {
+		d := NewDecoder([]byte(tt.in))
+		if err := d.Skip(); err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		v, err := d.Decode()
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tt.expected) {
+			t.Errorf("#%d: %v, want %v", i, v, tt.expected)
+		}
+	}
+}
+
+func TestSkipErrors(t *testing.T) {
+	for i, tt := range []struct {
+		in  string
+		err error
+	}{
+		{in: ``, err: ErrEmptyInput},
+		{in: `[1, 2`, err: ErrUnexpectedEOF},
+		{in: `{a: 1`, err: ErrUnexpectedEOF},
+		{in: `{a 1}`, err: &SyntaxError{"invalid character '1' after object key", 4}},
+		{in: `[1 2]`, err: &SyntaxError{"invalid character '2' after array element", 4}},
+		{in: `foo(1)`, err: &SyntaxError{"invalid character 'f' looking for beginning of value", 4}},
+		{in: `int8 5`, err: &SyntaxError{"invalid character '5' looking for (", 6}},
+	} {
+		err := NewDecoder([]byte(tt.in)).Skip()
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("#%d: %v, want %v", i, err, tt.err)
+		}
+		// Skip and Decode must agree on the errors
+		if _, err1 := Decode([]byte(tt.in)); !reflect.DeepEqual(err, err1) {
+			t.Errorf("#%d: Skip error %v, Decode error %v", i, err, err1)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	for i, tt := range []struct {
+		in     string
+		valid  bool
+		object bool
+		array  bool
+	}{
+		{in: ` {a: [1, int(2)], "b": {}} `, valid: true, object: true},
+		{in: `{}`, valid: true, object: true},
+		{in: ` [1, "two", {three: 3},] `, valid: true, array: true},
+		{in: `[]`, valid: true, array: true},
+		{in: `"str"`, valid: true},
+		{in: `42`, valid: true},
+		{in: `null`, valid: true},
+		{in: `{a: 1`},
+		{in: `{a 1}`},
+		{in: `[1, 2`},
+		{in: `[1 2]`},
+		{in: `{} {}`},
+		{in: `[] x`},
+		{in: ``},
+		{in: `   `},
+		{in: `nope`},
+	} {
+		if v := Valid([]byte(tt.in)); v != tt.valid {
+			t.Errorf("#%d: Valid %v", i, v)
+		}
+		if v := ValidObject([]byte(tt.in)); v != tt.object {
+			t.Errorf("#%d: ValidObject %v", i, v)
+		}
+		if v := ValidArray([]byte(tt.in)); v != tt.array {
+			t.Errorf("#%d: ValidArray %v", i, v)
+		}
+	}
+}
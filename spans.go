@@ -0,0 +1,78 @@
+package jsonx
+
+import "strconv"
+
+// Span is the location of a decoded value in the source data: data[Start:End] is the text of the value
+// including the quotes of strings, the brackets of arrays and objects and the arguments of typed atoms.
+type Span struct {
+	Start int
+	End   int
+}
+
+// DecodeWithSpans is the same as Decode but it also returns the location of every value keyed by its
+// RFC 6901 JSON Pointer, e.g. "" for the top-level value and "/a/0" for the first element of the array
+// under the key "a". If a key is repeated in an object the span of the last value is returned, as it is
+// the one that is decoded.
+func (d *Decoder) DecodeWithSpans() (interface{}, map[string]Span, error) {
+	if _, err := d.begin(); err != nil {
+		return nil, nil, err
+	}
+	start := d.pos
+	val, err := d.any()
+	if err != nil {
+		return nil, nil, err
+	}
+	// the value is known to be valid at this point, so the second pass does not need to check the syntax
+	spans := make(map[string]Span)
+	d.pos = start
+	if err = d.spans("", spans); err != nil {
+		return nil, nil, err
+	}
+	if err = d.extraData(); err != nil {
+		return val, spans, err
+	}
+	return val, spans, nil
+}
+
+// spans records the spans of the value at the current position and of all values nested in it
+func (d *Decoder) spans(pointer string, spans map[string]Span) error {
+	start := d.pos
+	switch d.data[d.pos] {
+	case '[':
+		d.pos++
+		for i := 0; d.skipSpaces() != ']'; i++ {
+			if err := d.spans(pointer+"/"+strconv.Itoa(i), spans); err != nil {
+				return err
+			}
+			if d.skipSpaces() == ',' {
+				d.pos++
+			}
+		}
+		d.pos++
+	case '{':
+		d.pos++
+		for d.skipSpaces() != '}' {
+			key, err := d.objectKey()
+			if err != nil {
+				return err
+			}
+			// the colon
+			d.skipSpaces()
+			d.pos++
+			d.skipSpaces()
+			if err = d.spans(pointer+"/"+escapePointerToken(key), spans); err != nil {
+				return err
+			}
+			if d.skipSpaces() == ',' {
+				d.pos++
+			}
+		}
+		d.pos++
+	default:
+		if err := d.skipValue(); err != nil {
+			return err
+		}
+	}
+	spans[pointer] = Span{start, d.pos}
+	return nil
+}
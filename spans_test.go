@@ -0,0 +1,54 @@
+package jsonx
+
+import "testing"
+
+func TestDecodeWithSpans(t *testing.T) {
+	const src = ` {a: [1, "two", {b: int(3)}], "c/d": {}, e: [], "f~": ip( "1.2.3.4" ),} `
+	d := NewDecoder([]byte(src))
+	_, spans, err := d.DecodeWithSpans()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pointer, expected := range map[string]string{
+		"":       `{a: [1, "two", {b: int(3)}], "c/d": {}, e: [], "f~": ip( "1.2.3.4" ),}`,
+		"/a":     `[1, "two", {b: int(3)}]`,
+		"/a/0":   `1`,
+		"/a/1":   `"two"`,
+		"/a/2":   `{b: int(3)}`,
+		"/a/2/b": `int(3)`,
+		"/c~1d":  `{}`,
+		"/e":     `[]`,
+		"/f~0":   `ip( "1.2.3.4" )`,
+	} {
+		span, exists := spans[pointer]
+		if !exists {
+			t.Errorf("%q: no span", pointer)
+			continue
+		}
+		if s := src[span.Start:span.End]; s != expected {
+			t.Errorf("%q: %q, expected %q", pointer, s, expected)
+		}
+	}
+	if len(spans) != 9 {
+		t.Errorf("Unexpected number of spans: %d", len(spans))
+	}
+}
+
+func TestDecodeWithSpansErrors(t *testing.T) {
+	d := NewDecoder([]byte(`[1, 2] 3`))
+	v, spans, err := d.DecodeWithSpans()
+	if _, ok := err.(*ExtraDataError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if v == nil || spans["/1"] != (Span{4, 5}) {
+		t.Fatalf("Unexpected result: %v, %v", v, spans)
+	}
+	if string(d.Buffered()) != "3" {
+		t.Fatalf("Unexpected tail: %q", d.Buffered())
+	}
+
+	d = NewDecoder([]byte(`{a: [1, }`))
+	if _, spans, err = d.DecodeWithSpans(); err == nil || spans != nil {
+		t.Fatalf("Expected error, got %v", spans)
+	}
+}
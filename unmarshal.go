@@ -0,0 +1,481 @@
+package jsonx
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// UnmarshalTypeError is returned by Unmarshal when a decoded value cannot be stored in the destination.
+type UnmarshalTypeError struct {
+	Value string       // description of the decoded value, e.g. "string" or "int64"
+	Type  reflect.Type // type of the Go value it could not be assigned to
+	Field string       // path to the offending value (struct field names and map keys), e.g. "Server.Port"
+	Err   error        // the error converting the value, e.g. parsing a time string, if any
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	s := "cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String()
+	if e.Field != "" {
+		s += " at " + e.Field
+	}
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+func (e *UnmarshalTypeError) Unwrap() error { return e.Err }
+
+// Unmarshal parses the JSONX-encoded data and stores the result in the value pointed to by v.
+// Equivalent of NewDecoder(data).Unmarshal(v)
+func Unmarshal(data []byte, v interface{}) error {
+	return NewDecoder(data).Unmarshal(v)
+}
+
+// DecodeObjectInto is the same as Unmarshal but the top-level value must be an object. Any other value,
+// including null, results in an UnmarshalTypeError, which is detected before the value is decoded.
+func DecodeObjectInto(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("non-pointer or nil %v passed to DecodeObjectInto", reflect.TypeOf(v))
+	}
+	d := NewDecoder(data)
+	t, err := d.PeekType()
+	if err != nil {
+		return err
+	}
+	if t != Object {
+		return &UnmarshalTypeError{Value: t.String(), Type: rv.Elem().Type()}
+	}
+	return d.Unmarshal(v)
+}
+
+// CaseInsensitiveFields controls whether Unmarshal matches object keys to struct fields ignoring case
+// when there is no exact match. If several keys match a field that way, the smallest one (in byte order)
+// is used. It is disabled by default.
+func (d *Decoder) CaseInsensitiveFields(enable bool) {
+	d.foldNames = enable
+}
+
+// Unmarshal decodes the next value and stores it in the value pointed to by v.
+//
+// Objects are stored in structs or maps, arrays in slices. For structs each key is matched to an exported
+// field by the name given in the field's `jsonx` tag or, if there is none, by the field name. Keys without
+// a matching field are ignored, as are fields tagged with "-". Map values are decoded into new elements of
+// the map's value type, a nil map is allocated. Maps may have string or integer keys, the latter require
+// decimal integer object keys, e.g. {"1": "a"}. Slices are replaced with a new slice of the array's length,
+// so an empty array results in an empty non-nil slice.
+//
+// Pointers are followed, allocating the value if the pointer is nil. Null sets maps, slices, pointers and
+// interfaces to nil and leaves other values unchanged. A destination of type interface{} receives the
+// value as returned by Decode.
+//
+// Numbers, including typed integers such as int64(5), can be stored in any numeric field provided they fit
+// (i.e. only integers in integer fields), and values of the typed atoms (e.g. datetime(...) or ip(...)) in
+// fields of the corresponding Go type or a pointer to it. A time.Time field also accepts an RFC3339 string
+// or a Unix timestamp (see SetEpochUnit) given as a number. A []byte or *[]byte field tagged with the
+// base64 option, e.g. `jsonx:"data,base64"`, also accepts a base64 string (see DecodeBase64Field).
+//
+// The same applies to the top-level value, which may be of any type, e.g. a scalar such as int64(5) can
+// be stored in an int64 variable.
+func (d *Decoder) Unmarshal(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("non-pointer or nil %v passed to Unmarshal", reflect.TypeOf(v))
+	}
+	val, err := d.Decode()
+	if err != nil {
+		return err
+	}
+	return d.assign(rv.Elem(), val, "")
+}
+
+// assign stores the decoded value src in dst, path is used in error messages
+func (d *Decoder) assign(dst reflect.Value, src interface{}, path string) error {
+	if src == nil {
+		switch dst.Kind() {
+		case reflect.Interface, reflect.Map, reflect.Slice, reflect.Ptr:
+			dst.Set(reflect.Zero(dst.Type()))
+		}
+		return nil
+	}
+	sv := reflect.ValueOf(src)
+	if sv.Type().AssignableTo(dst.Type()) {
+		dst.Set(sv)
+		return nil
+	}
+	// e.g. *net.IPNet produced by cidr(...) into net.IPNet
+	if sv.Kind() == reflect.Ptr && !sv.IsNil() && sv.Elem().Type().AssignableTo(dst.Type()) {
+		dst.Set(sv.Elem())
+		return nil
+	}
+	if dst.Kind() == reflect.Ptr {
+		if !dst.IsNil() {
+			return d.assign(dst.Elem(), src, path)
+		}
+		p := reflect.New(dst.Type().Elem())
+		if err := d.assign(p.Elem(), src, path); err != nil {
+			return err
+		}
+		dst.Set(p)
+		return nil
+	}
+	if dst.Type() == timeType {
+		t, ok, err := d.timeValue(src)
+		if ok {
+			dst.Set(reflect.ValueOf(t))
+			return nil
+		}
+		return &UnmarshalTypeError{Value: describe(src), Type: dst.Type(), Field: path, Err: err}
+	}
+
+	switch dst.Kind() {
+	case reflect.String:
+		if s, ok := src.(string); ok {
+			dst.SetString(s)
+			return nil
+		}
+	case reflect.Bool:
+		if b, ok := src.(bool); ok {
+			dst.SetBool(b)
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, ok := floatValue(src); ok && !dst.OverflowFloat(f) {
+			dst.SetFloat(f)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := intValue(src); ok && !dst.OverflowInt(n) {
+			dst.SetInt(n)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n, ok := uintValue(src); ok && !dst.OverflowUint(n) {
+			dst.SetUint(n)
+			return nil
+		}
+	case reflect.Struct:
+		if m, ok := objectMap(src); ok {
+			return d.assignStruct(dst, m, path)
+		}
+	case reflect.Slice:
+		if a, ok := src.([]interface{}); ok {
+			return d.assignSlice(dst, a, path)
+		}
+	case reflect.Map:
+		if m, ok := objectMap(src); ok && isMapKeyKind(dst.Type().Key().Kind()) {
+			return d.assignMap(dst, m, path)
+		}
+	}
+	return &UnmarshalTypeError{Value: describe(src), Type: dst.Type(), Field: path}
+}
+
+// timeValue converts a decoded string or number to time.Time the same way as the argument of datetime(...):
+// a string is parsed as RFC3339 and an integral number is a Unix timestamp in the unit set by SetEpochUnit.
+// The error is returned if a string cannot be parsed.
+func (d *Decoder) timeValue(src interface{}) (time.Time, bool, error) {
+	if s, ok := src.(string); ok {
+		t, err := time.Parse(time.RFC3339, s)
+		return t, err == nil, err
+	}
+	if n, ok := intValue(src); ok {
+		return d.unixTime(n), true, nil
+	}
+	return time.Time{}, false, nil
+}
+
+// floatValue returns the value of a decoded number of any type as float64
+func floatValue(src interface{}) (float64, bool) {
+	if f, ok := numberValue(src); ok {
+		return f, true
+	}
+	n, u, unsigned, ok := sizedInt(src)
+	if unsigned {
+		return float64(u), ok
+	}
+	return float64(n), ok
+}
+
+// intValue returns the value of a decoded number of any type as int64 provided it is an integer that fits
+func intValue(src interface{}) (int64, bool) {
+	switch v := src.(type) {
+	case float64:
+		if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+			return int64(v), true
+		}
+		return 0, false
+	case json.Number:
+		n, err := RawNumber(v).Int64()
+		return n, err == nil
+	case RawNumber:
+		n, err := v.Int64()
+		return n, err == nil
+	}
+	n, u, unsigned, ok := sizedInt(src)
+	if unsigned {
+		return int64(u), ok && u <= math.MaxInt64
+	}
+	return n, ok
+}
+
+// uintValue returns the value of a decoded number of any type as uint64 provided it is a non-negative
+// integer that fits
+func uintValue(src interface{}) (uint64, bool) {
+	switch v := src.(type) {
+	case float64:
+		if v == math.Trunc(v) && v >= 0 && v < math.MaxUint64 {
+			return uint64(v), true
+		}
+		return 0, false
+	case json.Number:
+		return uintValue(RawNumber(v))
+	case RawNumber:
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u, true
+		}
+		n, err := v.Int64()
+		return uint64(n), err == nil && n >= 0
+	}
+	n, u, unsigned, ok := sizedInt(src)
+	if unsigned {
+		return u, ok
+	}
+	return uint64(n), ok && n >= 0
+}
+
+// sizedInt returns the value of an integer of one of the types produced by the typed atoms (e.g. int64(5)),
+// the value of the unsigned ones is returned in u. Other types, including those based on integers such as
+// time.Duration, are not accepted.
+func sizedInt(src interface{}) (n int64, u uint64, unsigned, ok bool) {
+	switch v := src.(type) {
+	case int:
+		return int64(v), 0, false, true
+	case int8:
+		return int64(v), 0, false, true
+	case int16:
+		return int64(v), 0, false, true
+	case int32:
+		return int64(v), 0, false, true
+	case int64:
+		return v, 0, false, true
+	case uint:
+		return 0, uint64(v), true, true
+	case uint8:
+		return 0, uint64(v), true, true
+	case uint16:
+		return 0, uint64(v), true, true
+	case uint32:
+		return 0, uint64(v), true, true
+	case uint64:
+		return 0, v, true, true
+	}
+	return 0, 0, false, false
+}
+
+func (d *Decoder) assignStruct(dst reflect.Value, m map[string]interface{}, path string) error {
+	t := dst.Type()
+	// the key of each field: an exact match takes precedence over the keys matching case-insensitively,
+	// of which the smallest one is used
+	keys := make(map[int]string)
+	for key := range m {
+		i := d.fieldIndex(t, key)
+		if i == -1 {
+			continue
+		}
+		if prev, exists := keys[i]; exists {
+			if name, _ := fieldName(t.Field(i)); prev == name || key != name && prev < key {
+				continue
+			}
+		}
+		keys[i] = key
+	}
+	for i := 0; i < t.NumField(); i++ {
+		key, exists := keys[i]
+		if !exists {
+			continue
+		}
+		val := m[key]
+		f := t.Field(i)
+		if s, ok := val.(string); ok && isByteSlice(f.Type) && hasTagOption(f, "base64") {
+			b, err := DecodeBase64Field(s)
+			if err != nil {
+				return &UnmarshalTypeError{Value: "base64 string", Type: f.Type, Field: joinPath(path, f.Name), Err: err}
+			}
+			val = b
+		}
+		if err := d.assign(dst.Field(i), val, joinPath(path, f.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) assignMap(dst reflect.Value, m map[string]interface{}, path string) error {
+	t := dst.Type()
+	if dst.IsNil() {
+		dst.Set(reflect.MakeMapWithSize(t, len(m)))
+	}
+	// sorted, so that the error does not depend on the map iteration order
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		val := m[key]
+		k, err := mapKey(t.Key(), key)
+		if err != nil {
+			return &UnmarshalTypeError{Value: "key " + strconv.Quote(key), Type: t.Key(), Field: path}
+		}
+		elem := reflect.New(t.Elem()).Elem()
+		if err := d.assign(elem, val, joinPath(path, key)); err != nil {
+			return err
+		}
+		dst.SetMapIndex(k, elem)
+	}
+	return nil
+}
+
+// isMapKeyKind returns true if maps with keys of the kind can be unmarshalled into
+func isMapKeyKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// mapKey converts an object key to a map key of type t, integer keys are parsed as decimal numbers
+func mapKey(t reflect.Type, key string) (reflect.Value, error) {
+	k := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		k.SetString(key)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(key, 10, t.Bits())
+		if err != nil {
+			return k, err
+		}
+		k.SetInt(n)
+	default:
+		n, err := strconv.ParseUint(key, 10, t.Bits())
+		if err != nil {
+			return k, err
+		}
+		k.SetUint(n)
+	}
+	return k, nil
+}
+
+func (d *Decoder) assignSlice(dst reflect.Value, a []interface{}, path string) error {
+	s := reflect.MakeSlice(dst.Type(), len(a), len(a))
+	for i, val := range a {
+		if err := d.assign(s.Index(i), val, path+"["+strconv.Itoa(i)+"]"); err != nil {
+			return err
+		}
+	}
+	dst.Set(s)
+	return nil
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// fieldIndex returns the index of the struct field that the key maps to or -1 if there is none.
+// An exact match takes precedence over a case-insensitive one.
+func (d *Decoder) fieldIndex(t reflect.Type, key string) int {
+	folded := -1
+	for i := 0; i < t.NumField(); i++ {
+		name, ok := fieldName(t.Field(i))
+		if !ok {
+			continue
+		}
+		if name == key {
+			return i
+		}
+		if folded == -1 && d.foldNames && strings.EqualFold(name, key) {
+			folded = i
+		}
+	}
+	return folded
+}
+
+// fieldName returns the key name for the struct field and false if the field is not decoded
+func fieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		// unexported
+		return "", false
+	}
+	tag := f.Tag.Get("jsonx")
+	if tag == "-" {
+		return "", false
+	}
+	if i := strings.IndexByte(tag, ','); i != -1 {
+		tag = tag[:i]
+	}
+	if tag != "" {
+		return tag, true
+	}
+	return f.Name, true
+}
+
+// isByteSlice returns true if t is a byte slice or a pointer to one
+func isByteSlice(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
+
+// hasTagOption returns true if the field's jsonx tag contains the option, e.g. `jsonx:"name,base64"`
+func hasTagOption(f reflect.StructField, option string) bool {
+	tag := f.Tag.Get("jsonx")
+	i := strings.IndexByte(tag, ',')
+	if i == -1 {
+		return false
+	}
+	for _, opt := range strings.Split(tag[i+1:], ",") {
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeBase64Field converts a decoded value holding binary data to []byte: a string is decoded as
+// standard base64 (as encoding/json does for []byte), the value of bytes(...) is returned as is.
+// Any other value results in an error.
+func DecodeBase64Field(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		return base64.StdEncoding.DecodeString(v)
+	case []byte:
+		return v, nil
+	}
+	return nil, fmt.Errorf("cannot decode %s as base64", describe(v))
+}
+
+// describe returns a description of the decoded value for use in error messages
+func describe(v interface{}) string {
+	if t := Type(v); t < Unknown {
+		// JSON types
+		return t.String()
+	}
+	return reflect.TypeOf(v).String()
+}
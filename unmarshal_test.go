@@ -0,0 +1,589 @@
+package jsonx
+
+import (
+	"encoding/base64"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testServer struct {
+	Name    string
+	Host    net.IP `jsonx:"host"`
+	Port    int    `jsonx:"port,omitempty"`
+	Weight  float64
+	Enabled bool
+	Started time.Time
+	Extra   interface{}
+	Ignored string `jsonx:"-"`
+	hidden  string
+}
+
+type testConfig struct {
+	UserID string
+	Server testServer
+}
+
+func TestUnmarshal(t *testing.T) {
+	var c testConfig
+	err := Unmarshal([]byte(`{
+		UserID: "u1",
+		Server: {
+			Name: "main", host: ip("10.0.0.1"), port: 8080, Weight: 0.5, Enabled: true,
+			Started: datetime("2017-12-25T15:00:00Z"), Extra: [1, "a"], Ignored: "x", hidden: "y", unknown: 1
+		}
+	}`), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := testConfig{
+		UserID: "u1",
+		Server: testServer{
+			Name:    "main",
+			Host:    net.ParseIP("10.0.0.1"),
+			Port:    8080,
+			Weight:  0.5,
+			Enabled: true,
+			Started: time.Date(2017, 12, 25, 15, 0, 0, 0, time.UTC),
+			Extra:   []interface{}{1.0, "a"},
+		},
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Fatalf("Unexpected value: %#v", c)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for i, tt := range []struct {
+		in  string
+		err error
+	}{
+		{in: `{UserID: 1}`, err: &UnmarshalTypeError{"number", reflect.TypeOf(""), "UserID", nil}},
+		{in: `{Server: {port: 1.5}}`, err: &UnmarshalTypeError{"number", reflect.TypeOf(0), "Server.Port", nil}},
+		{in: `{Server: {Enabled: "yes"}}`, err: &UnmarshalTypeError{"string", reflect.TypeOf(true), "Server.Enabled", nil}},
+		{in: `{Server: {Started: ip("1.2.3.4")}}`, err: &UnmarshalTypeError{"net.IP", reflect.TypeOf(time.Time{}), "Server.Started", nil}},
+		{in: `[1]`, err: &UnmarshalTypeError{"array", reflect.TypeOf(testConfig{}), "", nil}},
+	} {
+		var c testConfig
+		err := Unmarshal([]byte(tt.in), &c)
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("#%d: %v, want %v", i, err, tt.err)
+		}
+	}
+
+	var c testConfig
+	if err := Unmarshal([]byte(`{}`), c); err == nil {
+		t.Error("Expected error for non-pointer")
+	}
+	var se *SyntaxError
+	if err := Unmarshal([]byte(`{UserID: }`), &c); !errors.As(err, &se) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestCaseInsensitiveFields(t *testing.T) {
+	const data = `{userid: "lower", Server: {NAME: "upper", PORT: 1, Host: ip("::1")}}`
+
+	var c testConfig
+	if err := Unmarshal([]byte(data), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.UserID != "" || c.Server.Name != "" || c.Server.Port != 0 || c.Server.Host != nil {
+		t.Fatalf("Keys matched case-insensitively by default: %#v", c)
+	}
+
+	d := NewDecoder([]byte(data))
+	d.CaseInsensitiveFields(true)
+	if err := d.Unmarshal(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.UserID != "lower" || c.Server.Name != "upper" || c.Server.Port != 1 || !c.Server.Host.Equal(net.IPv6loopback) {
+		t.Fatalf("Unexpected value: %#v", c)
+	}
+
+	// exact match takes precedence
+	var v struct {
+		Name  string
+		NAME  string
+		Other string `jsonx:"other"`
+	}
+	d = NewDecoder([]byte(`{NAME: "exact", OTHER: "folded"}`))
+	d.CaseInsensitiveFields(true)
+	if err := d.Unmarshal(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Name != "" || v.NAME != "exact" || v.Other != "folded" {
+		t.Fatalf("Unexpected value: %#v", v)
+	}
+
+	// the result does not depend on the map iteration order
+	for i := 0; i < 20; i++ {
+		var v struct {
+			Name  string
+			Other string `jsonx:"other"`
+		}
+		d = NewDecoder([]byte(`{NAME: "upper", Name: "exact", name: "lower", OTHER: "upper", Other: "title"}`))
+		d.CaseInsensitiveFields(true)
+		if err := d.Unmarshal(&v); err != nil {
+			t.Fatal(err)
+		}
+		if v.Name != "exact" || v.Other != "upper" {
+			t.Fatalf("Unexpected value: %#v", v)
+		}
+	}
+}
+
+func TestUnmarshalMap(t *testing.T) {
+	var ints map[string]int
+	if err := Unmarshal([]byte(`{a: 1, b: -2, "c d": 3}`), &ints); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ints, map[string]int{"a": 1, "b": -2, "c d": 3}) {
+		t.Fatalf("Unexpected value: %#v", ints)
+	}
+
+	type key string
+	servers := map[key]testServer{"old": {}}
+	if err := Unmarshal([]byte(`{main: {Name: "m", port: 80}, backup: {Name: "b"}}`), &servers); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[key]testServer{
+		"old":    {},
+		"main":   {Name: "m", Port: 80},
+		"backup": {Name: "b"},
+	}
+	if !reflect.DeepEqual(servers, expected) {
+		t.Fatalf("Unexpected value: %#v", servers)
+	}
+
+	var c struct {
+		Servers map[string]testServer
+	}
+	err := Unmarshal([]byte(`{Servers: {main: {port: "80"}}}`), &c)
+	if expected := (&UnmarshalTypeError{"string", reflect.TypeOf(0), "Servers.main.Port", nil}); !reflect.DeepEqual(err, expected) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = Unmarshal([]byte(`{a: 1, b: "x"}`), &ints)
+	if expected := (&UnmarshalTypeError{"string", reflect.TypeOf(0), "b", nil}); !reflect.DeepEqual(err, expected) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := Unmarshal([]byte(`null`), &ints); err != nil || ints != nil {
+		t.Fatalf("Unexpected result for null: %v, %#v", err, ints)
+	}
+}
+
+func TestUnmarshalSlice(t *testing.T) {
+	var ints []int
+	if err := Unmarshal([]byte(`[1, 2, 3]`), &ints); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ints, []int{1, 2, 3}) {
+		t.Fatalf("Unexpected value: %#v", ints)
+	}
+
+	var strs []string
+	if err := Unmarshal([]byte(`[]`), &strs); err != nil {
+		t.Fatal(err)
+	}
+	if strs == nil || len(strs) != 0 {
+		t.Fatalf("Unexpected value for empty array: %#v", strs)
+	}
+	strs = []string{"x"}
+	if err := Unmarshal([]byte(`null`), &strs); err != nil {
+		t.Fatal(err)
+	}
+	if strs != nil {
+		t.Fatalf("Unexpected value for null: %#v", strs)
+	}
+
+	var c struct {
+		Servers []testServer
+		Tags    [][]string
+		Data    []byte
+	}
+	err := Unmarshal([]byte(`{Servers: [{Name: "a"}, {Name: "b", port: 2}], Tags: [["x"], [], null], Data: bytes("AQI=")}`), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.Servers, []testServer{{Name: "a"}, {Name: "b", Port: 2}}) {
+		t.Fatalf("Unexpected value: %#v", c.Servers)
+	}
+	if !reflect.DeepEqual(c.Tags, [][]string{{"x"}, {}, nil}) {
+		t.Fatalf("Unexpected value: %#v", c.Tags)
+	}
+	if !reflect.DeepEqual(c.Data, []byte{1, 2}) {
+		t.Fatalf("Unexpected value: %#v", c.Data)
+	}
+
+	err = Unmarshal([]byte(`{Servers: [{}, {Name: 1}]}`), &c)
+	if expected := (&UnmarshalTypeError{"number", reflect.TypeOf(""), "Servers[1].Name", nil}); !reflect.DeepEqual(err, expected) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestUnmarshalIntCoercion(t *testing.T) {
+	var a []int64
+	if err := Unmarshal([]byte(`[1, int64(-2), int32(3), int8(4), uint64(5), 6e0, int(7)]`), &a); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(a, []int64{1, -2, 3, 4, 5, 6, 7}) {
+		t.Fatalf("Unexpected value: %#v", a)
+	}
+
+	var u []uint8
+	if err := Unmarshal([]byte(`[int64(255), uint32(0), 1]`), &u); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(u, []uint8{255, 0, 1}) {
+		t.Fatalf("Unexpected value: %#v", u)
+	}
+
+	var f []float32
+	if err := Unmarshal([]byte(`[int16(-3), 0.5]`), &f); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(f, []float32{-3, 0.5}) {
+		t.Fatalf("Unexpected value: %#v", f)
+	}
+
+	for i, tt := range []struct {
+		in    string
+		v     interface{}
+		value string
+		field string
+	}{
+		{in: `[1, 2.5]`, v: &[]int{}, value: "number", field: "[1]"},
+		{in: `[int64(-1)]`, v: &[]uint{}, value: "int64", field: "[0]"},
+		{in: `[int(1), int32(128)]`, v: &[]int8{}, value: "int32", field: "[1]"},
+		{in: `[uint64(18446744073709551615)]`, v: &[]int64{}, value: "uint64", field: "[0]"},
+		{in: `[duration("1s")]`, v: &[]int64{}, value: "time.Duration", field: "[0]"},
+		{in: `[duration("1s")]`, v: &[]float64{}, value: "time.Duration", field: "[0]"},
+	} {
+		err := Unmarshal([]byte(tt.in), tt.v)
+		terr, ok := err.(*UnmarshalTypeError)
+		if !ok {
+			t.Errorf("#%d: unexpected error %v", i, err)
+			continue
+		}
+		if terr.Value != tt.value || terr.Field != tt.field {
+			t.Errorf("#%d: unexpected error %v", i, err)
+		}
+	}
+}
+
+func TestUnmarshalNumberModes(t *testing.T) {
+	type numbers struct {
+		A float64
+		B int64
+		C uint8
+		D int
+	}
+	for i, mode := range []func(*Decoder){(*Decoder).UseNumber, (*Decoder).RawNumbers} {
+		d := NewDecoder([]byte(`{A: 1.5, B: -10, C: 200, D: 1e3}`))
+		mode(d)
+		var v numbers
+		if err := d.Unmarshal(&v); err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if v != (numbers{A: 1.5, B: -10, C: 200, D: 1000}) {
+			t.Errorf("#%d: %+v", i, v)
+		}
+
+		for j, in := range []string{`{B: 1.5}`, `{C: 256}`, `{C: -1}`} {
+			d = NewDecoder([]byte(in))
+			mode(d)
+			if err := d.Unmarshal(&v); err == nil {
+				t.Errorf("#%d.%d: expected error", i, j)
+			} else if _, ok := err.(*UnmarshalTypeError); !ok {
+				t.Errorf("#%d.%d: unexpected error %v", i, j, err)
+			}
+		}
+	}
+}
+
+func TestUnmarshalTime(t *testing.T) {
+	expected := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	for i, tt := range []struct {
+		in   string
+		unit EpochUnit
+	}{
+		{in: `{T: datetime("2023-11-14T22:13:20Z")}`},
+		{in: `{T: "2023-11-14T22:13:20Z"}`},
+		{in: `{T: 1700000000}`},
+		{in: `{T: int64(1700000000)}`},
+		{in: `{T: 1700000000000}`, unit: Millis},
+		{in: `{T: datetime(1700000000000)}`, unit: Millis},
+	} {
+		var v struct{ T time.Time }
+		d := NewDecoder([]byte(tt.in))
+		d.SetEpochUnit(tt.unit)
+		if err := d.Unmarshal(&v); err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !v.T.Equal(expected) {
+			t.Errorf("#%d: %v", i, v.T)
+		}
+	}
+
+	for i, tt := range []struct {
+		in       string
+		parseErr bool
+	}{
+		{in: `{T: "yesterday"}`, parseErr: true},
+		{in: `{T: "1700000000"}`, parseErr: true},
+		{in: `{T: 1.5}`},
+		{in: `{T: true}`},
+		{in: `{T: duration("1s")}`},
+	} {
+		var v struct{ T time.Time }
+		err := Unmarshal([]byte(tt.in), &v)
+		terr, ok := err.(*UnmarshalTypeError)
+		if !ok || terr.Field != "T" {
+			t.Errorf("#%d: unexpected error %v", i, err)
+			continue
+		}
+		var perr *time.ParseError
+		if errors.As(err, &perr) != tt.parseErr {
+			t.Errorf("#%d: unexpected error %v", i, err)
+		}
+	}
+}
+
+func TestUnmarshalPointers(t *testing.T) {
+	type sub struct {
+		A int
+	}
+	type s struct {
+		N *int
+		S *sub
+		P **string
+	}
+	one, str := 1, "x"
+	pstr := &str
+	for i, tt := range []struct {
+		in       string
+		expected s
+	}{
+		{in: `{N: 1, S: {A: 2}, P: "x"}`, expected: s{N: &one, S: &sub{A: 2}, P: &pstr}},
+		{in: `{N: null, S: null, P: null}`},
+		{in: `{}`},
+	} {
+		var v s
+		if err := Unmarshal([]byte(tt.in), &v); err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tt.expected) {
+			t.Errorf("#%d: %#v, expected %#v", i, v, tt.expected)
+		}
+	}
+
+	// existing values are updated in place, null and absent keys reset and keep the pointers respectively
+	n := 5
+	v := s{N: &n, S: &sub{A: 3}}
+	if err := Unmarshal([]byte(`{N: 7, S: null}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.N != &n || n != 7 || v.S != nil {
+		t.Fatalf("Unexpected value: %#v", v)
+	}
+	v = s{S: &sub{A: 3}}
+	if err := Unmarshal([]byte(`{N: 7}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if *v.N != 7 || v.S == nil || v.S.A != 3 {
+		t.Fatalf("Unexpected value: %#v", v)
+	}
+
+	// an invalid value does not allocate
+	v = s{}
+	err := Unmarshal([]byte(`{N: "a"}`), &v)
+	if terr, ok := err.(*UnmarshalTypeError); !ok || terr.Field != "N" || v.N != nil {
+		t.Fatalf("Unexpected result: %v, %#v", err, v)
+	}
+}
+
+func TestUnmarshalBase64(t *testing.T) {
+	type s struct {
+		Data  []byte  `jsonx:"data,base64"`
+		Ptr   *[]byte `jsonx:"ptr,base64"`
+		Plain []byte
+	}
+	for i, in := range []string{`{data: "YWJjZA==", ptr: "YWJjZA=="}`, `{data: bytes("YWJjZA=="), ptr: bytes("YWJjZA==")}`} {
+		var v s
+		if err := Unmarshal([]byte(in), &v); err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if string(v.Data) != "abcd" || v.Ptr == nil || string(*v.Ptr) != "abcd" {
+			t.Errorf("#%d: %q, %v", i, v.Data, v.Ptr)
+		}
+	}
+
+	var v s
+	for i, field := range []string{"Data", "Ptr"} {
+		err := Unmarshal([]byte(`{`+strings.ToLower(field)+`: "not base64!"}`), &v)
+		var cerr base64.CorruptInputError
+		if terr, ok := err.(*UnmarshalTypeError); !ok || terr.Field != field || !errors.As(err, &cerr) {
+			t.Fatalf("#%d: unexpected error: %v", i, err)
+		}
+	}
+	// without the tag a string is not accepted
+	err := Unmarshal([]byte(`{Plain: "YWJjZA=="}`), &v)
+	if terr, ok := err.(*UnmarshalTypeError); !ok || terr.Field != "Plain" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestDecodeBase64Field(t *testing.T) {
+	v, err := Decode([]byte(`{a: "aGVsbG8=", b: bytes("aGVsbG8="), c: 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := v.(map[string]interface{})
+	for _, key := range []string{"a", "b"} {
+		if b, err := DecodeBase64Field(m[key]); err != nil || string(b) != "hello" {
+			t.Errorf("%s: %q, %v", key, b, err)
+		}
+	}
+	if _, err := DecodeBase64Field(m["c"]); err == nil || err.Error() != "cannot decode number as base64" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := DecodeBase64Field("***"); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestDecodeObjectInto(t *testing.T) {
+	var c testConfig
+	if err := DecodeObjectInto([]byte(` {UserID: "u1", Server: {Name: "main", port: 80}}`), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.UserID != "u1" || c.Server.Name != "main" || c.Server.Port != 80 {
+		t.Fatalf("Unexpected value: %#v", c)
+	}
+
+	for i, tt := range []struct {
+		in    string
+		value string
+	}{
+		{in: `[{UserID: "u1"}]`, value: "array"},
+		{in: `"u1"`, value: "string"},
+		{in: `42`, value: "number"},
+		{in: `null`, value: "null"},
+		{in: `int(5)`, value: "int"},
+	} {
+		var c testConfig
+		err := DecodeObjectInto([]byte(tt.in), &c)
+		expected := &UnmarshalTypeError{Value: tt.value, Type: reflect.TypeOf(c)}
+		if !reflect.DeepEqual(err, expected) {
+			t.Errorf("#%d: unexpected error %v", i, err)
+		}
+	}
+
+	if err := DecodeObjectInto([]byte(`{UserID: 1}`), &c); err == nil {
+		t.Fatal("Expected error")
+	}
+	if err := DecodeObjectInto([]byte(`{`), &c); err != ErrUnexpectedEOF {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := DecodeObjectInto([]byte(`{}`), c); err == nil {
+		t.Fatal("Expected error")
+	}
+}
+
+func TestUnmarshalIntMapKeys(t *testing.T) {
+	var m map[int]string
+	if err := Unmarshal([]byte(`{"1": "a", "2": "b", "-3": "c"}`), &m); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, map[int]string{1: "a", 2: "b", -3: "c"}) {
+		t.Fatalf("Unexpected value: %#v", m)
+	}
+
+	var c struct {
+		Ports map[uint16]bool
+	}
+	if err := Unmarshal([]byte(`{Ports: {"80": true, "443": false}}`), &c); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.Ports, map[uint16]bool{80: true, 443: false}) {
+		t.Fatalf("Unexpected value: %#v", c.Ports)
+	}
+
+	for i, tt := range []struct {
+		in  string
+		err error
+	}{
+		{in: `{Ports: {"http": true}}`, err: &UnmarshalTypeError{`key "http"`, reflect.TypeOf(uint16(0)), "Ports", nil}},
+		{in: `{Ports: {"65536": true}}`, err: &UnmarshalTypeError{`key "65536"`, reflect.TypeOf(uint16(0)), "Ports", nil}},
+		{in: `{Ports: {"-1": true}}`, err: &UnmarshalTypeError{`key "-1"`, reflect.TypeOf(uint16(0)), "Ports", nil}},
+		// the smallest bad key is reported
+		{in: `{Ports: {"https": true, "80": true, "http": true, "ftp": true}}`, err: &UnmarshalTypeError{`key "ftp"`, reflect.TypeOf(uint16(0)), "Ports", nil}},
+	} {
+		for j := 0; j < 10; j++ {
+			err := Unmarshal([]byte(tt.in), &c)
+			if !reflect.DeepEqual(err, tt.err) {
+				t.Errorf("#%d: unexpected error %v", i, err)
+				break
+			}
+		}
+	}
+	if err := Unmarshal([]byte(`{"x": "a"}`), &m); err == nil || err.Error() != `cannot unmarshal key "x" into Go value of type int` {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var fm map[float64]string
+	if err := Unmarshal([]byte(`{"1": "a"}`), &fm); err == nil {
+		t.Fatal("Expected error")
+	}
+}
+
+func TestUnmarshalScalars(t *testing.T) {
+	ts := time.Date(2017, 12, 25, 15, 0, 0, 0, time.UTC)
+	_, ipnet, _ := net.ParseCIDR("10.0.0.0/8")
+	for i, tt := range []struct {
+		in       string
+		dst      interface{} // pointer to a zero value of the destination type
+		expected interface{}
+	}{
+		{in: `int64(5)`, dst: new(int64), expected: int64(5)},
+		{in: `int8(-5)`, dst: new(int), expected: -5},
+		{in: `uint64("18446744073709551615")`, dst: new(uint64), expected: uint64(18446744073709551615)},
+		{in: `uint16(7)`, dst: new(*uint16), expected: func() *uint16 { n := uint16(7); return &n }()},
+		{in: ` "text" `, dst: new(string), expected: "text"},
+		{in: `"text"`, dst: new(*string), expected: func() *string { s := "text"; return &s }()},
+		{in: `2.5`, dst: new(float32), expected: float32(2.5)},
+		{in: `true`, dst: new(bool), expected: true},
+		{in: `datetime("2017-12-25T15:00:00Z")`, dst: new(time.Time), expected: ts},
+		{in: `datetime("2017-12-25T15:00:00Z")`, dst: new(*time.Time), expected: &ts},
+		{in: `duration("1m30s")`, dst: new(time.Duration), expected: 90 * time.Second},
+		{in: `ip("10.0.0.1")`, dst: new(net.IP), expected: net.ParseIP("10.0.0.1")},
+		{in: `ipport("10.0.0.1:80")`, dst: new(net.TCPAddr), expected: net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 80}},
+		{in: `ipport("10.0.0.1:80")`, dst: new(*net.TCPAddr), expected: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 80}},
+		{in: `cidr("10.0.0.0/8")`, dst: new(*net.IPNet), expected: ipnet},
+		{in: `cidr("10.0.0.0/8")`, dst: new(net.IPNet), expected: *ipnet},
+		{in: `bytes("YWI=")`, dst: new([]byte), expected: []byte("ab")},
+		{in: `null`, dst: new(*int), expected: (*int)(nil)},
+	} {
+		if err := Unmarshal([]byte(tt.in), tt.dst); err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if v := reflect.ValueOf(tt.dst).Elem().Interface(); !reflect.DeepEqual(v, tt.expected) {
+			t.Errorf("#%d: %#v, expected %#v", i, v, tt.expected)
+		}
+	}
+
+	var n int8
+	err := Unmarshal([]byte(`int64(500)`), &n)
+	if expected := (&UnmarshalTypeError{Value: "int64", Type: reflect.TypeOf(n)}); !reflect.DeepEqual(err, expected) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
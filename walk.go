@@ -0,0 +1,67 @@
+package jsonx
+
+import (
+	"errors"
+	"sort"
+)
+
+// SkipChildren can be returned by a WalkFunc to indicate that the children of the
+// current value should not be visited. It is not returned as an error by Walk.
+var SkipChildren = errors.New("skip children")
+
+// WalkFunc is the type of the function called by Walk for each visited value.
+// The path contains string keys for object members and int indices for array
+// elements, it is empty for the top-level value. The path slice is reused between
+// calls, make a copy if you need to retain it.
+type WalkFunc func(path []interface{}, value interface{}) error
+
+// Walk traverses the decoded value v depth-first, calling fn for each value including v itself.
+// Object members are visited in the order of their sorted keys, those of an *OrderedMap in its order.
+// If fn returns SkipChildren for an object or an array its elements are not visited, any other
+// non-nil error stops the traversal and is returned by Walk.
+func Walk(v interface{}, fn WalkFunc) error {
+	err := walk(make([]interface{}, 0, 8), v, fn)
+	if err == SkipChildren {
+		return nil
+	}
+	return err
+}
+
+func walk(path []interface{}, v interface{}, fn WalkFunc) error {
+	err := fn(path, v)
+	if err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			err = walk(append(path, key), v[key], fn)
+			if err != nil && err != SkipChildren {
+				return err
+			}
+		}
+	case *OrderedMap:
+		for _, key := range v.Keys() {
+			val, _ := v.Get(key)
+			err = walk(append(path, key), val, fn)
+			if err != nil && err != SkipChildren {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			err = walk(append(path, i), item, fn)
+			if err != nil && err != SkipChildren {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
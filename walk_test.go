@@ -0,0 +1,71 @@
+package jsonx
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	v, err := Decode([]byte(`{b: [1, {c: "x"}], a: {d: null}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	err = Walk(v, func(path []interface{}, value interface{}) error {
+		paths = append(paths, fmt.Sprint(path))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"[]", "[a]", "[a d]", "[b]", "[b 0]", "[b 1]", "[b 1 c]"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("Unexpected paths: %v", paths)
+	}
+}
+
+func TestWalkSkipChildren(t *testing.T) {
+	v, err := Decode([]byte(`{a: {secret: "x", more: [1, 2]}, b: true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	err = Walk(v, func(path []interface{}, value interface{}) error {
+		paths = append(paths, fmt.Sprint(path))
+		if len(path) == 1 && path[0] == "a" {
+			return SkipChildren
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"[]", "[a]", "[b]"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("Unexpected paths: %v", paths)
+	}
+}
+
+func TestWalkError(t *testing.T) {
+	stop := errors.New("stop")
+	count := 0
+	err := Walk([]interface{}{1.0, 2.0, 3.0}, func(path []interface{}, value interface{}) error {
+		count++
+		if value == 2.0 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("Unexpected count: %d", count)
+	}
+}